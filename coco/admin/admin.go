@@ -0,0 +1,180 @@
+// Package admin serves a local control endpoint for the operators of a
+// signing node.
+//
+// The endpoint speaks HTTP over TCP or a Unix socket:
+//
+//	GET  /status                     state of the node, as JSON
+//	POST /viewchange                 start a view change
+//	POST /add?name=h&parent=p        propose adding host h under p
+//	POST /remove?name=h&parent=p     propose removing host h, child of p
+//	POST /failurerate?rate=n         set the failure rate, in test mode only
+//	POST /shutdown?reason=r          propose shutting the group down
+//
+// Commands must carry the operator token in an
+// "Authorization: Bearer <token>" header. Without a token set,
+// only the status is served.
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/dedis/prifi/coco/sign"
+)
+
+type Server struct {
+	Node     *sign.Node
+	Token    string // operator token, commands are refused when empty
+	TestMode bool   // allow changing failure rates
+
+	mux *http.ServeMux
+	ln  net.Listener
+}
+
+func NewServer(sn *sign.Node, token string) *Server {
+	s := &Server{Node: sn, Token: token}
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("/status", s.status)
+	s.mux.HandleFunc("/viewchange", s.command(s.viewChange))
+	s.mux.HandleFunc("/add", s.command(s.add))
+	s.mux.HandleFunc("/remove", s.command(s.remove))
+	s.mux.HandleFunc("/failurerate", s.command(s.failureRate))
+	s.mux.HandleFunc("/shutdown", s.command(s.shutdown))
+	return s
+}
+
+// Listen on addr and serve in the background. Addresses of the form
+// "unix:/path" listen on a Unix socket, others on TCP.
+func (s *Server) Listen(addr string) error {
+	var ln net.Listener
+	var err error
+	if strings.HasPrefix(addr, "unix:") {
+		path := strings.TrimPrefix(addr, "unix:")
+		// remove the socket left over by a previous run
+		os.Remove(path)
+		ln, err = net.Listen("unix", path)
+		if err == nil {
+			err = os.Chmod(path, 0600)
+		}
+	} else {
+		ln, err = net.Listen("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	s.ln = ln
+
+	go func() {
+		err := http.Serve(ln, s)
+		log.Println(s.Node.Name(), "admin endpoint closed:", err)
+	}()
+	return nil
+}
+
+func (s *Server) Close() error {
+	if s.ln == nil {
+		return nil
+	}
+	return s.ln.Close()
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) status(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "status must be read with GET", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.Node.Status()); err != nil {
+		log.Errorln(s.Node.Name(), "admin: writing status:", err)
+	}
+}
+
+// Whether the request carries the operator token
+func (s *Server) authorized(r *http.Request) bool {
+	if s.Token == "" {
+		return false
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	token := strings.TrimPrefix(auth, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) == 1
+}
+
+// Wrap an operator command: check method and token, and report its error
+func (s *Server) command(cmd func(r *http.Request) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "commands must be sent with POST", http.StatusMethodNotAllowed)
+			return
+		}
+		if !s.authorized(r) {
+			http.Error(w, "invalid operator token", http.StatusUnauthorized)
+			return
+		}
+		log.Infoln(s.Node.Name(), "admin: operator command", r.URL.Path, r.URL.RawQuery)
+		if err := cmd(r); err != nil {
+			code := http.StatusInternalServerError
+			if err == ErrBadRequest {
+				code = http.StatusBadRequest
+			} else if err == ErrTestModeOnly {
+				code = http.StatusForbidden
+			}
+			http.Error(w, err.Error(), code)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (s *Server) viewChange(r *http.Request) error {
+	return s.Node.RequestViewChange()
+}
+
+func (s *Server) add(r *http.Request) error {
+	name, parent := r.FormValue("name"), r.FormValue("parent")
+	if name == "" || parent == "" {
+		return ErrBadRequest
+	}
+	return s.Node.ProposeAdd(name, parent)
+}
+
+func (s *Server) remove(r *http.Request) error {
+	name, parent := r.FormValue("name"), r.FormValue("parent")
+	if name == "" || parent == "" {
+		return ErrBadRequest
+	}
+	return s.Node.ProposeRemove(name, parent)
+}
+
+func (s *Server) failureRate(r *http.Request) error {
+	if !s.TestMode {
+		return ErrTestModeOnly
+	}
+	rate, err := strconv.Atoi(r.FormValue("rate"))
+	if err != nil || rate < 0 || rate > 100 {
+		return ErrBadRequest
+	}
+	s.Node.SetFailureRate(rate)
+	return nil
+}
+
+func (s *Server) shutdown(r *http.Request) error {
+	reason := r.FormValue("reason")
+	if reason == "" {
+		reason = "operator request"
+	}
+	return s.Node.Shutdown(reason)
+}
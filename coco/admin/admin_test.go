@@ -0,0 +1,76 @@
+package admin_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dedis/prifi/coco/admin"
+	"github.com/dedis/prifi/coco/sign"
+	"github.com/dedis/prifi/coco/test/oldconfig"
+)
+
+func post(t *testing.T, url, token string) int {
+	req, err := http.NewRequest("POST", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestAdminServer(t *testing.T) {
+	hc, err := oldconfig.LoadConfig("../test/data/exconf.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = hc.Run(false, sign.MerkleTree); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, sn := range hc.SNodes {
+			sn.Close()
+		}
+	}()
+
+	ts := httptest.NewServer(admin.NewServer(hc.SNodes[0], "secret"))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := &sign.NodeStatus{}
+	err = json.NewDecoder(resp.Body).Decode(st)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Name != hc.SNodes[0].Name() || st.Role != "root" || len(st.Children) != 2 {
+		t.Fatal("wrong status:", st)
+	}
+
+	if code := post(t, ts.URL+"/shutdown", ""); code != http.StatusUnauthorized {
+		t.Fatal("command accepted without token:", code)
+	}
+	if code := post(t, ts.URL+"/shutdown", "wrong"); code != http.StatusUnauthorized {
+		t.Fatal("command accepted with wrong token:", code)
+	}
+	if code := post(t, ts.URL+"/failurerate?rate=10", "secret"); code != http.StatusForbidden {
+		t.Fatal("failure rate changed outside of test mode:", code)
+	}
+	if code := post(t, ts.URL+"/add?name=host6", "secret"); code != http.StatusBadRequest {
+		t.Fatal("add accepted without parent:", code)
+	}
+	if code := post(t, ts.URL+"/shutdown?reason=test", "secret"); code != http.StatusOK {
+		t.Fatal("shutdown refused:", code)
+	}
+}
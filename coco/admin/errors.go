@@ -0,0 +1,7 @@
+package admin
+
+import "errors"
+
+var ErrBadRequest error = errors.New("missing or invalid command parameters")
+
+var ErrTestModeOnly error = errors.New("command only allowed in test mode")
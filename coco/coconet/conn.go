@@ -1,6 +1,8 @@
 package coconet
 
 import (
+	"errors"
+
 	"github.com/dedis/crypto/abstract"
 )
 
@@ -44,3 +46,26 @@ type BinaryMarshaler interface {
 type BinaryUnmarshaler interface {
 	UnmarshalBinary(data []byte) error
 }
+
+// ErrSuiteMismatch is returned when establishing a connection with a peer
+// that uses a different crypto suite.
+var ErrSuiteMismatch = errors.New("peer uses a different crypto suite")
+
+// exchangeSuite sends the name of our suite over the connection and checks
+// the name sent by the peer. It is done before exchanging public keys, so
+// that hosts running different suites refuse to connect instead of decoding
+// each other's points as garbage.
+func exchangeSuite(c Conn, suite abstract.Suite) error {
+	mine := StringMarshaler(suite.String())
+	if err := c.Put(&mine); err != nil {
+		return err
+	}
+	var theirs StringMarshaler
+	if err := c.Get(&theirs); err != nil {
+		return err
+	}
+	if theirs != mine {
+		return ErrSuiteMismatch
+	}
+	return nil
+}
@@ -115,6 +115,13 @@ func (h *GoHost) ConnectTo(parent string) error {
 		log.Fatal("failed to connect: putting name:", err)
 	}
 
+	// refuse parents running a different suite
+	err = exchangeSuite(conn, h.suite)
+	if err != nil {
+		log.Errorln("failed to establish connection with", parent, ":", err)
+		return err
+	}
+
 	// give the parent the public key
 	err = conn.Put(h.Pubkey)
 	if err != nil {
@@ -178,6 +185,13 @@ func (h *GoHost) Listen() error {
 				log.Fatal("failed to establish connection: getting name:", err)
 			}
 
+			// refuse children running a different suite
+			err = exchangeSuite(conn, h.suite)
+			if err != nil {
+				log.Errorln("failed to establish connection with", c, ":", err)
+				return
+			}
+
 			suite := h.suite
 			pubkey := suite.Point()
 
@@ -133,6 +133,14 @@ func (h *TCPHost) Listen() error {
 			// create connection
 			tp.SetName(name)
 
+			// refuse children running a different suite
+			err = exchangeSuite(tp, h.suite)
+			if err != nil {
+				log.Errorln("failed to establish connection with", name, ":", err)
+				tp.Close()
+				continue
+			}
+
 			// get and set public key
 			suite := h.suite
 			pubkey := suite.Point()
@@ -197,6 +205,14 @@ func (h *TCPHost) ConnectTo(parent string) error {
 	}
 	tp.SetName(parent)
 
+	// refuse parents running a different suite
+	err = exchangeSuite(tp, h.suite)
+	if err != nil {
+		log.Errorln("failed to establish connection with", parent, ":", err)
+		tp.Close()
+		return err
+	}
+
 	// give parent the public key
 	err = tp.Put(h.Pubkey)
 	if err != nil {
@@ -5,6 +5,9 @@ import (
 	"errors"
 )
 
+var ErrNotFound error = errors.New("HashId not found")
+var ErrBadContent error = errors.New("content does not match its HashId")
+
 const Size int = 32 // TODO: change the way this is known
 
 type HashId []byte // Cryptographic hash content-IDs
@@ -54,7 +57,7 @@ func (m HashMap) Put(id HashId, data []byte) {
 func (m HashMap) Get(id HashId) ([]byte, error) {
 	blob, ok := m[string(id)]
 	if !ok {
-		return nil, errors.New("HashId not found")
+		return nil, ErrNotFound
 	}
 	return blob, nil
 }
@@ -0,0 +1,213 @@
+package hashid
+
+import (
+	"bytes"
+	"container/list"
+	"errors"
+	"hash"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/dedis/prifi/coco/coconet"
+	"github.com/dedis/protobuf"
+)
+
+// Remote content lookup
+//
+// A PeerGet looks blobs up at a peer over a coconet connection, one
+// request at a time: it sends the HashId, the peer answers with the blob
+// from its store, see ServeBlobs. Requests are numbered and the peer
+// echoes the number, so the late reply to a request whose Get failed,
+// e.g. on a timeout, is skipped instead of answering the next one. A
+// single goroutine reads the replies of the peer, Get gives up waiting
+// for them after the timeout of the PeerGet. Blobs
+// are checked against their HashId before being returned, so a faulty
+// peer can at worst fail the lookup, and the last ones fetched are kept
+// in a bounded LRU cache. The time and tree packages wrap a PeerGet in
+// their own HashGet, see their RemoteGet.
+
+var ErrBadReply error = errors.New("reply to a request not sent yet")
+var ErrPeerTimeout error = errors.New("no reply from the peer in time")
+
+// Request for the blob of a HashId
+type BlobRequest struct {
+	ReqNo uint64
+	Id    HashId
+}
+
+func (br *BlobRequest) MarshalBinary() ([]byte, error) {
+	return protobuf.Encode(br)
+}
+
+func (br *BlobRequest) UnmarshalBinary(data []byte) error {
+	return protobuf.Decode(data, br)
+}
+
+type BlobReply struct {
+	ReqNo uint64 // of the request answered
+	Data  []byte
+	Err   string // why the blob was not found, if so
+}
+
+func (br *BlobReply) MarshalBinary() ([]byte, error) {
+	return protobuf.Encode(br)
+}
+
+func (br *BlobReply) UnmarshalBinary(data []byte) error {
+	return protobuf.Decode(data, br)
+}
+
+// Check that data has the given HashId
+func CheckBlob(newHash func() hash.Hash, id HashId, data []byte) error {
+	h := newHash()
+	h.Write(data)
+	if !bytes.Equal(h.Sum(nil), id) {
+		return ErrBadContent
+	}
+	return nil
+}
+
+// Bounded cache of blobs, evicting the least recently used
+type lru struct {
+	size  int
+	order *list.List // of *lruEntry, most recent first
+	items map[string]*list.Element
+}
+
+type lruEntry struct {
+	key  string
+	data []byte
+}
+
+func newLRU(size int) *lru {
+	return &lru{size: size, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (c *lru) get(id HashId) ([]byte, bool) {
+	e, ok := c.items[string(id)]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*lruEntry).data, true
+}
+
+func (c *lru) put(id HashId, data []byte) {
+	if c.size <= 0 {
+		return
+	}
+	if e, ok := c.items[string(id)]; ok {
+		c.order.MoveToFront(e)
+		return
+	}
+	c.items[string(id)] = c.order.PushFront(&lruEntry{string(id), data})
+	for c.order.Len() > c.size {
+		e := c.order.Back()
+		c.order.Remove(e)
+		delete(c.items, e.Value.(*lruEntry).key)
+	}
+}
+
+// HashGet looking blobs up at a peer
+type PeerGet struct {
+	mu      sync.Mutex
+	newHash func() hash.Hash
+	conn    coconet.Conn
+	cache   *lru
+	reqno   uint64 // of the last request sent
+	timeout time.Duration
+	replies chan peerReply // closed once the connection failed
+}
+
+// Reply read from the peer, or the error reading it
+type peerReply struct {
+	rep *BlobReply
+	err error
+}
+
+// Look blobs up over conn, keeping up to cache of them in memory and
+// waiting up to timeout for each reply
+func NewPeerGet(newHash func() hash.Hash, conn coconet.Conn, cache int, timeout time.Duration) *PeerGet {
+	pg := &PeerGet{newHash: newHash, conn: conn, cache: newLRU(cache),
+		timeout: timeout, replies: make(chan peerReply, 1)}
+	go pg.read()
+	return pg
+}
+
+// Read the replies of the peer until the connection fails
+func (pg *PeerGet) read() {
+	for {
+		rep := &BlobReply{}
+		if err := pg.conn.Get(rep); err != nil {
+			pg.replies <- peerReply{err: err}
+			close(pg.replies)
+			return
+		}
+		pg.replies <- peerReply{rep: rep}
+	}
+}
+
+func (pg *PeerGet) Get(id HashId) ([]byte, error) {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+	if data, ok := pg.cache.get(id); ok {
+		return data, nil
+	}
+
+	pg.reqno++
+	if err := pg.conn.Put(&BlobRequest{ReqNo: pg.reqno, Id: id}); err != nil {
+		return nil, err
+	}
+	var rep *BlobReply
+	timeout := time.After(pg.timeout)
+	for rep == nil {
+		select {
+		case r, ok := <-pg.replies:
+			if !ok {
+				return nil, io.EOF
+			}
+			if r.err != nil {
+				return nil, r.err
+			}
+			if r.rep.ReqNo > pg.reqno {
+				return nil, ErrBadReply
+			}
+			// skip late replies to earlier requests
+			if r.rep.ReqNo == pg.reqno {
+				rep = r.rep
+			}
+		case <-timeout:
+			return nil, ErrPeerTimeout
+		}
+	}
+	if rep.Err != "" {
+		return nil, errors.New(rep.Err)
+	}
+	if err := CheckBlob(pg.newHash, id, rep.Data); err != nil {
+		return nil, err
+	}
+	pg.cache.put(id, rep.Data)
+	return rep.Data, nil
+}
+
+// Answer the blob requests coming over conn from store, until the
+// connection fails
+func ServeBlobs(conn coconet.Conn, store HashGet) error {
+	for {
+		req := &BlobRequest{}
+		if err := conn.Get(req); err != nil {
+			return err
+		}
+		rep := &BlobReply{ReqNo: req.ReqNo}
+		data, err := store.Get(req.Id)
+		if err != nil {
+			rep.Err = err.Error()
+		} else {
+			rep.Data = data
+		}
+		if err := conn.Put(rep); err != nil {
+			return err
+		}
+	}
+}
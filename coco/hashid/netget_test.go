@@ -0,0 +1,77 @@
+package hashid_test
+
+import (
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dedis/prifi/coco/coconet"
+	"github.com/dedis/prifi/coco/hashid"
+)
+
+// Blobs stored on disk at one peer are fetched and checked by another,
+// then served from the cache
+func TestPeerGet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hashid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := hashid.NewDiskStore(sha256.New, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := store.Add([]byte("blob"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(id, []byte("other")); err != hashid.ErrBadContent {
+		t.Fatal("stored a blob under another HashId")
+	}
+
+	goDir := coconet.NewGoDirectory()
+	defer goDir.Close()
+	client, _ := coconet.NewGoConn(goDir, "client", "server")
+	server, _ := coconet.NewGoConn(goDir, "server", "client")
+	// a late reply to a request the client gave up on is skipped
+	if err := server.Put(&hashid.BlobReply{Data: []byte("late")}); err != nil {
+		t.Fatal(err)
+	}
+	go hashid.ServeBlobs(server, store)
+
+	pg := hashid.NewPeerGet(sha256.New, client, 2, 5*time.Second)
+	data, err := pg.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "blob" {
+		t.Fatal("got", string(data))
+	}
+	missing := sha256.Sum256([]byte("missing"))
+	if _, err := pg.Get(missing[:]); err == nil {
+		t.Fatal("got a blob the peer does not have")
+	}
+
+	// cached blobs are returned without asking the peer
+	server.Close()
+	if _, err := pg.Get(id); err != nil {
+		t.Fatal("blob not cached:", err)
+	}
+}
+
+// A peer that does not answer fails the lookup after the timeout
+func TestPeerGetTimeout(t *testing.T) {
+	goDir := coconet.NewGoDirectory()
+	defer goDir.Close()
+	client, _ := coconet.NewGoConn(goDir, "client", "server")
+	server, _ := coconet.NewGoConn(goDir, "server", "client")
+	defer server.Close()
+
+	pg := hashid.NewPeerGet(sha256.New, client, 2, 100*time.Millisecond)
+	id := sha256.Sum256([]byte("blob"))
+	if _, err := pg.Get(id[:]); err != hashid.ErrPeerTimeout {
+		t.Fatal("no timeout from a silent peer:", err)
+	}
+}
@@ -0,0 +1,85 @@
+package hashid
+
+import (
+	"encoding/hex"
+	"hash"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Disk store
+//
+// A DiskStore keeps blobs in files named after the hex of their HashId,
+// under a subdirectory per first byte. Blobs are written to a temporary
+// file then renamed, so a crash never leaves a partial blob, and checked
+// against their HashId when read back.
+
+type DiskStore struct {
+	dir     string
+	newHash func() hash.Hash
+}
+
+func NewDiskStore(newHash func() hash.Hash, dir string) (*DiskStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &DiskStore{dir: dir, newHash: newHash}, nil
+}
+
+func (ds *DiskStore) path(id HashId) string {
+	name := hex.EncodeToString(id)
+	if len(name) < 2 {
+		return filepath.Join(ds.dir, name)
+	}
+	return filepath.Join(ds.dir, name[:2], name)
+}
+
+// Store data under its HashId, returned
+func (ds *DiskStore) Add(data []byte) (HashId, error) {
+	h := ds.newHash()
+	h.Write(data)
+	id := HashId(h.Sum(nil))
+	return id, ds.Put(id, data)
+}
+
+func (ds *DiskStore) Put(id HashId, data []byte) error {
+	if err := CheckBlob(ds.newHash, id, data); err != nil {
+		return err
+	}
+	p := ds.path(id)
+	if _, err := os.Stat(p); err == nil {
+		return nil // already stored
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(p), "tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), p)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+func (ds *DiskStore) Get(id HashId) ([]byte, error) {
+	data, err := ioutil.ReadFile(ds.path(id))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if err := CheckBlob(ds.newHash, id, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,226 @@
+package proof
+
+import (
+	"crypto/subtle"
+	"errors"
+
+	"github.com/dedis/prifi/coco/hashid"
+)
+
+// Append-only history tree
+//
+// Merkle tree over a growing list of leaves as in Certificate
+// Transparency (RFC 6962): leaves and interior nodes are hashed with
+// distinct prefixes, and the tree of the first n leaves splits at the
+// largest power of two below n. The root of the tree of size n, the head
+// of the history, commits to the first n leaves; an inclusion proof shows
+// leaf i is in the head of size n, and a consistency proof shows the
+// head of size n extends the head of size m: the tree of size m is a
+// prefix of the tree of size n. Both are paths of sibling hashes, checked
+// without the leaves. Roots of complete subtrees never change once their
+// leaves are in, the tree keeps them: heads and proofs hash O(log n)
+// nodes.
+
+var ErrHistorySize error = errors.New("history tree is smaller than requested")
+
+type History struct {
+	newHash HashFunc
+	leaves  [][]byte                  // data of the leaves
+	hashes  []hashid.HashId           // leaf hashes
+	nodes   map[subtree]hashid.HashId // roots of complete subtrees
+}
+
+// Complete subtree of size leaves from leaf lo
+type subtree struct {
+	lo, size int
+}
+
+func NewHistory(newHash HashFunc) *History {
+	return &History{newHash: newHash, nodes: make(map[subtree]hashid.HashId)}
+}
+
+func leafHash(newHash HashFunc, data []byte) hashid.HashId {
+	h := newHash()
+	h.Write([]byte{0})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func nodeHash(newHash HashFunc, left, right []byte) hashid.HashId {
+	h := newHash()
+	h.Write([]byte{1})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// Largest power of two smaller than n, n > 1
+func split(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+// Append a leaf, returning its index
+func (t *History) Append(data []byte) int {
+	t.leaves = append(t.leaves, data)
+	t.hashes = append(t.hashes, leafHash(t.newHash, data))
+	return len(t.leaves) - 1
+}
+
+func (t *History) Size() int {
+	return len(t.leaves)
+}
+
+// Data of leaf i
+func (t *History) Leaf(i int) []byte {
+	return t.leaves[i]
+}
+
+// Root of the tree over the leaves lo to hi
+func (t *History) root(lo, hi int) hashid.HashId {
+	n := hi - lo
+	switch n {
+	case 0:
+		return t.newHash().Sum(nil)
+	case 1:
+		return t.hashes[lo]
+	}
+	complete := n&(n-1) == 0
+	if r, ok := t.nodes[subtree{lo, n}]; complete && ok {
+		return r
+	}
+	k := split(n)
+	r := nodeHash(t.newHash, t.root(lo, lo+k), t.root(lo+k, hi))
+	if complete {
+		t.nodes[subtree{lo, n}] = r
+	}
+	return r
+}
+
+// Head of the history of size n
+func (t *History) Root(n int) (hashid.HashId, error) {
+	if n < 0 || n > len(t.hashes) {
+		return nil, ErrHistorySize
+	}
+	return t.root(0, n), nil
+}
+
+// Path of leaf i in the tree over the leaves lo to hi, deepest sibling first
+func (t *History) path(i, lo, hi int) Proof {
+	if hi-lo <= 1 {
+		return Proof{}
+	}
+	k := split(hi - lo)
+	if i < lo+k {
+		return append(t.path(i, lo, lo+k), t.root(lo+k, hi))
+	}
+	return append(t.path(i, lo+k, hi), t.root(lo, lo+k))
+}
+
+// Proof that leaf i is included in the head of size n
+func (t *History) Inclusion(i, n int) (Proof, error) {
+	if n > len(t.hashes) || i < 0 || i >= n {
+		return nil, ErrHistorySize
+	}
+	return t.path(i, 0, n), nil
+}
+
+// Consistency proof of the first m of the leaves lo to hi, complete
+// tells whether they are a complete subtree whose root the verifier
+// already holds
+func (t *History) subproof(m, lo, hi int, complete bool) Proof {
+	n := hi - lo
+	if m == n {
+		if complete {
+			return Proof{}
+		}
+		return Proof{t.root(lo, hi)}
+	}
+	k := split(n)
+	if m <= k {
+		return append(t.subproof(m, lo, lo+k, complete), t.root(lo+k, hi))
+	}
+	return append(t.subproof(m-k, lo+k, hi, false), t.root(lo, lo+k))
+}
+
+// Proof that the head of size n extends the head of size m
+func (t *History) Consistency(m, n int) (Proof, error) {
+	if n > len(t.hashes) || m <= 0 || m > n {
+		return nil, ErrHistorySize
+	}
+	return t.subproof(m, 0, n, true), nil
+}
+
+func equal(a, b []byte) bool {
+	return subtle.ConstantTimeCompare(a, b) == 1
+}
+
+// Check that data is leaf i of the head root of size n
+func VerifyInclusion(newHash HashFunc, i, n int, data []byte, prf Proof, root hashid.HashId) bool {
+	if i < 0 || i >= n {
+		return false
+	}
+	fn, sn := i, n-1
+	r := leafHash(newHash, data)
+	for _, p := range prf {
+		if sn == 0 {
+			return false
+		}
+		if fn&1 == 1 || fn == sn {
+			r = nodeHash(newHash, p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = nodeHash(newHash, r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	return sn == 0 && equal(r, root)
+}
+
+// Check that the head newRoot of size n extends the head oldRoot of size m
+func VerifyConsistency(newHash HashFunc, m, n int, oldRoot, newRoot hashid.HashId, prf Proof) bool {
+	if m <= 0 || m > n {
+		return false
+	}
+	if m == n {
+		return len(prf) == 0 && equal(oldRoot, newRoot)
+	}
+	// the old head is a complete subtree, its root starts the path
+	if m&(m-1) == 0 {
+		prf = append(Proof{oldRoot}, prf...)
+	}
+	if len(prf) == 0 {
+		return false
+	}
+	fn, sn := m-1, n-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+	fr, sr := prf[0], prf[0]
+	for _, c := range prf[1:] {
+		if sn == 0 {
+			return false
+		}
+		if fn&1 == 1 || fn == sn {
+			fr = nodeHash(newHash, c, fr)
+			sr = nodeHash(newHash, c, sr)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			sr = nodeHash(newHash, sr, c)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	return sn == 0 && equal(fr, oldRoot) && equal(sr, newRoot)
+}
@@ -0,0 +1,48 @@
+package proof
+
+import (
+	"crypto/sha256"
+	"testing"
+)
+
+// Every leaf is included in every head holding it, and every head
+// extends the heads before it
+func TestHistory(t *testing.T) {
+	newHash := sha256.New
+	h := NewHistory(newHash)
+	for n := 1; n <= 20; n++ {
+		h.Append([]byte{byte(n)})
+		root, err := h.Root(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < n; i++ {
+			prf, err := h.Inclusion(i, n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !VerifyInclusion(newHash, i, n, h.Leaf(i), prf, root) {
+				t.Fatal("leaf", i, "not included in head", n)
+			}
+			if VerifyInclusion(newHash, i, n, []byte("other"), prf, root) {
+				t.Fatal("other leaf included in head", n)
+			}
+		}
+		for m := 1; m <= n; m++ {
+			old, _ := h.Root(m)
+			prf, err := h.Consistency(m, n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !VerifyConsistency(newHash, m, n, old, root, prf) {
+				t.Fatal("head", n, "does not extend head", m)
+			}
+			if m < n && VerifyConsistency(newHash, m, n, root, root, prf) {
+				t.Fatal("head", n, "extends a forged head", m)
+			}
+		}
+	}
+	if _, err := h.Consistency(3, 21); err != ErrHistorySize {
+		t.Fatal("consistency proof past the head:", err)
+	}
+}
@@ -80,6 +80,26 @@ func CheckProof(newHash HashFunc, root hashid.HashId, leaf hashid.HashId, proof
 	return true
 }
 
+// Size of the random nonces salting the leaves given by clients
+const NonceSize = 16
+
+// Leaf standing for val in a tree, salted with nonce: paths to
+// neighbouring leaves reveal only hashes of val with an unknown nonce,
+// even when val has little entropy
+func SaltedLeaf(newHash HashFunc, nonce, val []byte) hashid.HashId {
+	h := newHash()
+	h.Write(nonce)
+	h.Write(val)
+	return h.Sum(nil)
+}
+
+// Check a proof from val, salted with nonce, to root. Unlike CheckProof
+// it reports a bad proof instead of panicking, as clients verify proofs
+// sent by servers.
+func CheckSaltedProof(newHash HashFunc, root hashid.HashId, nonce, val []byte, proof Proof) bool {
+	return proof.Check(newHash, root, SaltedLeaf(newHash, nonce, val))
+}
+
 func CheckLocalProofs(newHash HashFunc, root hashid.HashId, leaves []hashid.HashId, proofs []Proof) bool {
 	// fmt.Println("Created mtRoot:", mtRoot)
 
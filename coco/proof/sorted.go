@@ -0,0 +1,278 @@
+package proof
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sort"
+
+	"github.com/dedis/prifi/coco/hashid"
+)
+
+// Sorted Merkle tree
+//
+// The keys of a batch, say the hashes submitted in a round, are sorted
+// and deduplicated then laid out as the leaves of a history tree, see
+// history.go, whose inclusion proofs bind the index of a leaf. A key is
+// proven present by its path, and absent by the paths of its two
+// neighbours: adjacent leaves, one lower and one higher than the key, or
+// the first or last leaf alone when the key falls outside. Absence proofs
+// only hold for roots of trees whose leaves are sorted, as built by
+// NewSortedTree: the verifier does not see the other leaves.
+//
+// The paths of two adjacent leaves share the siblings above their common
+// ancestor, encoded once by MarshalBinary.
+
+var ErrMember error = errors.New("key is in the sorted tree")
+var ErrNotMember error = errors.New("key is not in the sorted tree")
+var ErrBadProof error = errors.New("malformed sorted tree proof")
+
+type SortedTree struct {
+	keys []hashid.HashId
+	tree *History
+}
+
+func NewSortedTree(newHash HashFunc, keys []hashid.HashId) *SortedTree {
+	sorted := make([]hashid.HashId, len(keys))
+	copy(sorted, keys)
+	sort.Sort(hashid.ByHashId(sorted))
+	t := &SortedTree{tree: NewHistory(newHash)}
+	for i, k := range sorted {
+		if i > 0 && bytes.Equal(k, sorted[i-1]) {
+			continue
+		}
+		t.keys = append(t.keys, k)
+		t.tree.Append(k)
+	}
+	return t
+}
+
+// Number of distinct keys
+func (t *SortedTree) Size() int {
+	return len(t.keys)
+}
+
+func (t *SortedTree) Root() hashid.HashId {
+	root, _ := t.tree.Root(len(t.keys))
+	return root
+}
+
+// Leaf of a sorted tree with its path
+type Neighbor struct {
+	Index int
+	Key   hashid.HashId
+	Prf   Proof
+}
+
+func (t *SortedTree) neighbor(i int) *Neighbor {
+	prf, _ := t.tree.Inclusion(i, len(t.keys))
+	return &Neighbor{Index: i, Key: t.keys[i], Prf: prf}
+}
+
+// Index of the first key not lower than key
+func (t *SortedTree) search(key hashid.HashId) int {
+	return sort.Search(len(t.keys), func(i int) bool {
+		return bytes.Compare(t.keys[i], key) >= 0
+	})
+}
+
+// Proof that key is in the tree
+func (t *SortedTree) Inclusion(key hashid.HashId) (*Neighbor, error) {
+	i := t.search(key)
+	if i == len(t.keys) || !bytes.Equal(t.keys[i], key) {
+		return nil, ErrNotMember
+	}
+	return t.neighbor(i), nil
+}
+
+// Check that key is a leaf of the sorted tree root of size n
+func VerifyMember(newHash HashFunc, root hashid.HashId, n int, key hashid.HashId, nb *Neighbor) bool {
+	return nb != nil && bytes.Equal(nb.Key, key) &&
+		VerifyInclusion(newHash, nb.Index, n, nb.Key, nb.Prf, root)
+}
+
+func (nb *Neighbor) MarshalBinary() ([]byte, error) {
+	var b bytes.Buffer
+	putNeighbor(&b, nb, nil)
+	return b.Bytes(), nil
+}
+
+func (nb *Neighbor) UnmarshalBinary(data []byte) error {
+	dec, err := getNeighbor(bytes.NewBuffer(data), nil)
+	if err != nil {
+		return err
+	}
+	*nb = *dec
+	return nil
+}
+
+// Proof that a key is not in a sorted tree
+type AbsenceProof struct {
+	Size  int       // number of keys in the tree
+	Lower *Neighbor // greatest key lower than the key, nil if none
+	Upper *Neighbor // least key higher than the key, nil if none
+}
+
+// Proof that key is not in the tree
+func (t *SortedTree) Absence(key hashid.HashId) (*AbsenceProof, error) {
+	i := t.search(key)
+	if i < len(t.keys) && bytes.Equal(t.keys[i], key) {
+		return nil, ErrMember
+	}
+	ap := &AbsenceProof{Size: len(t.keys)}
+	if i > 0 {
+		ap.Lower = t.neighbor(i - 1)
+	}
+	if i < len(t.keys) {
+		ap.Upper = t.neighbor(i)
+	}
+	return ap, nil
+}
+
+// Check that key is not in the sorted tree root
+func (ap *AbsenceProof) Verify(newHash HashFunc, root, key hashid.HashId) bool {
+	n, lo, hi := ap.Size, ap.Lower, ap.Upper
+	if n == 0 {
+		return lo == nil && hi == nil && equal(root, newHash().Sum(nil))
+	}
+	if lo == nil && hi == nil {
+		return false
+	}
+	if lo != nil {
+		if bytes.Compare(lo.Key, key) >= 0 ||
+			!VerifyInclusion(newHash, lo.Index, n, lo.Key, lo.Prf, root) {
+			return false
+		}
+		if hi == nil && lo.Index != n-1 {
+			return false
+		}
+	}
+	if hi != nil {
+		if bytes.Compare(hi.Key, key) <= 0 ||
+			!VerifyInclusion(newHash, hi.Index, n, hi.Key, hi.Prf, root) {
+			return false
+		}
+		if lo == nil && hi.Index != 0 || lo != nil && lo.Index+1 != hi.Index {
+			return false
+		}
+	}
+	return true
+}
+
+// Encoding: the size, then each neighbor present as its index, key and
+// path; the upper path leaves out the siblings it shares with the lower
+// one, which end both paths
+func (ap *AbsenceProof) MarshalBinary() ([]byte, error) {
+	var b bytes.Buffer
+	putUvarint(&b, uint64(ap.Size))
+	var flags byte
+	if ap.Lower != nil {
+		flags |= 1
+	}
+	if ap.Upper != nil {
+		flags |= 2
+	}
+	b.WriteByte(flags)
+	var shared Proof
+	if ap.Lower != nil {
+		putNeighbor(&b, ap.Lower, nil)
+		shared = ap.Lower.Prf
+	}
+	if ap.Upper != nil {
+		putNeighbor(&b, ap.Upper, shared)
+	}
+	return b.Bytes(), nil
+}
+
+func (ap *AbsenceProof) UnmarshalBinary(data []byte) error {
+	b := bytes.NewBuffer(data)
+	size, err := binary.ReadUvarint(b)
+	if err != nil {
+		return ErrBadProof
+	}
+	flags, err := b.ReadByte()
+	if err != nil {
+		return ErrBadProof
+	}
+	ap.Size, ap.Lower, ap.Upper = int(size), nil, nil
+	var shared Proof
+	if flags&1 != 0 {
+		if ap.Lower, err = getNeighbor(b, nil); err != nil {
+			return err
+		}
+		shared = ap.Lower.Prf
+	}
+	if flags&2 != 0 {
+		if ap.Upper, err = getNeighbor(b, shared); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func putUvarint(b *bytes.Buffer, x uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	b.Write(buf[:binary.PutUvarint(buf[:], x)])
+}
+
+func putBytes(b *bytes.Buffer, data []byte) {
+	putUvarint(b, uint64(len(data)))
+	b.Write(data)
+}
+
+func getBytes(b *bytes.Buffer) ([]byte, error) {
+	n, err := binary.ReadUvarint(b)
+	if err != nil || n > uint64(b.Len()) {
+		return nil, ErrBadProof
+	}
+	return append([]byte(nil), b.Next(int(n))...), nil
+}
+
+// Number of hashes ending both paths
+func sharedSuffix(p, q Proof) int {
+	k := 0
+	for k < len(p) && k < len(q) && bytes.Equal(p[len(p)-1-k], q[len(q)-1-k]) {
+		k++
+	}
+	return k
+}
+
+// Write nb, leaving out the end of its path shared with the path prev
+func putNeighbor(b *bytes.Buffer, nb *Neighbor, prev Proof) {
+	putUvarint(b, uint64(nb.Index))
+	putBytes(b, nb.Key)
+	k := sharedSuffix(nb.Prf, prev)
+	putUvarint(b, uint64(len(nb.Prf)-k))
+	putUvarint(b, uint64(k))
+	for _, h := range nb.Prf[:len(nb.Prf)-k] {
+		putBytes(b, h)
+	}
+}
+
+func getNeighbor(b *bytes.Buffer, prev Proof) (*Neighbor, error) {
+	index, err := binary.ReadUvarint(b)
+	if err != nil {
+		return nil, ErrBadProof
+	}
+	nb := &Neighbor{Index: int(index)}
+	if nb.Key, err = getBytes(b); err != nil {
+		return nil, err
+	}
+	own, err := binary.ReadUvarint(b)
+	if err != nil {
+		return nil, ErrBadProof
+	}
+	k, err := binary.ReadUvarint(b)
+	if err != nil || k > uint64(len(prev)) || own > uint64(b.Len()) {
+		return nil, ErrBadProof
+	}
+	for i := uint64(0); i < own; i++ {
+		h, err := getBytes(b)
+		if err != nil {
+			return nil, err
+		}
+		nb.Prf = append(nb.Prf, hashid.HashId(h))
+	}
+	nb.Prf = append(nb.Prf, prev[len(prev)-int(k):]...)
+	return nb, nil
+}
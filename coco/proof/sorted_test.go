@@ -0,0 +1,81 @@
+package proof
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/dedis/prifi/coco/hashid"
+)
+
+func testKey(i int) hashid.HashId {
+	h := sha256.Sum256([]byte{byte(i), byte(i >> 8)})
+	return h[:]
+}
+
+// Every key of a sorted tree is proven present, every other key absent,
+// and proofs survive their encoding
+func TestSortedTree(t *testing.T) {
+	newHash := sha256.New
+	for n := 0; n <= 20; n++ {
+		var keys []hashid.HashId
+		for i := 0; i < n; i++ {
+			keys = append(keys, testKey(i))
+		}
+		tree := NewSortedTree(newHash, append(keys, keys...))
+		if tree.Size() != n {
+			t.Fatal("duplicate keys kept:", tree.Size(), "keys for", n)
+		}
+		root := tree.Root()
+
+		for i := 0; i < n; i++ {
+			nb, err := tree.Inclusion(keys[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, _ := nb.MarshalBinary()
+			dec := &Neighbor{}
+			if err := dec.UnmarshalBinary(b); err != nil {
+				t.Fatal(err)
+			}
+			if !VerifyMember(newHash, root, n, keys[i], dec) {
+				t.Fatal("key", i, "not in the tree of", n)
+			}
+			if _, err := tree.Absence(keys[i]); err != ErrMember {
+				t.Fatal("absence proof of key", i)
+			}
+		}
+
+		for i := n; i < n+20; i++ {
+			key := testKey(i)
+			if _, err := tree.Inclusion(key); err != ErrNotMember {
+				t.Fatal("inclusion proof of absent key", i)
+			}
+			ap, err := tree.Absence(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, _ := ap.MarshalBinary()
+			dec := &AbsenceProof{}
+			if err := dec.UnmarshalBinary(b); err != nil {
+				t.Fatal(err)
+			}
+			if !dec.Verify(newHash, root, key) {
+				t.Fatal("key", i, "not proven absent from the tree of", n)
+			}
+			if n > 0 && dec.Verify(newHash, root, keys[0]) {
+				t.Fatal("present key proven absent")
+			}
+		}
+
+		// two neighbors that are not adjacent prove nothing
+		if n >= 3 {
+			lo, _ := tree.Inclusion(tree.keys[0])
+			hi, _ := tree.Inclusion(tree.keys[2])
+			key := append(hashid.HashId(nil), tree.keys[1]...)
+			ap := &AbsenceProof{Size: n, Lower: lo, Upper: hi}
+			if ap.Verify(newHash, root, key) {
+				t.Fatal("absence proven across a leaf")
+			}
+		}
+	}
+}
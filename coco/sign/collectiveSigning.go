@@ -5,6 +5,7 @@ import (
 	"io"
 	"strconv"
 	"sync/atomic"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"golang.org/x/net/context"
@@ -34,7 +35,15 @@ func (sn *Node) get() error {
 	sn.heartbeat = time.NewTimer(500 * time.Second)
 	sn.hbLock.Unlock() */
 
+	// start from the snapshot of our vote log kept on disk
+	if s := sn.VoteLog.Snap; s != nil && int64(s.LastVote) > atomic.LoadInt64(&sn.LastAppliedVote) {
+		sn.restoreSnapshot(s)
+	}
+
 	// as votes get approved they are streamed in ApplyVotes
+	sn.VoteLog.mu.Lock()
+	sn.replayedVote = sn.VoteLog.Last
+	sn.VoteLog.mu.Unlock()
 	voteChan := sn.VoteLog.Stream()
 	sn.ApplyVotes(voteChan)
 
@@ -50,9 +59,13 @@ func (sn *Node) get() error {
 			nm, ok := <-msgchan
 			err := nm.Err
 
-			// TODO: graceful shutdown voting
 			if !ok || err == coconet.ErrClosed || err == io.EOF {
+				// children close their connections on a voted shutdown
+				if ok && sn.ShuttingDown() {
+					continue
+				}
 				log.Errorf("getting from closed host")
+				sn.setExitStatus(ExitFailure)
 				sn.Close()
 				return coconet.ErrClosed
 			}
@@ -66,13 +79,14 @@ func (sn *Node) get() error {
 			//log.Printf("got message: %#v with error %v\n", sm, err)
 			sm := nm.Data.(*SigningMessage)
 			sm.From = nm.From
+			sn.heardFrom(sm.From)
 			// log.Println(sn.Name(), "received message: ", sm.Type)
 
 			// don't act on future view if not caught up, must be done after updating vote index
 			sn.viewmu.Lock()
 			if sm.View > sn.ViewNo {
 				if atomic.LoadInt64(&sn.LastSeenVote) != atomic.LoadInt64(&sn.LastAppliedVote) {
-					log.Warnln("not caught up for view change", sn.LastSeenVote, sn.LastAppliedVote)
+					log.Warnln("not caught up for view change", atomic.LoadInt64(&sn.LastSeenVote), atomic.LoadInt64(&sn.LastAppliedVote))
 					return errors.New("not caught up for view change")
 				}
 			}
@@ -115,6 +129,9 @@ func (sn *Node) get() error {
 				} else {
 					err = sn.Challenge(sm.View, sm.Chm)
 				}
+				if err == ErrRoundEvicted {
+					sn.replyEvicted(sm.View, sm.From, sm.Chm.Round)
+				}
 				if err != nil {
 					log.Errorln(sn.Name(), "challenge error:", err)
 				}
@@ -132,6 +149,9 @@ func (sn *Node) get() error {
 				} else {
 					err = sn.Commit(sm.View, sm.Com.Round, sm)
 				}
+				if err == ErrRoundEvicted {
+					sn.replyEvicted(sm.View, sm.From, sm.Com.Round)
+				}
 				if err != nil {
 					log.Errorln(sn.Name(), "commit error:", err)
 				}
@@ -148,28 +168,28 @@ func (sn *Node) get() error {
 				} else {
 					err = sn.Respond(sm.View, sm.Rm.Round, sm)
 				}
+				if err == ErrRoundEvicted {
+					sn.replyEvicted(sm.View, sm.From, sm.Rm.Round)
+				}
 				if err != nil {
 					log.Errorln(sn.Name(), "response error:", err)
 				}
 			case CatchUpReq:
-				v := sn.VoteLog.Get(sm.Cureq.Index)
-				ctx := context.TODO()
-				sn.PutTo(ctx, sm.From,
-					&SigningMessage{
-						From:         sn.Name(),
-						Type:         CatchUpResp,
-						LastSeenVote: int(atomic.LoadInt64(&sn.LastSeenVote)),
-						Curesp:       &CatchUpResponse{Vote: v}})
+				sn.serveCatchUp(sm.From, sm.Cureq)
 			case CatchUpResp:
-				if sm.Curesp.Vote == nil || sn.VoteLog.Get(sm.Curesp.Vote.Index) != nil {
+				sn.handleCatchUp(sm.From, sm.Curesp)
+			case GroupChange:
+				if sm.Vrm == nil || sm.Vrm.Vote == nil {
+					log.Errorln(sn.Name(), "received group change without vote from", sm.From)
+					continue
+				}
+				// requested view changes are started by the root of the new view
+				if sm.Vrm.Vote.Type == ViewChangeVT && sm.Vrm.Vote.Vcv != nil {
+					if err := sn.handleViewChangeRequest(sm.From, sm.Vrm); err != nil {
+						log.Errorln(sn.Name(), "requested view change:", err)
+					}
 					continue
 				}
-				vi := sm.Curesp.Vote.Index
-				// put in votelog to be streamed and applied
-				sn.VoteLog.Put(vi, sm.Curesp.Vote)
-				// continue catching up
-				sn.CatchUp(vi+1, sm.From)
-			case GroupChange:
 				if sm.View == -1 {
 					sm.View = sn.ViewNo
 					if sm.Vrm.Vote.Type == AddVT {
@@ -196,7 +216,37 @@ func (sn *Node) get() error {
 					log.Errorln(sn.Name(), "received GroupChanged for unacceptable action")
 				}
 			case Error:
-				log.Println("Received Error Message:", ErrUnknownMessageType, sm, sm.Err)
+				if sm.Err == nil {
+					log.Errorln(sn.Name(), "error message with no error from", sm.From)
+					continue
+				}
+				log.Errorln(sn.Name(), "received error from", sm.From, ":", sm.Err.Err)
+			case Complaint:
+				sn.handleComplaint(sm.From, sm.Cm)
+			case ResponseAck:
+				if !sn.IsParent(sm.View, sm.From) {
+					log.Errorln(sn.Name(), "received response receipt from non-parent on view", sm.View)
+					continue
+				}
+				sn.keepResponseReceipt(sm.View, sm.Ra)
+			case Closing:
+				sn.childClosing(sm.From)
+			case Ping:
+				sn.handlePing(sm.From, sm.Lm)
+			case Pong:
+				sn.handlePong(sm.From, sm.Lm)
+			case KeyGen:
+				if !sn.IsParent(sm.View, sm.From) {
+					log.Errorln(sn.Name(), "received key generation from non-parent on view", sm.View)
+					continue
+				}
+				sn.keyGenPhase(sm.View, sm.Kgm)
+			case KeyGenReply:
+				if !sn.IsChild(sm.View, sm.From) {
+					log.Errorln(sn.Name(), "received key generation reply from non-child on view", sm.View)
+					continue
+				}
+				sn.keyGenReply(sm.View, sm.Kgm)
 			}
 		}
 	}
@@ -214,6 +264,17 @@ func (sn *Node) Announce(view int, am *AnnouncementMessage) error {
 		return err
 	}
 
+	// the root tells everyone who was excepted from its last round
+	if sn.IsRoot(view) {
+		am.Exceptions = sn.announcedExceptions()
+		am.Prev = sn.historyHead()
+	} else {
+		if err := sn.addRecord(view, am.Prev); err != nil {
+			log.Warnln(sn.Name(), "rejecting announced round record:", err)
+		}
+		go sn.checkExcluded(am.Exceptions)
+	}
+
 	// Inform all children of announcement
 	messgs := make([]coconet.BinaryMarshaler, sn.NChildren(view))
 	for i := range messgs {
@@ -243,10 +304,10 @@ func (sn *Node) Commit(view, Round int, sm *SigningMessage) error {
 	sn.LastSeenRound = max(sn.LastSeenRound, Round)
 	sn.roundmu.Unlock()
 
-	round := sn.Rounds[Round]
-	if round == nil {
+	round, err := sn.lookupRound(Round)
+	if err != nil || round == nil {
 		// was not announced of this round, should retreat
-		return nil
+		return err
 	}
 
 	if sm != nil {
@@ -261,6 +322,7 @@ func (sn *Node) Commit(view, Round int, sm *SigningMessage) error {
 	round.ExceptionList = make([]abstract.Point, 0)
 	round.ChildV_hat = make(map[string]abstract.Point, len(sn.Children(view)))
 	round.ChildX_hat = make(map[string]abstract.Point, len(sn.Children(view)))
+	round.ChildKeys = make(map[string][]abstract.Point, len(sn.Children(view)))
 	children := sn.Children(view)
 
 	// Commits from children are the first Merkle Tree leaves for the round
@@ -273,29 +335,55 @@ func (sn *Node) Commit(view, Round int, sm *SigningMessage) error {
 	}
 
 	// TODO: fill in missing commit messages, and add back exception code
+	aggregates := make(map[string][]byte)
 	for _, sm := range round.Commits {
 		from := sm.From
+		keys := sn.subtreeKeys(sm, children[from].PubKey())
+
+		// commits we can not hold the child to are left out with its subtree
+		if err := sn.checkCommitAck(view, Round, round, sm, children[from].PubKey()); err != nil {
+			log.Warnln(sn.Name(), "leaving out commit of", from, ":", err)
+			round.ExceptionList = addExceptions(round.ExceptionList, keys...)
+			round.ExceptionList = addExceptions(round.ExceptionList, sm.Com.ExceptionList...)
+			continue
+		}
 
 		round.Leaves = append(round.Leaves, sm.Com.MTRoot)
 		round.LeavesFrom = append(round.LeavesFrom, from)
+		aggregates[from] = sm.Com.Aggregate
+		if err := sn.addRecord(view, sm.Com.Head); err != nil {
+			log.Warnln(sn.Name(), "rejecting round record of", from, ":", err)
+		}
 		round.ChildV_hat[from] = sm.Com.V_hat
 		round.ChildX_hat[from] = sm.Com.X_hat
-		round.ExceptionList = append(round.ExceptionList, sm.Com.ExceptionList...)
+		round.ChildKeys[from] = keys
+		round.Keys = append(round.Keys, keys...)
+		round.ExceptionList = addExceptions(round.ExceptionList, sm.Com.ExceptionList...)
+		round.Signers = append(round.Signers, sm.Com.Signers...)
 
 		// add good child server to combined public key, and point commit
 		sn.add(round.X_hat, sm.Com.X_hat)
 		sn.add(round.Log.V_hat, sm.Com.V_hat)
 	}
+	sn.combineAggregates(view, Round, round, aggregates)
 
 	if sn.Type == PubKey {
 		log.Println("sign.Node.Commit using PubKey")
 		return sn.actOnCommits(view, Round)
 	} else {
 		log.Println("sign.Node.Commit using Merkle")
-		sn.AddChildrenMerkleRoots(Round)
-		sn.AddLocalMerkleRoot(view, Round)
-		sn.HashLog(Round)
-		sn.ComputeCombinedMerkleRoot(view, Round)
+		if err := sn.AddChildrenMerkleRoots(Round); err != nil {
+			return err
+		}
+		if err := sn.AddLocalMerkleRoot(view, Round); err != nil {
+			return err
+		}
+		if err := sn.HashLog(Round); err != nil {
+			return err
+		}
+		if err := sn.ComputeCombinedMerkleRoot(view, Round); err != nil {
+			return err
+		}
 		return sn.actOnCommits(view, Round)
 	}
 }
@@ -303,8 +391,10 @@ func (sn *Node) Commit(view, Round int, sm *SigningMessage) error {
 // Finalize commits by initiating the challenge pahse if root
 // Send own commitment message up to parent if non-root
 func (sn *Node) actOnCommits(view, Round int) error {
-	round := sn.Rounds[Round]
-	var err error
+	round, err := sn.roundFor(Round)
+	if err != nil {
+		return err
+	}
 
 	if sn.IsRoot(view) {
 		sn.commitsDone <- Round
@@ -318,7 +408,13 @@ func (sn *Node) actOnCommits(view, Round int) error {
 			MTRoot:        round.MTRoot,
 			ExceptionList: round.ExceptionList,
 			Vote:          round.Vote,
-			Round:         Round}
+			Round:         Round,
+			Aggregate:     round.Aggregate,
+			Head:          sn.historyHead(),
+			Signers:       round.Signers,
+			Keys:          round.Keys}
+		ack := sn.ackCommit(view, Round, round)
+		com.Ack = &ack
 
 		// ctx, _ := context.WithTimeout(context.Background(), 2000*time.Millisecond)
 		log.Println(sn.Name(), "puts up commit")
@@ -339,13 +435,22 @@ func (sn *Node) Challenge(view int, chm *ChallengeMessage) error {
 	sn.LastSeenRound = max(sn.LastSeenRound, chm.Round)
 	sn.roundmu.Unlock()
 
-	round := sn.Rounds[chm.Round]
-	if round == nil {
-		return nil
+	round, err := sn.lookupRound(chm.Round)
+	if err != nil || round == nil {
+		return err
 	}
 
 	// register challenge
 	round.c = chm.C
+	round.BackLink = chm.BackLink
+	round.SignerSet = chm.Signers
+	sn.keepReceipt(view, round, chm.Receipt)
+	if !sn.IsRoot(view) {
+		if err := sn.checkAggregate(view, chm); err != nil {
+			log.Warnln(sn.Name(), "refusing to sign round", chm.Round, ":", err)
+			round.Refused = true
+		}
+	}
 
 	if sn.Type == PubKey {
 		log.Println(sn.Name(), "challenge: using pubkey", sn.Type, chm.Vote)
@@ -367,7 +472,7 @@ func (sn *Node) Challenge(view int, chm *ChallengeMessage) error {
 	}
 
 	// log.Println(sn.Name(), "In challenge before response")
-	sn.initResponseCrypto(chm.Round)
+	sn.initResponseCrypto(round)
 	if len(sn.Children(view)) == 0 {
 		sn.Respond(view, chm.Round, nil)
 	}
@@ -375,11 +480,14 @@ func (sn *Node) Challenge(view int, chm *ChallengeMessage) error {
 	return nil
 }
 
-func (sn *Node) initResponseCrypto(Round int) {
-	round := sn.Rounds[Round]
-	// generate response   r = v - xc
+func (sn *Node) initResponseCrypto(round *Round) {
+	// generate response   r = v - xc, or v if we refused to sign
 	round.r = sn.suite.Secret()
-	round.r.Mul(sn.PrivKey, round.c).Sub(round.Log.v, round.r)
+	if round.Refused {
+		round.r.Set(round.Log.v)
+	} else {
+		round.r.Mul(sn.signingKey(round), round.c).Sub(round.Log.v, round.r)
+	}
 	// initialize sum of children's responses
 	round.r_hat = round.r
 }
@@ -391,10 +499,10 @@ func (sn *Node) Respond(view, Round int, sm *SigningMessage) error {
 	sn.LastSeenRound = max(sn.LastSeenRound, Round)
 	sn.roundmu.Unlock()
 
-	round := sn.Rounds[Round]
-	if round == nil || round.Log.v == nil {
+	round, err := sn.lookupRound(Round)
+	if err != nil || round == nil || round.Log.v == nil {
 		// If I was not announced of this round, or I failed to commit
-		return nil
+		return err
 	}
 
 	if sm != nil {
@@ -405,13 +513,34 @@ func (sn *Node) Respond(view, Round int, sm *SigningMessage) error {
 	}
 
 	// initialize exception handling
+	// exceptions of the commit phase are kept, those of the subtrees that
+	// failed after committing are added to them
 	exceptionV_hat := sn.suite.Point().Null()
 	exceptionX_hat := sn.suite.Point().Null()
-	round.ExceptionList = make([]abstract.Point, 0)
+	excepted := make([]*ExceptedCommit, 0)
 	nullPoint := sn.suite.Point().Null()
 	allmessgs := sn.FillInWithDefaultMessages(view, round.Responses)
 
+	// a signer that refused to sign excepts its key, its commitment is
+	// covered by its response
+	if round.Refused {
+		round.ExceptionList = addExceptions(round.ExceptionList, sn.PubKey)
+		sn.add(exceptionX_hat, sn.PubKey)
+	}
+
 	children := sn.Children(view)
+	leaveOut := func(from string) {
+		if ack, ok := round.Acks[from]; ok {
+			log.Warnln(sn.Name(), "child", from, "committed but did not respond on round", Round)
+			excepted = append(excepted, sn.exceptCommit(view, from, children[from].PubKey(), ack))
+		}
+		round.ExceptionList = addExceptions(round.ExceptionList, children[from].PubKey())
+		round.ExceptionList = addExceptions(round.ExceptionList, round.ChildKeys[from]...)
+
+		// remove public keys and point commits from subtree of faild child
+		sn.add(exceptionX_hat, round.ChildX_hat[from])
+		sn.add(exceptionV_hat, round.ChildV_hat[from])
+	}
 	for _, sm := range allmessgs {
 		from := sm.From
 		switch sm.Type {
@@ -419,11 +548,7 @@ func (sn *Node) Respond(view, Round int, sm *SigningMessage) error {
 			// default == no response from child
 			// log.Println(sn.Name(), "default in respose for child", from, sm)
 			if children[from] != nil {
-				round.ExceptionList = append(round.ExceptionList, children[from].PubKey())
-
-				// remove public keys and point commits from subtree of faild child
-				sn.add(exceptionX_hat, round.ChildX_hat[from])
-				sn.add(exceptionV_hat, round.ChildV_hat[from])
+				leaveOut(from)
 			}
 			continue
 		case Response:
@@ -433,12 +558,24 @@ func (sn *Node) Respond(view, Round int, sm *SigningMessage) error {
 				continue
 			}
 
+			// commitments the child left out must be signed by its subtree
+			if err := verifyExceptedCommits(sn.suite, Round, round.ChildKeys[from], sm.Rm.ExceptionList,
+				sm.Rm.ExceptionV_hat, sm.Rm.ExceptedCommits); err != nil {
+				log.Warnln(sn.Name(), "leaving out response of", from, ":", err)
+				if children[from] != nil {
+					leaveOut(from)
+				}
+				continue
+			}
+
 			// log.Println(sn.Name(), "accepts response from", from, sm.Type)
 			round.r_hat.Add(round.r_hat, sm.Rm.R_hat)
 
 			sn.add(exceptionV_hat, sm.Rm.ExceptionV_hat)
 			sn.add(exceptionX_hat, sm.Rm.ExceptionX_hat)
-			round.ExceptionList = append(round.ExceptionList, sm.Rm.ExceptionList...)
+			round.ExceptionList = addExceptions(round.ExceptionList, sm.Rm.ExceptionList...)
+			excepted = append(excepted, sm.Rm.ExceptedCommits...)
+			sn.ackResponse(view, sm)
 
 		case Error:
 			if sm.Err == nil {
@@ -457,14 +594,28 @@ func (sn *Node) Respond(view, Round int, sm *SigningMessage) error {
 	// remove exceptions from subtree that failed
 	sn.sub(round.X_hat, exceptionX_hat)
 	round.exceptionV_hat = exceptionV_hat
+	round.ExceptedCommits = excepted
+
+	// threshold signatures are checked against the shares of the signers
+	if sn.Type == Threshold {
+		if err := sn.thresholdResponses(round, exceptionV_hat); err != nil {
+			if !sn.IsRoot(view) {
+				sn.PutUpError(view, err)
+			}
+			return err
+		}
+	}
 
 	return sn.actOnResponses(view, Round, exceptionV_hat, exceptionX_hat)
 }
 
 func (sn *Node) actOnResponses(view, Round int, exceptionV_hat abstract.Point, exceptionX_hat abstract.Point) error {
 	log.Println(sn.Name(), "got all responses for view, round", view, Round)
-	round := sn.Rounds[Round]
-	err := sn.VerifyResponses(view, Round)
+	round, err := sn.roundFor(Round)
+	if err != nil {
+		return err
+	}
+	err = sn.VerifyResponses(view, Round)
 
 	isroot := sn.IsRoot(view)
 	// if error put it up if parent exists
@@ -482,30 +633,49 @@ func (sn *Node) actOnResponses(view, Round int, exceptionV_hat abstract.Point, e
 
 		// create and putup own response message
 		rm := &ResponseMessage{
-			R_hat:          round.r_hat,
-			ExceptionList:  round.ExceptionList,
-			ExceptionV_hat: exceptionV_hat,
-			ExceptionX_hat: exceptionX_hat,
-			Round:          Round}
+			R_hat:           round.r_hat,
+			ExceptionList:   round.ExceptionList,
+			ExceptionV_hat:  exceptionV_hat,
+			ExceptionX_hat:  exceptionX_hat,
+			ExceptedCommits: round.ExceptedCommits,
+			Round:           Round}
 
 		// ctx, _ := context.WithTimeout(context.Background(), 2000*time.Millisecond)
 		ctx := context.TODO()
 		log.Println(sn.Name(), "put up response to", sn.Parent(view))
+		sent := time.Now()
 		err = sn.PutUp(ctx, view, &SigningMessage{
 			Type:         Response,
 			View:         view,
 			LastSeenVote: int(atomic.LoadInt64(&sn.LastSeenVote)),
 			Rm:           rm})
+		if err == nil && round.sent != nil {
+			round.sent.rm = rm
+			round.sent.at = sent
+		}
+	}
+
+	// the root announces the exceptions with the next round
+	if err == nil && isroot {
+		round.done = time.Now()
+		round.FinalExceptions = round.ExceptionList
+		sn.setLastExceptions(view, Round, round.ExceptionList)
 	}
 
 	if sn.TimeForViewChange() {
 		log.Println("acting on responses: trying viewchanges")
-		err := sn.TryViewChange(view + 1)
+		err := sn.TryViewChange(view+1, false)
 		if err != nil {
 			log.Errorln(err)
 		}
 	}
 
+	if err == nil && isroot {
+		sn.recordRound(view, Round)
+		sn.aggregateDone(view, Round)
+	}
+
+	sn.finishRound(Round)
 	// root reports round is done
 	if isroot {
 		sn.done <- Round
@@ -514,7 +684,8 @@ func (sn *Node) actOnResponses(view, Round int, exceptionV_hat abstract.Point, e
 	return err
 }
 
-func (sn *Node) TryViewChange(view int) error {
+// rootFailed is set when the view change is caused by the silence of the root
+func (sn *Node) TryViewChange(view int, rootFailed bool) error {
 	log.Println(sn.Name(), "TRY VIEW CHANGE on", view, "with last view", sn.ViewNo)
 	// should ideally be compare and swap
 	sn.viewmu.Lock()
@@ -529,17 +700,29 @@ func (sn *Node) TryViewChange(view int) error {
 	sn.ChangingView = true
 	sn.viewmu.Unlock()
 
+	// the failed root is skipped when selecting the root of the new view
+	failedRoot := ""
+	if rootFailed {
+		failedRoot = sn.RootFor(view - 1)
+		sn.suspectRoot(view-1, failedRoot)
+	}
+
 	// take action if new view root
 	if sn.Name() == sn.RootFor(view) {
 		log.Println(sn.Name(), "INITIATING VIEW CHANGE FOR VIEW:", view)
+		seed := sn.historyHead()
+		failed := sn.proposeFailedRoots(view, failedRoot)
 		go func() {
 			err := sn.StartVotingRound(
 				&Vote{
 					View: view,
 					Type: ViewChangeVT,
 					Vcv: &ViewChangeVote{
-						View: view,
-						Root: sn.Name()}})
+						View:        view,
+						Root:        sn.Name(),
+						SeedRecord:  seed,
+						FailedRoots: failed,
+						Topology:    sn.proposeTopology(view, sn.Name())}})
 			if err != nil {
 				log.Errorln(sn.Name(), "TRY VIEW CHANGE FAILED: ", err)
 			}
@@ -550,28 +733,42 @@ func (sn *Node) TryViewChange(view int) error {
 
 // Called *only* by root node after receiving all commits
 func (sn *Node) FinalizeCommits(view int, Round int) error {
-	round := sn.Rounds[Round]
-
-	// challenge = Hash(Merkle Tree Root/ Announcement Message, sn.Log.V_hat)
-	if sn.Type == PubKey {
-		round.c = hashElGamal(sn.suite, sn.LogTest, round.Log.V_hat)
-	} else {
-		round.c = hashElGamal(sn.suite, round.MTRoot, round.Log.V_hat)
+	round, err := sn.roundFor(Round)
+	if err != nil {
+		return err
+	}
+	if sn.Type == Threshold {
+		if err := sn.checkSigners(round); err != nil {
+			return err
+		}
+	}
+	if err := sn.SetAccountableRound(Round); err != nil {
+		return err
 	}
 
+	// challenge = Hash(Merkle Tree Root/ Announcement Message, back link, aggregate, sn.Log.V_hat)
+	round.c = hashElGamal(sn.suite, sn.challengeMessage(Round, round), round.Log.V_hat)
+
 	proof := make([]hashid.HashId, 0)
-	err := sn.Challenge(view, &ChallengeMessage{
-		C:      round.c,
-		MTRoot: round.MTRoot,
-		Proof:  proof,
-		Round:  Round,
-		Vote:   round.Vote})
+	err = sn.Challenge(view, &ChallengeMessage{
+		C:         round.c,
+		MTRoot:    round.MTRoot,
+		Proof:     proof,
+		Round:     Round,
+		Vote:      round.Vote,
+		BackLink:  round.BackLink,
+		Signers:   round.Signers,
+		Aggregate: round.Aggregate,
+		V_hat:     round.Log.V_hat})
 	return err
 }
 
 // Called by every node after receiving aggregate responses from descendants
 func (sn *Node) VerifyResponses(view, Round int) error {
-	round := sn.Rounds[Round]
+	round, err := sn.roundFor(Round)
+	if err != nil {
+		return err
+	}
 
 	// Check that: base**r_hat * X_hat**c == V_hat
 	// Equivalent to base**(r+xc) == base**(v) == T in vanillaElGamal
@@ -588,13 +785,9 @@ func (sn *Node) VerifyResponses(view, Round int) error {
 	if isroot {
 		// round challenge must be recomputed given potential
 		// exception list
-		if sn.Type == PubKey {
-			round.c = hashElGamal(sn.suite, sn.LogTest, round.Log.V_hat)
-			c2 = hashElGamal(sn.suite, sn.LogTest, T)
-		} else {
-			round.c = hashElGamal(sn.suite, round.MTRoot, round.Log.V_hat)
-			c2 = hashElGamal(sn.suite, round.MTRoot, T)
-		}
+		m := sn.challengeMessage(Round, round)
+		round.c = hashElGamal(sn.suite, m, round.Log.V_hat)
+		c2 = hashElGamal(sn.suite, m, T)
 	}
 
 	// intermediary nodes check partial responses aginst their partial keys
@@ -650,16 +843,16 @@ func hashElGamal(suite abstract.Suite, message []byte, p abstract.Point) abstrac
 
 // Called when log for round if full and ready to be hashed
 func (sn *Node) HashLog(Round int) error {
-	round := sn.Rounds[Round]
-	var err error
-	round.HashedLog, err = sn.hashLog(Round)
+	round, err := sn.roundFor(Round)
+	if err != nil {
+		return err
+	}
+	round.HashedLog, err = sn.hashLog(round)
 	return err
 }
 
 // Auxilary function to perform the actual hashing of the log
-func (sn *Node) hashLog(Round int) ([]byte, error) {
-	round := sn.Rounds[Round]
-
+func (sn *Node) hashLog(round *Round) ([]byte, error) {
 	h := sn.suite.Hash()
 	logBytes, err := round.Log.MarshalBinary()
 	if err != nil {
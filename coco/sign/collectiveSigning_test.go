@@ -85,7 +85,10 @@ func runStaticTest(signType sign.Type, RoundsPerView int, faultyNodes ...int) er
 	// Create Signing Nodes out of the hosts
 	nodes := make([]*sign.Node, nNodes)
 	for i := 0; i < nNodes; i++ {
-		nodes[i] = sign.NewNode(h[i], suite, rand)
+		var err error
+		if nodes[i], err = sign.NewNode(h[i], suite, rand, nil); err != nil {
+			return err
+		}
 		nodes[i].Type = signType
 		nodes[i].GenSetPool()
 		nodes[i].RoundsPerView = RoundsPerView
@@ -94,7 +97,7 @@ func runStaticTest(signType sign.Type, RoundsPerView int, faultyNodes ...int) er
 		h[i].SetPubKey(nodes[i].PubKey)
 		// To test the already keyed signing node, uncomment
 		// PrivKey := suite.Secret().Pick(rand)
-		// nodes[i] = NewKeyedNode(h[i], suite, PrivKey)
+		// nodes[i] = NewKeyedNode(h[i], suite, PrivKey, nil)
 	}
 	nodes[0].Height = 2
 	nodes[1].Height = 1
@@ -0,0 +1,223 @@
+package sign
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Config holds the per-node parameters of a signing node.
+// Every node gets its own copy, so groups with different timings
+// can run side by side in one process.
+type Config struct {
+	Type Type // signature type produced by the node
+
+	RoundTime  time.Duration // time between rounds started by the root
+	Heartbeat  time.Duration // silence from the parent before trying a view change
+	GossipTime time.Duration // interval between catch up requests to random peers
+	Timeout    time.Duration // base timeout, scaled by the height of the node
+
+	RoundsPerView  int  // rounds run before a regular view change
+	RoundsInMemory int  // rounds kept in memory, older ones are evicted
+	Debug          bool // verify all paths and signatures
+
+	DataDir string // directory of the vote log, empty keeps it in memory
+
+	// children per node of the trees built from measured latencies
+	// at view changes, 0 keeps the tree of the previous view
+	BranchingFactor int
+
+	// hosts needed for a signature in Threshold mode, 0 for a majority
+	Threshold int
+
+	// hosts that must sign a round for its record to be accepted,
+	// 0 for a majority
+	MinSigners int
+
+	// largest offset of a clock from the one of the root before the
+	// node is flagged, 0 for no bound
+	MaxDrift time.Duration
+}
+
+// Returns a Config filled in with the default values
+func DefaultConfig() *Config {
+	c := &Config{}
+	c.SetDefaults()
+	return c
+}
+
+// Fill in defaults for every field left unset
+func (c *Config) SetDefaults() {
+	if c.RoundTime == 0 {
+		c.RoundTime = DefaultRoundTime
+	}
+	if c.Heartbeat == 0 {
+		c.Heartbeat = c.scaled(DefaultHeartbeat)
+	}
+	if c.GossipTime == 0 {
+		c.GossipTime = c.scaled(DefaultGossipTime)
+	}
+	if c.Timeout == 0 {
+		c.Timeout = DefaultTimeout
+	}
+	if c.RoundsPerView == 0 {
+		c.RoundsPerView = DefaultRoundsPerView
+	}
+	if c.RoundsInMemory == 0 {
+		c.RoundsInMemory = DefaultRoundsInMemory
+	}
+}
+
+// Default duration d, scaled from DefaultRoundTime to the round time of
+// the Config
+func (c *Config) scaled(d time.Duration) time.Duration {
+	return c.RoundTime * (d / time.Millisecond) / (DefaultRoundTime / time.Millisecond)
+}
+
+// Check that the values of the Config can be used by a signing node
+func (c *Config) Validate() error {
+	switch c.Type {
+	case MerkleTree, PubKey, Voter, Threshold:
+	default:
+		return errors.New("unknown signature type in config")
+	}
+	if c.RoundTime <= 0 || c.Heartbeat <= 0 || c.GossipTime <= 0 || c.Timeout <= 0 {
+		return errors.New("config durations must be positive")
+	}
+	// a heartbeat shorter than a round would make every child
+	// try to change views between two consecutive announcements
+	if c.Heartbeat < c.RoundTime {
+		return errors.New("config heartbeat must not be shorter than round time")
+	}
+	if c.RoundsPerView <= 0 {
+		return errors.New("config rounds per view must be positive")
+	}
+	// the previous round is needed to compute back links
+	if c.RoundsInMemory < 2 {
+		return errors.New("config must keep at least 2 rounds in memory")
+	}
+	if c.BranchingFactor < 0 {
+		return errors.New("config branching factor must not be negative")
+	}
+	if c.Threshold < 0 {
+		return errors.New("config threshold must not be negative")
+	}
+	if c.MinSigners < 0 {
+		return errors.New("config min signers must not be negative")
+	}
+	if c.MaxDrift < 0 {
+		return errors.New("config max drift must not be negative")
+	}
+	return nil
+}
+
+// Returns a copy of the Config, so nodes do not share settings
+func (c *Config) Copy() *Config {
+	cc := *c
+	return &cc
+}
+
+var typeNames = map[Type]string{
+	MerkleTree: "merkle",
+	PubKey:     "pubkey",
+	Voter:      "voter",
+	Threshold:  "threshold",
+}
+
+func (t Type) String() string {
+	if s, ok := typeNames[t]; ok {
+		return s
+	}
+	return ""
+}
+
+// Config as it appears in json roster files
+// durations are strings understood by time.ParseDuration, ex: "1500ms"
+type configJSON struct {
+	Type            string `json:"type,omitempty"`
+	RoundTime       string `json:"round_time,omitempty"`
+	Heartbeat       string `json:"heartbeat,omitempty"`
+	GossipTime      string `json:"gossip_time,omitempty"`
+	Timeout         string `json:"timeout,omitempty"`
+	RoundsPerView   int    `json:"rounds_per_view,omitempty"`
+	RoundsInMemory  int    `json:"rounds_in_memory,omitempty"`
+	Debug           bool   `json:"debug,omitempty"`
+	DataDir         string `json:"data_dir,omitempty"`
+	BranchingFactor int    `json:"branching_factor,omitempty"`
+	Threshold       int    `json:"threshold,omitempty"`
+	MinSigners      int    `json:"min_signers,omitempty"`
+	MaxDrift        string `json:"max_drift,omitempty"`
+}
+
+func (c *Config) MarshalJSON() ([]byte, error) {
+	var maxDrift string
+	if c.MaxDrift != 0 {
+		maxDrift = c.MaxDrift.String()
+	}
+	return json.Marshal(configJSON{
+		Type:            c.Type.String(),
+		RoundTime:       c.RoundTime.String(),
+		Heartbeat:       c.Heartbeat.String(),
+		GossipTime:      c.GossipTime.String(),
+		Timeout:         c.Timeout.String(),
+		RoundsPerView:   c.RoundsPerView,
+		RoundsInMemory:  c.RoundsInMemory,
+		Debug:           c.Debug,
+		DataDir:         c.DataDir,
+		BranchingFactor: c.BranchingFactor,
+		Threshold:       c.Threshold,
+		MinSigners:      c.MinSigners,
+		MaxDrift:        maxDrift})
+}
+
+func (c *Config) UnmarshalJSON(data []byte) error {
+	var cj configJSON
+	if err := json.Unmarshal(data, &cj); err != nil {
+		return err
+	}
+
+	c.Type = MerkleTree
+	if cj.Type != "" {
+		found := false
+		for t, name := range typeNames {
+			if name == cj.Type {
+				c.Type = t
+				found = true
+			}
+		}
+		if !found {
+			return errors.New("unknown signature type in config: " + cj.Type)
+		}
+	}
+
+	durations := []struct {
+		s string
+		d *time.Duration
+	}{
+		{cj.RoundTime, &c.RoundTime},
+		{cj.Heartbeat, &c.Heartbeat},
+		{cj.GossipTime, &c.GossipTime},
+		{cj.Timeout, &c.Timeout},
+		{cj.MaxDrift, &c.MaxDrift},
+	}
+	for _, dur := range durations {
+		if dur.s == "" {
+			continue
+		}
+		d, err := time.ParseDuration(dur.s)
+		if err != nil {
+			return err
+		}
+		*dur.d = d
+	}
+
+	c.RoundsPerView = cj.RoundsPerView
+	c.RoundsInMemory = cj.RoundsInMemory
+	c.Debug = cj.Debug
+	c.DataDir = cj.DataDir
+	c.BranchingFactor = cj.BranchingFactor
+	c.Threshold = cj.Threshold
+	c.MinSigners = cj.MinSigners
+	c.SetDefaults()
+	return c.Validate()
+}
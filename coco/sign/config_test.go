@@ -0,0 +1,70 @@
+package sign_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/dedis/prifi/coco/sign"
+)
+
+func TestConfigDefaults(t *testing.T) {
+	c := sign.DefaultConfig()
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if c.RoundTime != sign.DefaultRoundTime || c.Heartbeat != sign.DefaultHeartbeat ||
+		c.GossipTime != sign.DefaultGossipTime || c.RoundsPerView != sign.DefaultRoundsPerView {
+		t.Fatal("unexpected default config", c)
+	}
+
+	// heartbeat and gossip follow a non default round time
+	c = &sign.Config{RoundTime: 2 * time.Second}
+	c.SetDefaults()
+	if c.Heartbeat != 3*time.Second || c.GossipTime != 6*time.Second {
+		t.Fatal("defaults do not follow round time", c)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	c := sign.DefaultConfig()
+	c.Heartbeat = c.RoundTime / 2
+	if c.Validate() == nil {
+		t.Fatal("heartbeat shorter than round time accepted")
+	}
+
+	c = sign.DefaultConfig()
+	c.Type = sign.Type(42)
+	if c.Validate() == nil {
+		t.Fatal("unknown signature type accepted")
+	}
+}
+
+func TestConfigJSON(t *testing.T) {
+	data := []byte(`{"type": "pubkey", "round_time": "500ms", "rounds_per_view": 5, "min_signers": 3, "max_drift": "2s"}`)
+	c := &sign.Config{}
+	if err := json.Unmarshal(data, c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Type != sign.PubKey || c.RoundTime != 500*time.Millisecond ||
+		c.Heartbeat != 750*time.Millisecond || c.RoundsPerView != 5 ||
+		c.MinSigners != 3 || c.MaxDrift != 2*time.Second {
+		t.Fatal("unexpected config from json", c)
+	}
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2 := &sign.Config{}
+	if err := json.Unmarshal(b, c2); err != nil {
+		t.Fatal(err)
+	}
+	if *c != *c2 {
+		t.Fatal("config changed after json round trip", c, c2)
+	}
+
+	if json.Unmarshal([]byte(`{"round_time": "soon"}`), &sign.Config{}) == nil {
+		t.Fatal("bad duration accepted")
+	}
+}
@@ -21,21 +21,30 @@ func (sn *Node) SetupProposal(view int, am *AnnouncementMessage, from string) er
 		if atomic.LoadInt64(&sn.LastSeenVote) != atomic.LoadInt64(&sn.LastAppliedVote) {
 			return errors.New("not up to date: need to catch up")
 		}
-		if sn.RootFor(am.Vote.Vcv.View) != am.Vote.Vcv.Root {
-			return errors.New("invalid root for proposed view")
+		if err := sn.VerifyRoot(am.Vote.Vcv); err != nil {
+			return err
 		}
 
 		nextview := sn.ViewNo + 1
 		for ; nextview <= view; nextview++ {
 			// log.Println(sn.Name(), "CREATING NEXT VIEW", nextview)
 			sn.NewViewFromPrev(nextview, from)
-			for _, act := range sn.Actions[nextview] {
+			acts := sn.ActionsOn(nextview)
+			for _, act := range acts {
 				sn.ApplyAction(nextview, act)
 			}
-			for _, act := range sn.Actions[nextview] {
+			for _, act := range acts {
 				sn.NotifyOfAction(nextview, act)
 			}
 		}
+		if t := am.Vote.Vcv.Topology; t != nil {
+			if err := t.Validate(am.Vote.Vcv.Root, sn.HostListOn(view), sn.config.BranchingFactor); err != nil {
+				return err
+			}
+			if err := sn.applyTopology(view, from, t); err != nil {
+				return err
+			}
+		}
 		// fmt.Fprintln(os.Stderr, sn.Name(), "setuppropose:", sn.HostListOn(view))
 		// fmt.Fprintln(os.Stderr, sn.Name(), "setuppropose:", sn.Parent(view))
 	} else {
@@ -70,7 +79,6 @@ func (sn *Node) Propose(view int, am *AnnouncementMessage, from string) error {
 		return err
 	}
 	// log.Println(sn.Name(), "propose on view", view, sn.HostListOn(view))
-	sn.Rounds[am.Round].Vote = am.Vote
 
 	// Inform all children of proposal
 	messgs := make([]coconet.BinaryMarshaler, sn.NChildren(view))
@@ -102,10 +110,10 @@ func (sn *Node) Promise(view, Round int, sm *SigningMessage) error {
 	sn.LastSeenRound = max(sn.LastSeenRound, Round)
 	sn.roundmu.Unlock()
 
-	round := sn.Rounds[Round]
-	if round == nil {
+	round, err := sn.lookupRound(Round)
+	if err != nil || round == nil {
 		// was not announced of this round, should retreat
-		return nil
+		return err
 	}
 	if sm != nil {
 		round.Commits = append(round.Commits, sm)
@@ -116,7 +124,7 @@ func (sn *Node) Promise(view, Round int, sm *SigningMessage) error {
 	}
 
 	// cast own vote
-	sn.AddVotes(Round, round.Vote)
+	sn.AddVotes(round, round.Vote)
 
 	for _, sm := range round.Commits {
 		// count children votes
@@ -130,14 +138,18 @@ func (sn *Node) Promise(view, Round int, sm *SigningMessage) error {
 }
 
 func (sn *Node) actOnPromises(view, Round int) error {
-	round := sn.Rounds[Round]
-	var err error
+	round, err := sn.roundFor(Round)
+	if err != nil {
+		return err
+	}
 
 	if sn.IsRoot(view) {
 		sn.commitsDone <- Round
 
+		// only signed responses of members are sent down
+		sn.certifyVote(view, round.Vote)
 		var b []byte
-		b, err = round.Vote.MarshalBinary()
+		b, err = round.Vote.Encode()
 		if err != nil {
 			// log.Fatal("Marshal Binary failed for CountedVotes")
 			return err
@@ -173,7 +185,10 @@ func (sn *Node) Accept(view int, chm *ChallengeMessage) error {
 	sn.LastSeenRound = max(sn.LastSeenRound, chm.Round)
 	sn.roundmu.Unlock()
 
-	round := sn.Rounds[chm.Round]
+	round, err := sn.lookupRound(chm.Round)
+	if err != nil {
+		return err
+	}
 	if round == nil {
 		log.Errorln("error round is nil")
 		return nil
@@ -204,11 +219,11 @@ func (sn *Node) Accepted(view, Round int, sm *SigningMessage) error {
 	sn.LastSeenRound = max(sn.LastSeenRound, Round)
 	sn.roundmu.Unlock()
 
-	round := sn.Rounds[Round]
-	if round == nil {
+	round, err := sn.lookupRound(Round)
+	if err != nil || round == nil {
 		// TODO: if combined with cosi pubkey, check for round.Log.v existing needed
 		// If I was not announced of this round, or I failed to commit
-		return nil
+		return err
 	}
 
 	if sm != nil {
@@ -220,6 +235,7 @@ func (sn *Node) Accepted(view, Round int, sm *SigningMessage) error {
 	// TODO: after having a chance to inspect the contents of the challenge
 	// nodes can raise an alarm respond by ack/nack
 
+	sn.finishRound(Round)
 	if sn.IsRoot(view) {
 		sn.done <- Round
 	} else {
@@ -241,10 +257,8 @@ func (sn *Node) Accepted(view, Round int, sm *SigningMessage) error {
 }
 
 func (sn *Node) actOnVotes(view int, v *Vote) {
-	// TODO: percentage of nodes for quorum should be parameter
-	// Basic check to validate Vote was Confirmed, can be enhanced
-	// TODO: signing node can go through list of votes and verify
-	accepted := v.Count.For > 2*len(sn.HostListOn(view))/3
+	// every node checks the signed responses against the quorum of the vote type
+	accepted := sn.voteAccepted(view, v)
 
 	// Report on vote decision
 	if sn.IsRoot(view) {
@@ -255,6 +269,10 @@ func (sn *Node) actOnVotes(view int, v *Vote) {
 	// Act on vote Decision
 	if accepted {
 		log.Println(sn.Name(), "actOnVotes: vote", v.Index, " has been accepted")
+		v.Confirmed = true
+		if v.Type == ShutdownVT {
+			sn.stopRounds()
+		}
 		sn.VoteLog.Put(v.Index, v)
 	} else {
 		log.Println(sn.Name(), "actOnVotes: vote", v.Index, " has been rejected")
@@ -264,7 +282,7 @@ func (sn *Node) actOnVotes(view int, v *Vote) {
 			Type:         GroupChanged,
 			From:         sn.Name(),
 			View:         view,
-			LastSeenVote: int(sn.LastSeenVote),
+			LastSeenVote: int(atomic.LoadInt64(&sn.LastSeenVote)),
 			Gcm: &GroupChangedMessage{
 				V:        &*v, // need copy bcs PutTo on separate thread
 				HostList: sn.HostListOn(view)}}
@@ -275,7 +293,7 @@ func (sn *Node) actOnVotes(view int, v *Vote) {
 			sn.PutTo(context.TODO(), v.Rv.Name, gcm)
 		}
 
-		v.Type = NoOpVT
+		v.Type, v.Proposed = NoOpVT, v.Type
 		sn.VoteLog.Put(v.Index, v)
 
 	}
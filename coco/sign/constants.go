@@ -2,9 +2,15 @@ package sign
 
 import "time"
 
-// Constants we expect might be used by other packages
-// TODO: can this be replaced by the application using the signer?
-var ROUND_TIME time.Duration = 1 * time.Second
-var HEARTBEAT = ROUND_TIME + ROUND_TIME/2
+// Defaults for every node Config field left unset
+const (
+	DefaultRoundTime      time.Duration = 1 * time.Second
+	DefaultHeartbeat      time.Duration = DefaultRoundTime + DefaultRoundTime/2
+	DefaultGossipTime     time.Duration = 3 * DefaultRoundTime
+	DefaultTimeout        time.Duration = 5000 * time.Millisecond
+	DefaultRoundsPerView  int           = 100
+	DefaultRoundsInMemory int           = 100
+)
 
-var GOSSIP_TIME time.Duration = 3 * ROUND_TIME
+// most votes sent in answer to a catch up request
+const MaxCatchUpBatch = 64
@@ -9,3 +9,41 @@ var ErrViewRejected error = errors.New("view Rejected: not all nodes accepted vi
 var ErrImposedFailure error = errors.New("failure imposed")
 
 var ErrPastRound error = errors.New("round number already passed")
+
+var ErrRoundEvicted error = errors.New("round number already passed and evicted from memory")
+
+var ErrInvalidRoot error = errors.New("invalid root for proposed view")
+
+var ErrNoSuite error = errors.New("unable to decode message: no suite set")
+
+var ErrInvalidAck error = errors.New("invalid or missing commit acknowledgement")
+
+var ErrInvalidComplaint error = errors.New("invalid complaint")
+
+var ErrUnknownVoteType error = errors.New("unknown vote type")
+
+var ErrQuorumNotReached error = errors.New("vote did not reach its quorum")
+
+var ErrShuttingDown error = errors.New("shutting down: no new rounds")
+
+var ErrInvalidRecord error = errors.New("invalid signature on round record")
+
+var ErrBrokenHistory error = errors.New("round records do not form a chain")
+
+var ErrHistoryFork error = errors.New("fork in round history")
+
+var ErrInvalidDeal error = errors.New("invalid deal in key generation")
+
+var ErrThresholdNotReached error = errors.New("fewer hosts than the threshold committed")
+
+var ErrForeignAggregate error = errors.New("challenge not computed from the aggregate sent with it")
+
+var ErrSignerFailed error = errors.New("signer failed to respond: threshold signature aborted")
+
+var ErrUnknownRound error = errors.New("round not set up on this node")
+
+var ErrTooFewSigners error = errors.New("too few hosts signed")
+
+var ErrUntiedExceptions error = errors.New("commitments left out of signature not signed by the excepted hosts")
+
+var ErrInvalidSeed error = errors.New("seed record is not the newest signed round")
@@ -6,8 +6,6 @@ import (
 	"github.com/dedis/prifi/coco/proof"
 )
 
-var DEBUG bool // to avoid veryfing paths and signatures all the time
-
 // Returns commitment contribution for a round
 type CommitFunc func(view int) []byte
 
@@ -20,6 +18,7 @@ type Signer interface {
 	Name() string
 	IsRoot(view int) bool
 	Suite() abstract.Suite
+	Config() *Config // per node timing and protocol parameters
 	StartSigningRound() error
 	StartVotingRound(v *Vote) error
 
@@ -27,6 +26,12 @@ type Signer interface {
 	SetLastSeenRound(int) // impose change in round numbering
 
 	Hostlist() []string
+	RootFor(view int) string
+
+	// long term key of the node and signatures with it, see ElGamalVerify
+	PublicKey() abstract.Point
+	SignMessage(message []byte) BasicSig
+	KeyOf(name string) abstract.Point // key of a host, nil if unknown
 
 	// // proof can be nil for simple non Merkle Tree signatures
 	// // could add option field for Sign
@@ -47,6 +52,27 @@ type Signer interface {
 	Close()
 	Listen() error
 
+	// graceful shutdown of the group
+	Shutdown(reason string) error
+	ShuttingDown() bool
+	RegisterShutdownFunc(sf ShutdownFunc)
+	Closed() chan error // closed once the Signer is closed
+	ExitStatus() int
+
 	AddSelf(host string) error
 	RemoveSelf() error
+
+	// application aggregate, see snaggregate.go
+	RegisterAggregator(af AggregateFunc, cf CombineFunc)
+	RegisterAggregateDoneFunc(adf AggregateDoneFunc)
+	RegisterAggregateCheckFunc(acf AggregateCheckFunc)
+
+	// signed round history, see snhistory.go
+	RegisterRecordFunc(rf RecordFunc)
+	FindRecord(message []byte) *RoundRecord
+	SignedRound(Round int) *RoundRecord
+
+	// threshold key of the group, in Threshold mode
+	StartKeyGeneration() error
+	GroupKey() abstract.Point
 }
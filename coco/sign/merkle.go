@@ -16,10 +16,11 @@ import (
 	"github.com/dedis/prifi/coco/proof"
 )
 
-func (sn *Node) AddChildrenMerkleRoots(Round int) {
-	sn.roundLock.RLock()
-	round := sn.Rounds[Round]
-	sn.roundLock.RUnlock()
+func (sn *Node) AddChildrenMerkleRoots(Round int) error {
+	round, err := sn.roundFor(Round)
+	if err != nil {
+		return err
+	}
 	// children commit roots
 	round.CMTRoots = make([]hashid.HashId, len(round.Leaves))
 	copy(round.CMTRoots, round.Leaves)
@@ -31,12 +32,14 @@ func (sn *Node) AddChildrenMerkleRoots(Round int) {
 	for _, leaf := range round.Leaves {
 		round.Log.CMTRoots = append(round.Log.CMTRoots, leaf...)
 	}
+	return nil
 }
 
-func (sn *Node) AddLocalMerkleRoot(view, Round int) {
-	sn.roundLock.RLock()
-	round := sn.Rounds[Round]
-	sn.roundLock.RUnlock()
+func (sn *Node) AddLocalMerkleRoot(view, Round int) error {
+	round, err := sn.roundFor(Round)
+	if err != nil {
+		return err
+	}
 	// add own local mtroot to leaves
 	if sn.CommitFunc != nil {
 		round.LocalMTRoot = sn.CommitFunc(view)
@@ -44,12 +47,14 @@ func (sn *Node) AddLocalMerkleRoot(view, Round int) {
 		round.LocalMTRoot = make([]byte, hashid.Size)
 	}
 	round.Leaves = append(round.Leaves, round.LocalMTRoot)
+	return nil
 }
 
-func (sn *Node) ComputeCombinedMerkleRoot(view, Round int) {
-	sn.roundLock.RLock()
-	round := sn.Rounds[Round]
-	sn.roundLock.RUnlock()
+func (sn *Node) ComputeCombinedMerkleRoot(view, Round int) error {
+	round, err := sn.roundFor(Round)
+	if err != nil {
+		return err
+	}
 	// add hash of whole log to leaves
 	round.Leaves = append(round.Leaves, round.HashedLog)
 
@@ -72,16 +77,18 @@ func (sn *Node) ComputeCombinedMerkleRoot(view, Round int) {
 
 	// separate proofs by children (need to send personalized proofs to children)
 	// also separate local proof (need to send it to timestamp server)
-	sn.SeparateProofs(proofs, round.Leaves, Round)
+	sn.SeparateProofs(proofs, round.Leaves, round)
+	return nil
 }
 
 // Create Merkle Proof for local client (timestamp server)
 // Send Merkle Proof to local client (timestamp server)
 func (sn *Node) SendLocalMerkleProof(view int, chm *ChallengeMessage) error {
 	if sn.DoneFunc != nil {
-		sn.roundLock.RLock()
-		round := sn.Rounds[chm.Round]
-		sn.roundLock.RUnlock()
+		round, err := sn.roundFor(chm.Round)
+		if err != nil {
+			return err
+		}
 		proofForClient := make(proof.Proof, len(chm.Proof))
 		copy(proofForClient, chm.Proof)
 
@@ -92,8 +99,8 @@ func (sn *Node) SendLocalMerkleProof(view int, chm *ChallengeMessage) error {
 		// if want to verify partial and full proofs
 		// log.Println("*****")
 		// log.Println(sn.Name(), chm.Round, proofForClient)
-		if DEBUG == true {
-			sn.VerifyAllProofs(view, chm, proofForClient)
+		if sn.config.Debug == true {
+			sn.VerifyAllProofs(view, chm, round, proofForClient)
 		}
 
 		// 'reply' to client
@@ -107,7 +114,10 @@ func (sn *Node) SendLocalMerkleProof(view int, chm *ChallengeMessage) error {
 // Create Personalized Merkle Proofs for children servers
 // Send Personalized Merkle Proofs to children servers
 func (sn *Node) SendChildrenChallengesProofs(view int, chm *ChallengeMessage) error {
-	round := sn.Rounds[chm.Round]
+	round, err := sn.roundFor(chm.Round)
+	if err != nil {
+		return err
+	}
 	// proof from big root to our root will be sent to all children
 	baseProof := make(proof.Proof, len(chm.Proof))
 	copy(baseProof, chm.Proof)
@@ -117,6 +127,7 @@ func (sn *Node) SendChildrenChallengesProofs(view int, chm *ChallengeMessage) er
 	for name, conn := range sn.Children(view) {
 		newChm := *chm
 		newChm.Proof = append(baseProof, round.Proofs[name]...)
+		newChm.Receipt = sn.commitReceipt(chm.Round, name)
 
 		var messg coconet.BinaryMarshaler
 		messg = &SigningMessage{View: view, Type: Challenge, Chm: &newChm}
@@ -134,10 +145,7 @@ func (sn *Node) SendChildrenChallengesProofs(view int, chm *ChallengeMessage) er
 // Identify which proof corresponds to which leaf
 // Needed given that the leaves are sorted before passed to the function that create
 // the Merkle Tree and its Proofs
-func (sn *Node) SeparateProofs(proofs []proof.Proof, leaves []hashid.HashId, Round int) {
-	sn.roundLock.RLock()
-	round := sn.Rounds[Round]
-	sn.roundLock.RUnlock()
+func (sn *Node) SeparateProofs(proofs []proof.Proof, leaves []hashid.HashId, round *Round) {
 	// separate proofs for children servers mt roots
 	for i := 0; i < len(round.CMTRoots); i++ {
 		name := round.CMTRootNames[i]
@@ -160,10 +168,7 @@ func (sn *Node) SeparateProofs(proofs []proof.Proof, leaves []hashid.HashId, Rou
 
 // Check that starting from its own committed message each child can reach our subtrees' mtroot
 // Also checks that starting from local mt root we can get to  our subtrees' mtroot <-- could be in diff fct
-func (sn *Node) checkChildrenProofs(Round int) {
-	sn.roundLock.RLock()
-	round := sn.Rounds[Round]
-	sn.roundLock.RUnlock()
+func (sn *Node) checkChildrenProofs(round *Round) {
 	cmtAndLocal := make([]hashid.HashId, len(round.CMTRoots))
 	copy(cmtAndLocal, round.CMTRoots)
 	cmtAndLocal = append(cmtAndLocal, round.LocalMTRoot)
@@ -180,10 +185,7 @@ func (sn *Node) checkChildrenProofs(Round int) {
 	}
 }
 
-func (sn *Node) VerifyAllProofs(view int, chm *ChallengeMessage, proofForClient proof.Proof) {
-	sn.roundLock.RLock()
-	round := sn.Rounds[chm.Round]
-	sn.roundLock.RUnlock()
+func (sn *Node) VerifyAllProofs(view int, chm *ChallengeMessage, round *Round, proofForClient proof.Proof) {
 	// proof from client to my root
 	proof.CheckProof(sn.Suite().Hash, round.MTRoot, round.LocalMTRoot, round.Proofs["local"])
 	// proof from my root to big root
@@ -8,9 +8,13 @@ import "github.com/dedis/prifi/coco/coconet"
 
 // Send children challenges
 func (sn *Node) SendChildrenChallenges(view int, chm *ChallengeMessage) error {
-	for _, child := range sn.Children(view) {
+	for name, child := range sn.Children(view) {
+		// each child gets the receipt for its own commitment
+		newChm := *chm
+		newChm.Receipt = sn.commitReceipt(chm.Round, name)
+
 		var messg coconet.BinaryMarshaler
-		messg = &SigningMessage{View: view, Type: Challenge, Chm: chm}
+		messg = &SigningMessage{View: view, Type: Challenge, Chm: &newChm}
 
 		// fmt.Println(sn.Name(), "send to", i, child, "on view", view)
 		if err := child.Put(messg); err != nil {
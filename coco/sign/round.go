@@ -1,5 +1,7 @@
 package sign
 
+import "time"
+
 import "github.com/dedis/crypto/abstract"
 import "github.com/dedis/prifi/coco/hashid"
 import "github.com/dedis/prifi/coco/proof"
@@ -39,11 +41,34 @@ type Round struct {
 	ChildV_hat map[string]abstract.Point
 	// combined public keys of children servers in subtree
 	ChildX_hat map[string]abstract.Point
+	// public keys of the nodes counted in X_hat, own subtree and children's
+	Keys      []abstract.Point
+	ChildKeys map[string][]abstract.Point
 	// for internal verification purposes
 	exceptionV_hat abstract.Point
-
-	BackLink hashid.HashId
+	// signed commitments adding up to exceptionV_hat, see snaccount.go
+	ExceptedCommits []*ExceptedCommit
+
+	// accountability of exceptions, see snaccount.go
+	Acks            map[string]*CommitAck // signed commitments of children
+	Receipt         *BasicSig             // receipt of the parent for our commitment
+	ResponseReceipt *BasicSig             // receipt of the parent for our response
+	FinalExceptions []abstract.Point      // exception list announced by the root
+	sent            *sentRecord           // own commitment and response
+	done            time.Time             // when the root stopped waiting for responses
+
+	BackLink hashid.HashId // hash of the record of the previous signed round
 	AccRound []byte
+	Record   *RoundRecord // signed round, see snhistory.go
+
+	Aggregate []byte // application aggregate of the subtree
+	Refused   bool   // we did not sign: the aggregate of the root failed our check
+
+	// in Threshold mode, see snthreshold.go
+	Signers   []int // hosts of the subtree that committed
+	SignerSet []int // hosts that committed, announced with the challenge
+
+	Finished bool // all responses of the round were handled
 
 	Vote *Vote
 	// VoteRequest  *VoteRequest  // Vote Request vote on in the round
@@ -55,6 +80,7 @@ func NewRound(suite abstract.Suite) *Round {
 	round.Commits = make([]*SigningMessage, 0)
 	round.Responses = make([]*SigningMessage, 0)
 	round.ExceptionList = make([]abstract.Point, 0)
+	round.Acks = make(map[string]*CommitAck)
 	round.Log.Suite = suite
 	return round
 }
@@ -69,8 +95,31 @@ const (
 	ShutdownRT
 	NoOpRT
 	SigningRT
+	AppRT // application defined vote, see snvotetypes.go
 )
 
+// Type of a round running a vote of type vt
+func VoteRoundType(vt VoteType) RoundType {
+	switch vt {
+	case DefaultVT:
+		return EmptyRT
+	case ViewChangeVT:
+		return ViewChangeRT
+	case AddVT:
+		return AddRT
+	case RemoveVT:
+		return RemoveRT
+	case ShutdownVT:
+		return ShutdownRT
+	case NoOpVT:
+		return NoOpRT
+	}
+	if vt >= FirstAppVT {
+		return AppRT
+	}
+	return EmptyRT
+}
+
 func (rt RoundType) String() string {
 	switch rt {
 	case EmptyRT:
@@ -87,6 +136,8 @@ func (rt RoundType) String() string {
 		return "shutdown"
 	case NoOpRT:
 		return "noop"
+	case AppRT:
+		return "application"
 	default:
 		return ""
 	}
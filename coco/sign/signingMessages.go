@@ -4,7 +4,6 @@ import (
 	"reflect"
 
 	"github.com/dedis/crypto/abstract"
-	"github.com/dedis/crypto/nist"
 	"github.com/dedis/prifi/coco/hashid"
 	"github.com/dedis/prifi/coco/proof"
 	"github.com/dedis/protobuf"
@@ -29,6 +28,13 @@ const (
 	GroupChanged
 	Default // for internal use
 	Error
+	Complaint
+	Closing
+	Ping
+	Pong
+	KeyGen
+	KeyGenReply
+	ResponseAck
 )
 
 func (m MessageType) String() string {
@@ -55,6 +61,20 @@ func (m MessageType) String() string {
 		return "Default"
 	case Error:
 		return "Error"
+	case Complaint:
+		return "Complaint"
+	case Closing:
+		return "Closing"
+	case Ping:
+		return "Ping"
+	case Pong:
+		return "Pong"
+	case KeyGen:
+		return "KeyGen"
+	case KeyGenReply:
+		return "KeyGenReply"
+	case ResponseAck:
+		return "ResponseAck"
 	}
 	return "INVALID TYPE"
 }
@@ -72,28 +92,44 @@ type SigningMessage struct {
 	Vrm          *VoteRequestMessage
 	Gcm          *GroupChangedMessage
 	Err          *ErrorMessage
+	Cm           *ComplaintMessage
+	Lm           *LatencyMessage
+	Kgm          *KeyGenMessage
+	Ra           *ResponseAckMessage
 	From         string
 	View         int
 	LastSeenVote int // highest vote ever seen and commited in log, used for catch-up
-}
 
-var msgSuite abstract.Suite = nist.NewAES128SHA256P256()
+	suite abstract.Suite // suite used to decode points and secrets
+}
 
-func NewSigningMessage() interface{} {
-	return &SigningMessage{}
+// Create a SigningMessage that decodes its points and secrets with suite
+func NewSigningMessage(suite abstract.Suite) *SigningMessage {
+	return &SigningMessage{suite: suite}
 }
 
 func (sm *SigningMessage) MarshalBinary() ([]byte, error) {
 	return protobuf.Encode(sm)
 }
 
+// Decode data with the suite the message was created with.
+// Peers running another suite are refused when connecting,
+// so every sub-message can safely use the suite of the receiver.
 func (sm *SigningMessage) UnmarshalBinary(data []byte) error {
+	if sm.suite == nil {
+		return ErrNoSuite
+	}
+	return protobuf.DecodeWithConstructors(data, sm, suiteConstructors(sm.suite))
+}
+
+// Constructors for decoding the points and secrets of suite
+func suiteConstructors(suite abstract.Suite) protobuf.Constructors {
 	var cons = make(protobuf.Constructors)
 	var point abstract.Point
 	var secret abstract.Secret
-	cons[reflect.TypeOf(&point).Elem()] = func() interface{} { return msgSuite.Point() }
-	cons[reflect.TypeOf(&secret).Elem()] = func() interface{} { return msgSuite.Secret() }
-	return protobuf.DecodeWithConstructors(data, sm, cons)
+	cons[reflect.TypeOf(&point).Elem()] = func() interface{} { return suite.Point() }
+	cons[reflect.TypeOf(&secret).Elem()] = func() interface{} { return suite.Secret() }
+	return cons
 }
 
 // Broadcasted message initiated and signed by proposer
@@ -101,6 +137,12 @@ type AnnouncementMessage struct {
 	LogTest []byte // TODO: change LogTest to Messg
 	Round   int
 
+	// exception list of the last round finished by the root
+	Exceptions *RoundExceptions
+
+	// record of the last round signed by the root, see snhistory.go
+	Prev *RoundRecord
+
 	// VoteRequest *VoteRequest
 	Vote *Vote // Vote Request (propose)
 }
@@ -120,6 +162,16 @@ type CommitmentMessage struct {
 	Vote *Vote // Vote Response (promise)
 
 	Round int
+
+	Ack *BasicSig // signature of the sender on its commitment
+
+	Aggregate []byte // application aggregate of the subtree, see snaggregate.go
+
+	Head *RoundRecord // newest signed round known to the subtree
+
+	Signers []int // hosts of the subtree that committed, in Threshold mode
+
+	Keys []abstract.Point // public keys of the subtree nodes counted in X_hat
 }
 
 type ChallengeMessage struct {
@@ -133,6 +185,15 @@ type ChallengeMessage struct {
 	Vote *Vote // Vote Confirmerd/ Rejected (accept)
 
 	Round int
+
+	Receipt *BasicSig // signature of the parent on the commitment it counted for us
+
+	BackLink hashid.HashId // hash of the record of the previous signed round
+
+	Signers []int // hosts that committed, in Threshold mode
+
+	Aggregate []byte         // aggregate of the whole tree, see snaggregate.go
+	V_hat     abstract.Point // commitment of the root the challenge was computed from
 }
 
 type ResponseMessage struct {
@@ -145,18 +206,58 @@ type ResponseMessage struct {
 	ExceptionV_hat abstract.Point
 	// cummulative public keys of nodes that failed after commit
 	ExceptionX_hat abstract.Point
+	// signed commitments of the subtrees in ExceptionV_hat
+	ExceptedCommits []*ExceptedCommit
 
 	Vote *Vote // Vote Ack/Nack in thr log (ack/nack)
 
 	Round int
 }
 
+// Receipt of a parent for the response of a child, see snaccount.go
+type ResponseAckMessage struct {
+	Round int
+	Sig   BasicSig // signature of the parent on the response digest
+}
+
 type ErrorMessage struct {
 	Err string
 }
 
+// Published by a node excepted from a round it responded to.
+// It holds the receipt of the accused parent for the accuser's commitment
+// and the response the accuser sent up for it.
+type ComplaintMessage struct {
+	View  int
+	Round int
+
+	Accuser    string
+	AccuserKey abstract.Point
+	Accused    string
+	AccusedKey abstract.Point
+
+	// commitment of the accuser's subtree and the receipt of the accused
+	V_hat   abstract.Point
+	X_hat   abstract.Point
+	MTRoot  hashid.HashId
+	Receipt BasicSig
+
+	// response of the accuser's subtree
+	R_hat          abstract.Secret
+	ExceptionV_hat abstract.Point
+	ExceptionX_hat abstract.Point
+	// receipt of the accused for that response, nil if it never sent one:
+	// only the root checks such complaints, against the time the accuser
+	// sent its response, in unix nanoseconds
+	ResponseReceipt *BasicSig
+	Sent            int64
+
+	Sig BasicSig // signature of the accuser on the complaint
+}
+
 type VoteRequestMessage struct {
 	Vote *Vote
+	Sig  *BasicSig // signature of the sender on a view change request
 }
 
 type GroupChangedMessage struct {
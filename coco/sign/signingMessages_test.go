@@ -7,6 +7,7 @@ import (
 
 	"log"
 
+	"github.com/dedis/crypto/edwards/ed25519"
 	"github.com/dedis/crypto/nist"
 	"github.com/dedis/prifi/coco/hashid"
 	"github.com/dedis/prifi/coco/proof"
@@ -17,13 +18,17 @@ func init() {
 	log.SetFlags(log.Lshortfile)
 }
 
+var testSuite = nist.NewAES128SHA256P256()
+
 func TestErrorMessage(t *testing.T) {
-	sm := &sign.SigningMessage{Type: sign.Error, Err: &sign.ErrorMessage{Err: "random error"}}
+	sm := sign.NewSigningMessage(testSuite)
+	sm.Type = sign.Error
+	sm.Err = &sign.ErrorMessage{Err: "random error"}
 	b, e := sm.MarshalBinary()
 	if e != nil {
 		t.Fatal(e)
 	}
-	sm2 := &sign.SigningMessage{}
+	sm2 := sign.NewSigningMessage(testSuite)
 	e = sm2.UnmarshalBinary(b)
 	if e != nil {
 		t.Fatal(e)
@@ -38,13 +43,15 @@ func TestErrorMessage(t *testing.T) {
 
 func TestMUAnnouncement(t *testing.T) {
 	logTest := []byte("Hello World")
-	sm := &sign.SigningMessage{Type: sign.Announcement, Am: &sign.AnnouncementMessage{LogTest: logTest}}
+	sm := sign.NewSigningMessage(testSuite)
+	sm.Type = sign.Announcement
+	sm.Am = &sign.AnnouncementMessage{LogTest: logTest}
 	dataBytes, err := sm.MarshalBinary()
 	if err != nil {
 		t.Error("Marshaling didn't work")
 	}
 
-	sm2 := &sign.SigningMessage{}
+	sm2 := sign.NewSigningMessage(testSuite)
 	sm2.UnmarshalBinary(dataBytes)
 	if err != nil {
 		t.Error("Unmarshaling didn't work")
@@ -76,7 +83,7 @@ func TestMUChallenge(t *testing.T) {
 		t.Error(err)
 	}
 
-	messg := &sign.SigningMessage{}
+	messg := sign.NewSigningMessage(suite)
 	err = messg.UnmarshalBinary(smBytes)
 	cm2 := messg.Chm
 
@@ -107,7 +114,7 @@ func TestMUCommit(t *testing.T) {
 		t.Error(err)
 	}
 
-	messg := &sign.SigningMessage{}
+	messg := sign.NewSigningMessage(suite)
 	err = messg.UnmarshalBinary(smBytes)
 	cm2 := messg.Com
 
@@ -120,6 +127,41 @@ func TestMUCommit(t *testing.T) {
 
 }
 
+// Votes nested in signing messages must decode with the suite of the node,
+// not only with the default nist suite
+func TestMUVoteEd25519(t *testing.T) {
+	suite := ed25519.NewAES128SHA256Ed25519(true)
+	rand := suite.Cipher([]byte("example"))
+	priv := suite.Secret().Pick(rand)
+
+	v := &sign.Vote{Type: sign.ViewChangeVT, Vcv: &sign.ViewChangeVote{View: 1, Root: "root"}}
+	sig := sign.ElGamalSign(suite, rand, []byte("vote"), priv)
+	v.Count = &sign.Count{For: 1,
+		Responses: []*sign.VoteResponse{{Name: "voter", Accepted: true, Sig: sig}}}
+
+	sm := sign.NewSigningMessage(suite)
+	sm.Type = sign.Challenge
+	sm.Chm = &sign.ChallengeMessage{C: suite.Secret().Pick(rand), Vote: v}
+	smBytes, err := sm.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messg := sign.NewSigningMessage(suite)
+	if err = messg.UnmarshalBinary(smBytes); err != nil {
+		t.Fatal(err)
+	}
+	sig2 := messg.Chm.Vote.Count.Responses[0].Sig
+	if !messg.Chm.C.Equal(sm.Chm.C) || !sig2.C.Equal(sig.C) || !sig2.R.Equal(sig.R) {
+		t.Error("vote message MU failed with ed25519")
+	}
+
+	// messages without a suite refuse to decode
+	if err = (&sign.SigningMessage{}).UnmarshalBinary(smBytes); err != sign.ErrNoSuite {
+		t.Error("expected ErrNoSuite, got", err)
+	}
+}
+
 func byteArrayEqual(a proof.Proof, b proof.Proof) bool {
 	n := len(a)
 	if n != len(b) {
@@ -17,6 +17,7 @@ import (
 	log "github.com/Sirupsen/logrus"
 
 	"github.com/dedis/crypto/abstract"
+	"github.com/dedis/crypto/random"
 	"github.com/dedis/prifi/coco/coconet"
 	"github.com/dedis/prifi/coco/hashid"
 	"github.com/dedis/prifi/coco/test/logutils"
@@ -32,6 +33,8 @@ const (
 	PubKey
 	// Basic Signature on aggregated votes
 	Voter
+	// Merkle Trees signed by t-of-n hosts under a single group key
+	Threshold
 )
 
 var _ Signer = &Node{}
@@ -43,10 +46,16 @@ type Node struct {
 	FailureRate         int
 	FailAsRootEvery     int
 	FailAsFollowerEvery int
+	// In Threshold mode, pass rounds on without taking part in signatures
+	Abstain bool
 
 	randmu sync.Mutex
 	Rand   *rand.Rand
 
+	// per node configuration; Type and RoundsPerView start out
+	// from it and can be overridden before the node starts
+	config *Config
+
 	Type   Type
 	Height int
 
@@ -57,8 +66,10 @@ type Node struct {
 	PrivKey abstract.Secret // long lasting private key
 
 	nRounds       int
-	Rounds        map[int]*Round
-	Round         int // *only* used by Root( by annoucer)
+	Rounds        map[int]*Round // last rounds in memory, guarded by roundLock
+	evictedRound  int            // rounds up to this one were evicted
+	PersistFunc   PersistFunc    // called with finished rounds on eviction
+	Round         int            // *only* used by Root( by annoucer)
 	RoundTypes    []RoundType
 	roundmu       sync.Mutex
 	LastSeenRound int // largest round number I have seen
@@ -69,6 +80,13 @@ type Node struct {
 	CommitFunc CommitFunc
 	DoneFunc   DoneFunc
 
+	// application defined aggregation
+	aggmu              sync.Mutex
+	AggregateFunc      AggregateFunc
+	CombineFunc        CombineFunc
+	AggregateDoneFunc  AggregateDoneFunc
+	AggregateCheckFunc AggregateCheckFunc
+
 	// NOTE: reuse of channels via round-number % Max-Rounds-In-Mermory can be used
 	roundLock sync.RWMutex
 	LogTest   []byte                    // for testing purposes
@@ -87,6 +105,53 @@ type Node struct {
 	viewmu       sync.Mutex
 	ViewNo       int
 
+	// state for selecting the root of new views
+	rootmu      sync.Mutex
+	viewRoots   map[int]string // agreed root of views we changed to
+	failedRoots map[string]int // hosts that failed as root, and on which view
+	suspected   map[int]string // roots we saw fail, not yet agreed on
+
+	// accountability of exception lists
+	complaintmu    sync.Mutex
+	complaints     map[string][]*ComplaintMessage // verified complaints against hosts
+	lastExceptions *RoundExceptions               // exceptions of the last round as root
+
+	// application defined vote types
+	votemu    sync.Mutex
+	voteTypes map[VoteType]*VoteHandler
+	quorums   map[VoteType]*Quorum
+
+	// latencies to peers and trees built from them, see sntopology.go
+	latencymu    sync.Mutex
+	rtts         map[string]time.Duration // our round trip times to peers
+	latencyTable map[string]*LatencyRow   // round trip times reported by others
+	topologies   map[int]*Topology        // trees of views changed to with a topology
+	degradedView int                      // last view we asked to leave for a degraded link
+
+	// operator status of peers
+	peermu    sync.Mutex
+	lastHeard map[string]time.Time // last message received from each peer
+
+	// hash chained round history, see snhistory.go
+	historymu  sync.Mutex
+	head       *RoundRecord // newest signed round we know of
+	RecordFunc RecordFunc   // called on the root with every signed round
+
+	// threshold key of the group, see snthreshold.go
+	thresholdmu sync.Mutex
+	tkey        *thresholdKey
+	keygen      *keyGen
+
+	// graceful shutdown
+	shutdownmu      sync.Mutex
+	ShutdownFunc    ShutdownFunc    // called once the last rounds are done
+	shuttingDown    bool            // no new rounds are started
+	closing         bool            // shutdown vote applied
+	closingChildren map[string]bool // children done shutting down
+	exitStatus      int
+	exited          bool
+	replayedVote    int // votes up to this one were in the log on start
+
 	timeout  time.Duration
 	timeLock sync.RWMutex
 
@@ -100,7 +165,8 @@ type Node struct {
 	LastSeenVote    int64    // max of all Highest Votes we've seen, and our last commited vote
 	LastAppliedVote int64    // last vote we have committed to our log
 
-	Actions map[int][]*Vote
+	actionmu sync.Mutex
+	Actions  map[int][]*Vote // confirmed votes by the view they act on
 }
 
 // Start listening for messages coming from parent(up)
@@ -140,9 +206,13 @@ func (sn *Node) Close() {
 		log.Println("after close", sn.Name(), "has heartbeat=", sn.heartbeat)
 	}
 	if !sn.isclosed {
+		sn.setExitStatus(ExitOK)
 		close(sn.closed)
 		log.Printf("signing node: closing: %s", sn.Name())
 		sn.Host.Close()
+		if err := sn.VoteLog.Close(); err != nil {
+			log.Errorln(sn.Name(), "closing vote log:", err)
+		}
 	}
 	sn.isclosed = true
 	sn.hbLock.Unlock()
@@ -156,19 +226,33 @@ func (sn *Node) Hostlist() []string {
 	return sn.HostList
 }
 
-// Returns name of node who should be the root for the next view
-// round robin is used on the array of host names to determine the next root
+// Returns name of node who should be the root for the given view
+// Once a view change is agreed on its root is fixed; for views not
+// yet agreed on the root is drawn from the latest collective challenge
+// seen on the previous view, skipping roots that recently failed
 func (sn *Node) RootFor(view int) string {
 	// log.Println(sn.Name(), "ROOT FOR", view)
-	var hl []string
+	sn.rootmu.Lock()
+	root, ok := sn.viewRoots[view]
+	sn.rootmu.Unlock()
+	if ok {
+		return root
+	}
+
 	if view == 0 {
-		hl = sn.HostListOn(view)
-	} else {
-		// we might not have the host list for current view
-		// safer to use the previous view's hostlist, always
-		hl = sn.HostListOn(view - 1)
+		return sn.HostListOn(view)[0]
 	}
-	return hl[view%len(hl)]
+	// we might not have the host list for current view
+	// safer to use the previous view's hostlist, always
+	hl := sn.HostListOn(view - 1)
+	seed := RecordSeed(sn.suite, sn.historyHead())
+	skip := skipFailed(sn.failedRootsFor(view))
+	sn.rootmu.Lock()
+	if r, ok := sn.suspected[view-1]; ok {
+		skip[r] = true
+	}
+	sn.rootmu.Unlock()
+	return SelectRoot(sn.suite, seed, view, hl, skip)
 }
 
 func (sn *Node) SetFailureRate(v int) {
@@ -280,6 +364,9 @@ func (sn *Node) StartAnnouncement(am *AnnouncementMessage) error {
 
 func (sn *Node) StartVotingRound(v *Vote) error {
 	log.Println(sn.Name(), "start voting round")
+	if sn.ShuttingDown() {
+		return ErrShuttingDown
+	}
 	sn.nRounds = sn.LastSeenRound
 
 	// during view changes, only accept view change related votes
@@ -311,6 +398,9 @@ func (sn *Node) StartVotingRound(v *Vote) error {
 }
 
 func (sn *Node) StartSigningRound() error {
+	if sn.ShuttingDown() {
+		return ErrShuttingDown
+	}
 	sn.nRounds = sn.LastSeenRound
 
 	// report view is being change, and sleep before retrying
@@ -327,39 +417,55 @@ func (sn *Node) StartSigningRound() error {
 		&AnnouncementMessage{LogTest: []byte("sign round"), Round: sn.nRounds})
 }
 
-func NewNode(hn coconet.Host, suite abstract.Suite, random cipher.Stream) *Node {
-	sn := &Node{Host: hn, suite: suite}
-	msgSuite = suite
+// Returns an error if config can not be used, see Config.Validate
+func NewNode(hn coconet.Host, suite abstract.Suite, random cipher.Stream, config *Config) (*Node, error) {
+	sn, err := newNode(hn, suite, config)
+	if err != nil {
+		return nil, err
+	}
 	sn.PrivKey = suite.Secret().Pick(random)
 	sn.PubKey = suite.Point().Mul(nil, sn.PrivKey)
-
-	sn.peerKeys = make(map[string]abstract.Point)
-	sn.Rounds = make(map[int]*Round)
-
-	sn.closed = make(chan error, 20)
-	sn.done = make(chan int, 10)
-	sn.commitsDone = make(chan int, 10)
-	sn.viewChangeCh = make(chan string, 0)
-
-	sn.FailureRate = 0
-	h := fnv.New32a()
-	h.Write([]byte(hn.Name()))
-	seed := h.Sum32()
-	sn.Rand = rand.New(rand.NewSource(int64(seed)))
-	sn.Host.SetSuite(suite)
-	sn.VoteLog = NewVoteLog()
-	sn.Actions = make(map[int][]*Vote)
-	sn.RoundsPerView = 100
-	return sn
+	return sn, nil
 }
 
 // Create new signing node that incorporates a given private key
-func NewKeyedNode(hn coconet.Host, suite abstract.Suite, PrivKey abstract.Secret) *Node {
-	sn := &Node{Host: hn, suite: suite, PrivKey: PrivKey}
+func NewKeyedNode(hn coconet.Host, suite abstract.Suite, PrivKey abstract.Secret, config *Config) (*Node, error) {
+	sn, err := newNode(hn, suite, config)
+	if err != nil {
+		return nil, err
+	}
+	sn.PrivKey = PrivKey
 	sn.PubKey = suite.Point().Mul(nil, sn.PrivKey)
+	return sn, nil
+}
+
+// Common setup for signing nodes; a nil config stands for DefaultConfig()
+func newNode(hn coconet.Host, suite abstract.Suite, config *Config) (*Node, error) {
+	if config == nil {
+		config = DefaultConfig()
+	} else {
+		config = config.Copy()
+		config.SetDefaults()
+	}
+	if err := config.Validate(); err != nil {
+		return nil, errors.New(hn.Name() + ": " + err.Error())
+	}
+
+	sn := &Node{Host: hn, suite: suite, config: config}
 
 	sn.peerKeys = make(map[string]abstract.Point)
 	sn.Rounds = make(map[int]*Round)
+	sn.viewRoots = make(map[int]string)
+	sn.failedRoots = make(map[string]int)
+	sn.suspected = make(map[int]string)
+	sn.complaints = make(map[string][]*ComplaintMessage)
+	sn.voteTypes = make(map[VoteType]*VoteHandler)
+	sn.quorums = make(map[VoteType]*Quorum)
+	sn.closingChildren = make(map[string]bool)
+	sn.lastHeard = make(map[string]time.Time)
+	sn.rtts = make(map[string]time.Duration)
+	sn.latencyTable = make(map[string]*LatencyRow)
+	sn.topologies = make(map[int]*Topology)
 
 	sn.closed = make(chan error, 20)
 	sn.done = make(chan int, 10)
@@ -373,9 +479,17 @@ func NewKeyedNode(hn coconet.Host, suite abstract.Suite, PrivKey abstract.Secret
 	sn.Rand = rand.New(rand.NewSource(int64(seed)))
 	sn.Host.SetSuite(suite)
 	sn.VoteLog = NewVoteLog()
+	if config.DataDir != "" {
+		vl, err := openNodeVoteLog(config.DataDir, hn.Name(), suite)
+		if err != nil {
+			return nil, errors.New(hn.Name() + ": " + err.Error())
+		}
+		sn.VoteLog = vl
+	}
 	sn.Actions = make(map[int][]*Vote)
-	sn.RoundsPerView = 100
-	return sn
+	sn.Type = config.Type
+	sn.RoundsPerView = config.RoundsPerView
+	return sn, nil
 }
 
 func (sn *Node) ShouldIFail(phase string) bool {
@@ -403,10 +517,38 @@ func (sn *Node) AddPeer(conn string, PubKey abstract.Point) {
 	sn.peerKeys[conn] = PubKey
 }
 
+// Public key of a host of the group we are not connected to,
+// *only* called before the node runs
+func (sn *Node) AddPeerKey(name string, PubKey abstract.Point) {
+	sn.peerKeys[name] = PubKey
+}
+
+// Long term public key of the node
+func (sn *Node) PublicKey() abstract.Point {
+	return sn.PubKey
+}
+
+// Long term public key of host name, nil if we do not know it
+func (sn *Node) KeyOf(name string) abstract.Point {
+	return sn.keyOf(name)
+}
+
+// Signature of message with the long term key of the node,
+// see ElGamalVerify
+func (sn *Node) SignMessage(message []byte) BasicSig {
+	return ElGamalSign(sn.suite, random.Stream, message, sn.PrivKey)
+}
+
 func (sn *Node) Suite() abstract.Suite {
 	return sn.suite
 }
 
+// Copy of the config of the node, it can not be changed once the node
+// is built, see ConfigOptions
+func (sn *Node) Config() *Config {
+	return sn.config.Copy()
+}
+
 func (sn *Node) Done() chan int {
 	return sn.done
 }
@@ -433,36 +575,30 @@ func (sn *Node) CommitedFor(round *Round) bool {
 }
 
 // Cast on vote for Vote
-func (sn *Node) AddVotes(Round int, v *Vote) {
+func (sn *Node) AddVotes(round *Round, v *Vote) {
 	if v == nil {
 		return
 	}
 
-	round := sn.Rounds[Round]
 	cv := round.Vote.Count
-	vresp := &VoteResponse{Name: sn.Name()}
+	vresp := &VoteResponse{Name: sn.Name(), PubKey: sn.PubKey}
 
-	// accept what admin requested with x% probability
-	// TODO: replace with non-probabilistic approach, maybe callback
-	forProbability := 100
-	sn.randmu.Lock()
-	if p := sn.Rand.Int() % 100; p < forProbability {
+	// application defined votes are validated by their handler
+	if sn.acceptVote(v.View, v) {
 		cv.For += 1
 		vresp.Accepted = true
 	} else {
 		cv.Against += 1
 	}
-	sn.randmu.Unlock()
 
 	// log.Infoln(sn.Name(), "added votes. for:", cv.For, "against:", cv.Against)
 
-	// Generate signature on Vote with OwnVote *counted* in
-	b, err := v.MarshalBinary()
+	// Generate signature on Vote and our decision
+	b, err := VoteDigest(sn.suite, v, vresp.Name, vresp.Accepted)
 	if err != nil {
-		log.Fatal("Marshal Binary on Counted Votes failed")
+		log.Fatal("Marshal Binary on Vote failed")
 	}
-	rand := sn.suite.Cipher([]byte(sn.Name() + strconv.Itoa(Round)))
-	vresp.Sig = ElGamalSign(sn.suite, rand, b, sn.PrivKey)
+	vresp.Sig = ElGamalSign(sn.suite, random.Stream, b, sn.PrivKey)
 
 	// Add VoteResponse to Votes
 	v.Count.Responses = append(v.Count.Responses, vresp)
@@ -471,22 +607,24 @@ func (sn *Node) AddVotes(Round int, v *Vote) {
 
 func intToByteSlice(Round int) []byte {
 	buf := new(bytes.Buffer)
-	binary.Write(buf, binary.LittleEndian, Round)
+	binary.Write(buf, binary.LittleEndian, int64(Round))
 	return buf.Bytes()
 }
 
 // *only* called by root node
-func (sn *Node) SetAccountableRound(Round int) {
+func (sn *Node) SetAccountableRound(Round int) error {
+	round, err := sn.roundFor(Round)
+	if err != nil {
+		return err
+	}
 	// Create my back link to previous round
-	sn.SetBackLink(Round)
+	sn.SetBackLink(round)
 
 	h := sn.suite.Hash()
 	h.Write(intToByteSlice(Round))
-	h.Write(sn.Rounds[Round].BackLink)
-	sn.Rounds[Round].AccRound = h.Sum(nil)
-
-	// here I could concatenate sn.Round after the hash for easy keeping track of round
-	// todo: check this
+	h.Write(round.BackLink)
+	round.AccRound = h.Sum(nil)
+	return nil
 }
 
 func (sn *Node) UpdateTimeout(t ...time.Duration) {
@@ -498,26 +636,18 @@ func (sn *Node) UpdateTimeout(t ...time.Duration) {
 	}
 }
 
-func (sn *Node) SetBackLink(Round int) {
-	prevRound := Round - 1
-	sn.Rounds[Round].BackLink = hashid.HashId(make([]byte, hashid.Size))
-	if prevRound >= FIRST_ROUND {
-		// My Backlink = Hash(prevRound, sn.Rounds[prevRound].BackLink, sn.Rounds[prevRound].MTRoot)
-		h := sn.suite.Hash()
-		if sn.Rounds[prevRound] == nil {
-			log.Errorln(sn.Name(), "not setting back link")
-			return
-		}
-		h.Write(intToByteSlice(prevRound))
-		h.Write(sn.Rounds[prevRound].BackLink)
-		h.Write(sn.Rounds[prevRound].MTRoot)
-		sn.Rounds[Round].BackLink = h.Sum(nil)
+// *only* called by root node, once the commits of the round are in
+// My Backlink = Hash(record of the newest signed round known to the tree)
+func (sn *Node) SetBackLink(round *Round) {
+	round.BackLink = hashid.HashId(make([]byte, hashid.Size))
+	if head := sn.historyHead(); head != nil {
+		round.BackLink = head.Hash(sn.suite)
 	}
 }
 
 func (sn *Node) GenSetPool() {
 	var p sync.Pool
-	p.New = NewSigningMessage
+	p.New = func() interface{} { return NewSigningMessage(sn.suite) }
 	sn.SetPool(&p)
 }
 
@@ -535,5 +665,5 @@ func (sn *Node) Timeout() time.Duration {
 }
 
 func (sn *Node) DefaultTimeout() time.Duration {
-	return 5000 * time.Millisecond
+	return sn.config.Timeout
 }
@@ -0,0 +1,607 @@
+package sign
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+
+	"github.com/dedis/crypto/abstract"
+	"github.com/dedis/crypto/random"
+	"github.com/dedis/prifi/coco/hashid"
+)
+
+// Accountability of exception lists
+//
+// A parent leaves a child out of the collective signature by putting its
+// key in the exception list. To keep parents from silently excluding
+// honest children:
+//  1. children sign their commitment (Ack) and parents keep these acks
+//  2. parents send back, with the challenge, a signed receipt of the
+//     commitment they counted for each child
+//  3. parents sign a receipt of each response they count and send it
+//     back to the child
+//  4. the root announces the exception list of the last finished round,
+//     which nodes check against the signed record of the round
+//  5. a node that finds itself excepted although its response was
+//     acknowledged publishes a complaint made of both of its parent's
+//     receipts and of its valid response
+//  6. a node excepted without receipt for its response sends the root
+//     a complaint holding its valid response and the time it sent it:
+//     only the root, which knows when it stopped waiting for responses,
+//     checks and keeps such complaints
+// A crashed child, or one withholding its response, holds no valid
+// response to complain with: complaints single out parents that drop
+// the responses they received.
+//
+// Commitments of subtrees that committed but did not respond are taken
+// out of the collective signature. They go with it, each signed by the
+// root of the subtree (its ack) and by the parent that left it out (its
+// receipt): verifiers check the first against the exception list and the
+// second against another key of the group, so that no single key holder
+// can choose the commitments taken out of a signature. Nodes refusing to sign give
+// up their secret commitment as response rather than take it out.
+
+// number of rounds with valid complaints against a node before it is
+// considered to be censoring its children
+const CensorThreshold = 3
+
+// Commitment of a child and its signature, kept by the parent
+type CommitAck struct {
+	Digest []byte
+	Sig    BasicSig
+	V_hat  abstract.Point
+	X_hat  abstract.Point
+	MTRoot hashid.HashId
+}
+
+// Commitment of a subtree left out of a collective signature after it
+// committed, with the ack of the subtree root and the receipt of its parent
+type ExceptedCommit struct {
+	View   int
+	Name   string
+	Key    abstract.Point // key of the subtree root
+	V_hat  abstract.Point
+	X_hat  abstract.Point
+	MTRoot hashid.HashId
+	Ack    BasicSig
+
+	ParentKey abstract.Point
+	Receipt   BasicSig
+}
+
+// Exception list of a finished round, announced by the root
+type RoundExceptions struct {
+	View          int
+	Round         int
+	ExceptionList []abstract.Point
+}
+
+// Our own commitment and response on a round, kept to complain
+type sentRecord struct {
+	view   int
+	digest []byte
+	V_hat  abstract.Point
+	X_hat  abstract.Point
+	MTRoot hashid.HashId
+	rm     *ResponseMessage
+	at     time.Time // when rm was sent
+}
+
+// Digest of the commitment of name's subtree, signed both by name (ack)
+// and by its parent (receipt)
+func CommitDigest(suite abstract.Suite, view, Round int, name string,
+	V_hat, X_hat abstract.Point, MTRoot hashid.HashId) []byte {
+	h := suite.Hash()
+	h.Write(intToByteSlice(view))
+	h.Write(intToByteSlice(Round))
+	h.Write([]byte(name))
+	writePoints(h, V_hat, X_hat)
+	h.Write(MTRoot)
+	return h.Sum(nil)
+}
+
+func (ec *ExceptedCommit) Digest(suite abstract.Suite, Round int) []byte {
+	return CommitDigest(suite, ec.View, Round, ec.Name, ec.V_hat, ec.X_hat, ec.MTRoot)
+}
+
+// Check that the commitments left out of a collective signature on round
+// Round add up to exceptionV_hat, and that each was acked by an excepted
+// key and received by another one of keys
+func verifyExceptedCommits(suite abstract.Suite, Round int, keys, exceptions []abstract.Point,
+	exceptionV_hat abstract.Point, commits []*ExceptedCommit) error {
+	V := suite.Point().Null()
+	for i, ec := range commits {
+		if ec == nil || ec.Key == nil || ec.ParentKey == nil || ec.V_hat == nil {
+			return ErrUntiedExceptions
+		}
+		if !containsPoint(exceptions, ec.Key) ||
+			!containsPoint(keys, ec.ParentKey) || ec.ParentKey.Equal(ec.Key) {
+			return ErrUntiedExceptions
+		}
+		for _, prev := range commits[:i] {
+			if prev != nil && prev.Key != nil && prev.Key.Equal(ec.Key) {
+				return ErrUntiedExceptions
+			}
+		}
+		digest := ec.Digest(suite, Round)
+		if ElGamalVerify(suite, digest, ec.Key, ec.Ack) != nil ||
+			ElGamalVerify(suite, digest, ec.ParentKey, ec.Receipt) != nil {
+			return ErrUntiedExceptions
+		}
+		V.Add(V, ec.V_hat)
+	}
+	if exceptionV_hat == nil {
+		exceptionV_hat = suite.Point().Null()
+	}
+	if !V.Equal(exceptionV_hat) {
+		return ErrUntiedExceptions
+	}
+	return nil
+}
+
+// Digest of the response of name's subtree, signed by its parent
+func ResponseDigest(suite abstract.Suite, view, Round int, name string,
+	R_hat abstract.Secret, ExceptionV_hat, ExceptionX_hat abstract.Point) []byte {
+	h := suite.Hash()
+	h.Write(intToByteSlice(view))
+	h.Write(intToByteSlice(Round))
+	h.Write([]byte(name))
+	if R_hat != nil {
+		b, _ := R_hat.MarshalBinary()
+		h.Write(b)
+	}
+	writePoints(h, ExceptionV_hat, ExceptionX_hat)
+	return h.Sum(nil)
+}
+
+// Digest of everything in a complaint but its signatures
+func (cm *ComplaintMessage) Digest(suite abstract.Suite) []byte {
+	h := suite.Hash()
+	h.Write(intToByteSlice(cm.View))
+	h.Write(intToByteSlice(cm.Round))
+	h.Write([]byte(cm.Accuser))
+	h.Write([]byte(cm.Accused))
+	writePoints(h, cm.AccuserKey, cm.AccusedKey, cm.V_hat, cm.X_hat)
+	h.Write(cm.MTRoot)
+	if cm.R_hat != nil {
+		b, _ := cm.R_hat.MarshalBinary()
+		h.Write(b)
+	}
+	writePoints(h, cm.ExceptionV_hat, cm.ExceptionX_hat)
+	binary.Write(h, binary.LittleEndian, cm.Sent)
+	return h.Sum(nil)
+}
+
+func writePoints(w io.Writer, ps ...abstract.Point) {
+	for _, p := range ps {
+		if p == nil {
+			continue
+		}
+		b, _ := p.MarshalBinary()
+		w.Write(b)
+	}
+}
+
+func (sn *Node) clonePoint(p abstract.Point) abstract.Point {
+	c := sn.suite.Point().Null()
+	sn.add(c, p)
+	return c
+}
+
+// Sign our commitment for the round and remember it for complaints
+func (sn *Node) ackCommit(view, Round int, round *Round) BasicSig {
+	sent := &sentRecord{
+		view:   view,
+		V_hat:  sn.clonePoint(round.Log.V_hat),
+		X_hat:  sn.clonePoint(round.X_hat),
+		MTRoot: round.MTRoot}
+	sent.digest = CommitDigest(sn.suite, view, Round, sn.Name(), sent.V_hat, sent.X_hat, sent.MTRoot)
+	round.sent = sent
+	return ElGamalSign(sn.suite, random.Stream, sent.digest, sn.PrivKey)
+}
+
+// Check the ack of a child's commitment and keep it
+func (sn *Node) checkCommitAck(view, Round int, round *Round, sm *SigningMessage, key abstract.Point) error {
+	digest := CommitDigest(sn.suite, view, Round, sm.From, sm.Com.V_hat, sm.Com.X_hat, sm.Com.MTRoot)
+	if sm.Com.Ack == nil || key == nil {
+		return ErrInvalidAck
+	}
+	if err := ElGamalVerify(sn.suite, digest, key, *sm.Com.Ack); err != nil {
+		return ErrInvalidAck
+	}
+	round.Acks[sm.From] = &CommitAck{
+		Digest: digest,
+		Sig:    *sm.Com.Ack,
+		V_hat:  sm.Com.V_hat,
+		X_hat:  sm.Com.X_hat,
+		MTRoot: sm.Com.MTRoot}
+	return nil
+}
+
+// Commitment of a child we leave out after it committed, with our receipt
+func (sn *Node) exceptCommit(view int, child string, key abstract.Point, ack *CommitAck) *ExceptedCommit {
+	return &ExceptedCommit{
+		View:      view,
+		Name:      child,
+		Key:       key,
+		V_hat:     ack.V_hat,
+		X_hat:     ack.X_hat,
+		MTRoot:    ack.MTRoot,
+		Ack:       ack.Sig,
+		ParentKey: sn.PubKey,
+		Receipt:   ElGamalSign(sn.suite, random.Stream, ack.Digest, sn.PrivKey)}
+}
+
+// Receipt for the commitment of child, nil if it did not commit
+func (sn *Node) commitReceipt(Round int, child string) *BasicSig {
+	round := sn.GetRound(Round)
+	if round == nil {
+		return nil
+	}
+	ack, ok := round.Acks[child]
+	if !ok {
+		return nil
+	}
+	sig := ElGamalSign(sn.suite, random.Stream, ack.Digest, sn.PrivKey)
+	return &sig
+}
+
+// Send the child the receipt of the response we counted for it
+func (sn *Node) ackResponse(view int, sm *SigningMessage) {
+	digest := ResponseDigest(sn.suite, view, sm.Rm.Round, sm.From,
+		sm.Rm.R_hat, sm.Rm.ExceptionV_hat, sm.Rm.ExceptionX_hat)
+	ra := &ResponseAckMessage{
+		Round: sm.Rm.Round,
+		Sig:   ElGamalSign(sn.suite, random.Stream, digest, sn.PrivKey)}
+	go func(to string) {
+		err := sn.PutTo(context.TODO(), to, &SigningMessage{
+			Type:         ResponseAck,
+			View:         view,
+			From:         sn.Name(),
+			LastSeenVote: int(atomic.LoadInt64(&sn.LastSeenVote)),
+			Ra:           ra})
+		if err != nil {
+			log.Errorln(sn.Name(), "failed to send response receipt to", to, ":", err)
+		}
+	}(sm.From)
+}
+
+// Keep the receipt of our parent if it matches the response we sent
+func (sn *Node) keepResponseReceipt(view int, ra *ResponseAckMessage) {
+	if ra == nil {
+		return
+	}
+	round := sn.GetRound(ra.Round)
+	if round == nil || round.sent == nil || round.sent.rm == nil {
+		return
+	}
+	parent := sn.Peers()[sn.Parent(view)]
+	if parent == nil {
+		return
+	}
+	rm := round.sent.rm
+	digest := ResponseDigest(sn.suite, view, ra.Round, sn.Name(), rm.R_hat, rm.ExceptionV_hat, rm.ExceptionX_hat)
+	if err := ElGamalVerify(sn.suite, digest, parent.PubKey(), ra.Sig); err != nil {
+		log.Warnln(sn.Name(), "invalid response receipt from parent:", err)
+		return
+	}
+	round.ResponseReceipt = &ra.Sig
+}
+
+// Keep the receipt of our parent if it matches what we committed
+func (sn *Node) keepReceipt(view int, round *Round, receipt *BasicSig) {
+	if receipt == nil || round.sent == nil {
+		return
+	}
+	parent := sn.Peers()[sn.Parent(view)]
+	if parent == nil {
+		return
+	}
+	if err := ElGamalVerify(sn.suite, round.sent.digest, parent.PubKey(), *receipt); err != nil {
+		log.Warnln(sn.Name(), "invalid commit receipt from parent:", err)
+		return
+	}
+	round.Receipt = receipt
+}
+
+// Exceptions of the last round finished as root, to announce
+func (sn *Node) announcedExceptions() *RoundExceptions {
+	sn.complaintmu.Lock()
+	defer sn.complaintmu.Unlock()
+	return sn.lastExceptions
+}
+
+func (sn *Node) setLastExceptions(view, Round int, el []abstract.Point) {
+	sn.complaintmu.Lock()
+	sn.lastExceptions = &RoundExceptions{View: view, Round: Round, ExceptionList: el}
+	sn.complaintmu.Unlock()
+}
+
+// Record the announced exceptions of a round and complain if we were
+// excepted although we responded
+func (sn *Node) checkExcluded(re *RoundExceptions) {
+	if re == nil {
+		return
+	}
+	round := sn.GetRound(re.Round)
+	if round == nil {
+		return
+	}
+	// the root can only announce the exceptions the group signed
+	if rr := sn.SignedRound(re.Round); rr == nil || !samePoints(rr.ExceptionList, re.ExceptionList) {
+		log.Warnln(sn.Name(), "announced exceptions of round", re.Round, "do not match its signed record")
+		return
+	}
+	round.FinalExceptions = re.ExceptionList
+	if round.sent == nil || round.sent.rm == nil || round.Receipt == nil {
+		return
+	}
+	if round.Refused || !containsPoint(re.ExceptionList, sn.PubKey) {
+		return
+	}
+
+	parent := sn.Peers()[sn.Parent(round.sent.view)]
+	if parent == nil {
+		return
+	}
+	rm := round.sent.rm
+	cm := &ComplaintMessage{
+		View:           round.sent.view,
+		Round:          re.Round,
+		Accuser:        sn.Name(),
+		AccuserKey:     sn.PubKey,
+		Accused:        parent.Name(),
+		AccusedKey:     parent.PubKey(),
+		V_hat:          round.sent.V_hat,
+		X_hat:          round.sent.X_hat,
+		MTRoot:         round.sent.MTRoot,
+		Receipt:        *round.Receipt,
+		R_hat:          rm.R_hat,
+		ExceptionV_hat: rm.ExceptionV_hat,
+		ExceptionX_hat: rm.ExceptionX_hat,
+		Sent:           round.sent.at.UnixNano(),
+
+		ResponseReceipt: round.ResponseReceipt}
+	cm.Sig = ElGamalSign(sn.suite, random.Stream, cm.Digest(sn.suite), sn.PrivKey)
+
+	log.Warnln(sn.Name(), "excepted from round", re.Round, "after responding: complaining about", cm.Accused)
+	if cm.ResponseReceipt == nil {
+		sn.sendComplaint(sn.RootFor(cm.View), cm)
+		return
+	}
+	if sn.recordComplaint(cm) {
+		sn.publishComplaint(cm, "")
+	}
+}
+
+// Check the signatures of a complaint and that the response it holds is
+// valid for challenge c: a complaint that passes shows the accused
+// acknowledged both the commitment and the valid response of the accuser.
+func CheckComplaint(suite abstract.Suite, c abstract.Secret, cm *ComplaintMessage) error {
+	if cm.ResponseReceipt == nil {
+		return errors.New("invalid complaint: no response receipt")
+	}
+	digest := ResponseDigest(suite, cm.View, cm.Round, cm.Accuser, cm.R_hat, cm.ExceptionV_hat, cm.ExceptionX_hat)
+	if err := ElGamalVerify(suite, digest, cm.AccusedKey, *cm.ResponseReceipt); err != nil {
+		return errors.New("invalid complaint: response receipt not signed by accused")
+	}
+	return checkResponse(suite, c, cm)
+}
+
+// Check a complaint holding no response receipt: its response must be
+// valid for challenge c and sent before deadline, when the root of the
+// round stopped waiting for responses.
+func CheckUnackedComplaint(suite abstract.Suite, c abstract.Secret, cm *ComplaintMessage, deadline time.Time) error {
+	if cm.Sent <= 0 || time.Unix(0, cm.Sent).After(deadline) {
+		return errors.New("invalid complaint: response sent after the round ended")
+	}
+	return checkResponse(suite, c, cm)
+}
+
+// Check the signature of the accuser on a complaint, the commitment
+// receipt of the accused and that the response matches the commitment
+func checkResponse(suite abstract.Suite, c abstract.Secret, cm *ComplaintMessage) error {
+	if cm.AccuserKey == nil || cm.AccusedKey == nil || cm.V_hat == nil ||
+		cm.X_hat == nil || cm.R_hat == nil || c == nil {
+		return ErrInvalidComplaint
+	}
+	if err := ElGamalVerify(suite, cm.Digest(suite), cm.AccuserKey, cm.Sig); err != nil {
+		return ErrInvalidComplaint
+	}
+	digest := CommitDigest(suite, cm.View, cm.Round, cm.Accuser, cm.V_hat, cm.X_hat, cm.MTRoot)
+	if err := ElGamalVerify(suite, digest, cm.AccusedKey, cm.Receipt); err != nil {
+		return errors.New("invalid complaint: receipt not signed by accused")
+	}
+
+	// base**r_hat * (X_hat - exceptions)**c * exception commits == V_hat
+	X := suite.Point().Null()
+	X.Add(X, cm.X_hat)
+	if cm.ExceptionX_hat != nil {
+		X.Sub(X, cm.ExceptionX_hat)
+	}
+	T := suite.Point().Mul(nil, cm.R_hat)
+	T.Add(T, X.Mul(X, c))
+	if cm.ExceptionV_hat != nil {
+		T.Add(T, cm.ExceptionV_hat)
+	}
+	if !T.Equal(cm.V_hat) {
+		return errors.New("invalid complaint: response does not match commitment")
+	}
+	return nil
+}
+
+// Check a complaint against what we saw of its round
+func (sn *Node) VerifyComplaint(cm *ComplaintMessage) error {
+	if cm.Accuser == cm.Accused {
+		return ErrInvalidComplaint
+	}
+	round := sn.GetRound(cm.Round)
+	if round == nil || round.c == nil {
+		return errors.New("unable to verify complaint: round unknown")
+	}
+	if !containsPoint(round.FinalExceptions, cm.AccuserKey) {
+		return errors.New("invalid complaint: accuser was not excepted")
+	}
+	// bind names to the keys of the hosts we know
+	if k := sn.keyOf(cm.Accuser); k == nil || !k.Equal(cm.AccuserKey) {
+		return errors.New("invalid complaint: unknown or wrong key for accuser")
+	}
+	if k := sn.keyOf(cm.Accused); k == nil || !k.Equal(cm.AccusedKey) {
+		return errors.New("invalid complaint: unknown or wrong key for accused")
+	}
+	if cm.ResponseReceipt == nil {
+		// only the root knows when it stopped waiting for responses
+		if !sn.IsRoot(cm.View) || round.done.IsZero() {
+			return errors.New("unable to verify complaint: no response receipt")
+		}
+		return CheckUnackedComplaint(sn.suite, round.c, cm, round.done)
+	}
+	return CheckComplaint(sn.suite, round.c, cm)
+}
+
+// Handle a complaint received from a peer
+func (sn *Node) handleComplaint(from string, cm *ComplaintMessage) {
+	if cm == nil {
+		return
+	}
+	if err := sn.VerifyComplaint(cm); err != nil {
+		log.Warnln(sn.Name(), "rejected complaint from", from, ":", err)
+		return
+	}
+	if sn.recordComplaint(cm) {
+		log.Warnln(sn.Name(), "accepted complaint of", cm.Accuser, "against", cm.Accused, "on round", cm.Round)
+		// others can not check complaints without response receipt
+		if cm.ResponseReceipt != nil {
+			sn.publishComplaint(cm, from)
+		}
+	}
+}
+
+// Keep a verified complaint, returns false if it was already known
+func (sn *Node) recordComplaint(cm *ComplaintMessage) bool {
+	sn.complaintmu.Lock()
+	defer sn.complaintmu.Unlock()
+	for _, known := range sn.complaints[cm.Accused] {
+		if known.Round == cm.Round && known.Accuser == cm.Accuser {
+			return false
+		}
+	}
+	sn.complaints[cm.Accused] = append(sn.complaints[cm.Accused], cm)
+	return true
+}
+
+// Send a complaint to all our peers but the accused and the peer we got it from
+func (sn *Node) publishComplaint(cm *ComplaintMessage, from string) {
+	for name := range sn.Peers() {
+		if name == cm.Accused || name == from {
+			continue
+		}
+		sn.sendComplaint(name, cm)
+	}
+}
+
+func (sn *Node) sendComplaint(to string, cm *ComplaintMessage) {
+	go func() {
+		err := sn.PutTo(context.TODO(), to, &SigningMessage{
+			Type:         Complaint,
+			View:         cm.View,
+			From:         sn.Name(),
+			LastSeenVote: int(atomic.LoadInt64(&sn.LastSeenVote)),
+			Cm:           cm})
+		if err != nil {
+			log.Errorln(sn.Name(), "failed to send complaint to", to, ":", err)
+		}
+	}()
+}
+
+// Returns the verified complaints against name
+func (sn *Node) Complaints(name string) []*ComplaintMessage {
+	sn.complaintmu.Lock()
+	defer sn.complaintmu.Unlock()
+	cms := make([]*ComplaintMessage, len(sn.complaints[name]))
+	copy(cms, sn.complaints[name])
+	return cms
+}
+
+// Whether name excluded children that responded on at least
+// CensorThreshold rounds. Children that crashed or withheld their
+// response hold no valid one, so they never count against their parent.
+func (sn *Node) Censoring(name string) bool {
+	sn.complaintmu.Lock()
+	defer sn.complaintmu.Unlock()
+	rounds := make(map[int]bool)
+	for _, cm := range sn.complaints[name] {
+		rounds[cm.Round] = true
+	}
+	return len(rounds) >= CensorThreshold
+}
+
+// Public key of a host, nil if we do not know it
+func (sn *Node) keyOf(name string) abstract.Point {
+	if name == sn.Name() {
+		return sn.PubKey
+	}
+	if p, ok := sn.Peers()[name]; ok && p.PubKey() != nil {
+		return p.PubKey()
+	}
+	return sn.peerKeys[name]
+}
+
+func containsPoint(ps []abstract.Point, p abstract.Point) bool {
+	if p == nil {
+		return false
+	}
+	for _, q := range ps {
+		if q != nil && q.Equal(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether a and b hold the same points
+func samePoints(a, b []abstract.Point) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, p := range a {
+		if !containsPoint(b, p) {
+			return false
+		}
+	}
+	return true
+}
+
+// Append the points of ps not already in el
+func addExceptions(el []abstract.Point, ps ...abstract.Point) []abstract.Point {
+	for _, p := range ps {
+		if p != nil && !containsPoint(el, p) {
+			el = append(el, p)
+		}
+	}
+	return el
+}
+
+// Public keys of the subtree of the child that sent commitment sm.
+// Outside of Threshold mode the keys must add up to the child's X_hat,
+// otherwise only the key of the child itself is known.
+func (sn *Node) subtreeKeys(sm *SigningMessage, key abstract.Point) []abstract.Point {
+	if key == nil || !containsPoint(sm.Com.Keys, key) {
+		return []abstract.Point{key}
+	}
+	if sn.Type != Threshold {
+		X := sn.suite.Point().Null()
+		for _, k := range sm.Com.Keys {
+			sn.add(X, k)
+		}
+		if sm.Com.X_hat == nil || !X.Equal(sm.Com.X_hat) {
+			return []abstract.Point{key}
+		}
+	}
+	return sm.Com.Keys
+}
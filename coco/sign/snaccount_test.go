@@ -0,0 +1,113 @@
+package sign_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/crypto/nist"
+	"github.com/dedis/crypto/random"
+	"github.com/dedis/prifi/coco/sign"
+)
+
+// A leaf whose correct response was acknowledged can complain about its
+// parent, and the complaint no longer checks once its response is altered
+func TestCheckComplaint(t *testing.T) {
+	suite := nist.NewAES128SHA256P256()
+	x := suite.Secret().Pick(random.Stream) // leaf key
+	p := suite.Secret().Pick(random.Stream) // parent key
+	v := suite.Secret().Pick(random.Stream) // leaf commit
+	c := suite.Secret().Pick(random.Stream) // collective challenge
+
+	cm := &sign.ComplaintMessage{
+		View:       0,
+		Round:      1,
+		Accuser:    "leaf",
+		AccuserKey: suite.Point().Mul(nil, x),
+		Accused:    "parent",
+		AccusedKey: suite.Point().Mul(nil, p),
+		V_hat:      suite.Point().Mul(nil, v),
+		X_hat:      suite.Point().Mul(nil, x)}
+	digest := sign.CommitDigest(suite, cm.View, cm.Round, cm.Accuser, cm.V_hat, cm.X_hat, cm.MTRoot)
+	cm.Receipt = sign.ElGamalSign(suite, random.Stream, digest, p)
+
+	// r = v - xc
+	cm.R_hat = suite.Secret().Mul(x, c)
+	cm.R_hat.Sub(v, cm.R_hat)
+	cm.Sig = sign.ElGamalSign(suite, random.Stream, cm.Digest(suite), x)
+
+	// a leaf that withheld its response holds no receipt for it
+	if err := sign.CheckComplaint(suite, c, cm); err == nil {
+		t.Fatal("complaint accepted without response receipt")
+	}
+
+	rdigest := sign.ResponseDigest(suite, cm.View, cm.Round, cm.Accuser, cm.R_hat, nil, nil)
+	receipt := sign.ElGamalSign(suite, random.Stream, rdigest, p)
+	cm.ResponseReceipt = &receipt
+	if err := sign.CheckComplaint(suite, c, cm); err != nil {
+		t.Fatal("valid complaint rejected:", err)
+	}
+
+	// nor can it forge one
+	forged := sign.ElGamalSign(suite, random.Stream, rdigest, x)
+	cm.ResponseReceipt = &forged
+	if err := sign.CheckComplaint(suite, c, cm); err == nil {
+		t.Fatal("complaint accepted with forged response receipt")
+	}
+	cm.ResponseReceipt = &receipt
+
+	// a response to another challenge does not prove anything
+	other := suite.Secret().Pick(random.Stream)
+	if err := sign.CheckComplaint(suite, other, cm); err == nil {
+		t.Fatal("complaint accepted for wrong challenge")
+	}
+
+	// a receipt not signed by the accused is rejected
+	cm.Receipt = sign.ElGamalSign(suite, random.Stream, digest, x)
+	cm.Sig = sign.ElGamalSign(suite, random.Stream, cm.Digest(suite), x)
+	if err := sign.CheckComplaint(suite, c, cm); err == nil {
+		t.Fatal("complaint accepted with forged receipt")
+	}
+}
+
+// A leaf whose response was never acknowledged complains to the root with
+// the time it sent its response, which must precede the end of the round
+func TestCheckUnackedComplaint(t *testing.T) {
+	suite := nist.NewAES128SHA256P256()
+	x := suite.Secret().Pick(random.Stream) // leaf key
+	p := suite.Secret().Pick(random.Stream) // parent key
+	v := suite.Secret().Pick(random.Stream) // leaf commit
+	c := suite.Secret().Pick(random.Stream) // collective challenge
+	sent := time.Now()
+
+	cm := &sign.ComplaintMessage{
+		View:       0,
+		Round:      1,
+		Accuser:    "leaf",
+		AccuserKey: suite.Point().Mul(nil, x),
+		Accused:    "parent",
+		AccusedKey: suite.Point().Mul(nil, p),
+		V_hat:      suite.Point().Mul(nil, v),
+		X_hat:      suite.Point().Mul(nil, x),
+		Sent:       sent.UnixNano()}
+	digest := sign.CommitDigest(suite, cm.View, cm.Round, cm.Accuser, cm.V_hat, cm.X_hat, cm.MTRoot)
+	cm.Receipt = sign.ElGamalSign(suite, random.Stream, digest, p)
+	cm.R_hat = suite.Secret().Mul(x, c)
+	cm.R_hat.Sub(v, cm.R_hat)
+	cm.Sig = sign.ElGamalSign(suite, random.Stream, cm.Digest(suite), x)
+
+	if err := sign.CheckComplaint(suite, c, cm); err == nil {
+		t.Fatal("complaint accepted without response receipt")
+	}
+	if err := sign.CheckUnackedComplaint(suite, c, cm, sent.Add(time.Second)); err != nil {
+		t.Fatal("valid complaint rejected:", err)
+	}
+	if err := sign.CheckUnackedComplaint(suite, c, cm, sent.Add(-time.Second)); err == nil {
+		t.Fatal("complaint accepted for a response sent after the round ended")
+	}
+
+	// the time is signed by the accuser
+	cm.Sent = sent.Add(-time.Minute).UnixNano()
+	if err := sign.CheckUnackedComplaint(suite, c, cm, sent.Add(-time.Second)); err == nil {
+		t.Fatal("complaint accepted with altered time")
+	}
+}
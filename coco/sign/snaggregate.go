@@ -0,0 +1,219 @@
+package sign
+
+import (
+	"errors"
+	"sort"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/dedis/crypto/abstract"
+)
+
+// Application defined aggregation
+//
+// Besides the Schnorr commitments, every node can contribute a value to a
+// signing round. AggregateFunc gives the value of the node, CombineFunc
+// merges it with the aggregates of its children on the way up: counts,
+// sums, min/max or Bloom filters. Each node combines its own value first,
+// then those of its children sorted by name, so combine needs only be
+// associative. Values of children left out of the commitment are left out
+// of the aggregate; values of nodes that fail to respond afterwards stay.
+// The root hashes the aggregate of the whole tree into the challenge, so
+// the collective signature covers it, and hands it to the
+// AggregateDoneFunc as a SignedAggregate anyone holding the public keys
+// of the group can check, as long as at least the given number of them,
+// a majority by default, signed. The root sends the aggregate down with the
+// challenge: signers check the challenge was computed from it and hand it
+// to their AggregateCheckFunc, refusing to sign, and excepting themselves
+// from the round, if it fails. In PubKey mode signers do not know the
+// message of the root and only check the aggregate.
+
+// Returns the value of the node for round Round
+type AggregateFunc func(view, Round int) []byte
+
+// Merges two aggregates, must be associative
+type CombineFunc func(a, b []byte) []byte
+
+// Called on the root with the signed aggregate of every signing round
+type AggregateDoneFunc func(view int, sa *SignedAggregate)
+
+// Called on signers with the aggregate of the whole tree before they
+// sign round Round, an error refuses to sign it
+type AggregateCheckFunc func(view, Round int, aggregate []byte) error
+
+// Aggregate of a round with the collective signature covering it
+type SignedAggregate struct {
+	Round     int
+	Aggregate []byte
+	Message   []byte // message signed along with the aggregate
+
+	C              abstract.Secret // collective challenge
+	R_hat          abstract.Secret // aggregate response
+	X_hat          abstract.Point  // aggregate key of the nodes that responded
+	V_hat          abstract.Point  // aggregate commitment
+	ExceptionV_hat abstract.Point  // commitments of nodes that did not respond
+	ExceptionList  []abstract.Point
+
+	ExceptedCommits []*ExceptedCommit // signed commitments in ExceptionV_hat
+}
+
+func (sn *Node) RegisterAggregator(af AggregateFunc, cf CombineFunc) {
+	sn.aggmu.Lock()
+	sn.AggregateFunc = af
+	sn.CombineFunc = cf
+	sn.aggmu.Unlock()
+}
+
+func (sn *Node) RegisterAggregateDoneFunc(adf AggregateDoneFunc) {
+	sn.aggmu.Lock()
+	sn.AggregateDoneFunc = adf
+	sn.aggmu.Unlock()
+}
+
+func (sn *Node) RegisterAggregateCheckFunc(acf AggregateCheckFunc) {
+	sn.aggmu.Lock()
+	sn.AggregateCheckFunc = acf
+	sn.aggmu.Unlock()
+}
+
+// Check the aggregate the root sent with its challenge, *not* called by the root
+func (sn *Node) checkAggregate(view int, chm *ChallengeMessage) error {
+	sn.aggmu.Lock()
+	acf := sn.AggregateCheckFunc
+	sn.aggmu.Unlock()
+	if acf == nil {
+		return nil
+	}
+	if sn.Type != PubKey {
+		m := aggregateMessage(sn.suite, chainMessage(chm.Round, chm.MTRoot, chm.BackLink), chm.Aggregate)
+		if chm.V_hat == nil || chm.C == nil || !hashElGamal(sn.suite, m, chm.V_hat).Equal(chm.C) {
+			return ErrForeignAggregate
+		}
+	}
+	return acf(view, chm.Round, chm.Aggregate)
+}
+
+// Combine our value with the aggregates of the children we kept
+func (sn *Node) combineAggregates(view, Round int, round *Round, children map[string][]byte) {
+	sn.aggmu.Lock()
+	af, cf := sn.AggregateFunc, sn.CombineFunc
+	sn.aggmu.Unlock()
+	if af == nil || cf == nil {
+		return
+	}
+
+	agg := af(view, Round)
+	names := make([]string, 0, len(children))
+	for name := range children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if children[name] != nil {
+			agg = cf(agg, children[name])
+		}
+	}
+	round.Aggregate = agg
+}
+
+// Message the challenge of a round is computed from: the announced
+// message or Merkle root chained to the previous round, and the digest
+// of the aggregate if any
+func aggregateMessage(suite abstract.Suite, message, aggregate []byte) []byte {
+	if aggregate == nil {
+		return message
+	}
+	h := suite.Hash()
+	h.Write(aggregate)
+	m := make([]byte, 0, len(message)+h.Size())
+	m = append(m, message...)
+	return append(m, h.Sum(nil)...)
+}
+
+// Message signed by the root for a round
+func (sn *Node) challengeMessage(Round int, round *Round) []byte {
+	message := chainMessage(Round, sn.roundMessage(round), round.BackLink)
+	return aggregateMessage(sn.suite, message, round.Aggregate)
+}
+
+// Called on the root once the responses of a round were verified
+func (sn *Node) aggregateDone(view, Round int) {
+	sn.aggmu.Lock()
+	adf := sn.AggregateDoneFunc
+	sn.aggmu.Unlock()
+	round := sn.GetRound(Round)
+	if adf == nil || round == nil || round.Aggregate == nil {
+		return
+	}
+
+	adf(view, &SignedAggregate{
+		Round:           Round,
+		Aggregate:       round.Aggregate,
+		Message:         chainMessage(Round, sn.roundMessage(round), round.BackLink),
+		C:               round.c,
+		R_hat:           round.r_hat,
+		X_hat:           round.X_hat,
+		V_hat:           round.Log.V_hat,
+		ExceptionV_hat:  round.exceptionV_hat,
+		ExceptionList:   round.ExceptionList,
+		ExceptedCommits: round.ExceptedCommits})
+	log.Println(sn.Name(), "signed aggregate of round", Round)
+}
+
+// Aggregate of the keys of the group but the exceptions: the key the
+// collective signature of a round with these exceptions verifies under.
+// At least min keys must be left, a majority of the group if min is 0.
+func SignersKey(suite abstract.Suite, keys, exceptions []abstract.Point, min int) (abstract.Point, error) {
+	X := suite.Point().Null()
+	for _, k := range keys {
+		X.Add(X, k)
+	}
+	for i, e := range exceptions {
+		if !containsPoint(keys, e) {
+			return nil, errors.New("exception outside of the group")
+		}
+		if containsPoint(exceptions[:i], e) {
+			return nil, errors.New("exception listed twice")
+		}
+		X.Sub(X, e)
+	}
+	if min <= 0 {
+		min = len(keys)/2 + 1
+	}
+	if len(keys)-len(exceptions) < min {
+		return nil, ErrTooFewSigners
+	}
+	return X, nil
+}
+
+// Check that the collective signature of sa, by at least min of the
+// public keys but the exceptions of sa, covers its aggregate.
+// min is a majority of the keys if 0.
+func VerifyAggregate(suite abstract.Suite, sa *SignedAggregate, keys []abstract.Point, min int) error {
+	X, err := SignersKey(suite, keys, sa.ExceptionList, min)
+	if err != nil {
+		return err
+	}
+	if sa.X_hat != nil && !X.Equal(sa.X_hat) {
+		return errors.New("aggregate not signed by the group")
+	}
+	if err := verifyExceptedCommits(suite, sa.Round, keys, sa.ExceptionList,
+		sa.ExceptionV_hat, sa.ExceptedCommits); err != nil {
+		return err
+	}
+	c := hashElGamal(suite, aggregateMessage(suite, sa.Message, sa.Aggregate), sa.V_hat)
+	if !c.Equal(sa.C) {
+		return errors.New("aggregate not covered by the challenge")
+	}
+
+	// base**r_hat * X_hat**c * exceptions == V_hat
+	T := suite.Point().Mul(nil, sa.R_hat)
+	T.Add(T, suite.Point().Mul(X, sa.C))
+	if sa.ExceptionV_hat != nil {
+		T.Add(T, sa.ExceptionV_hat)
+	}
+	if !T.Equal(sa.V_hat) {
+		return errors.New("invalid collective signature on aggregate")
+	}
+	return nil
+}
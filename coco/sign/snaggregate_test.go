@@ -0,0 +1,160 @@
+package sign_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dedis/crypto/abstract"
+	"github.com/dedis/prifi/coco/sign"
+	"github.com/dedis/prifi/coco/test/oldconfig"
+)
+
+// Every node counts itself, the root gets the size of the tree
+func TestTreeSmallConfigAggregate(t *testing.T) {
+	hc, err := oldconfig.LoadConfig("../test/data/exconf.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	one := func(view, Round int) []byte {
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint64(b, 1)
+		return b
+	}
+	sum := func(a, b []byte) []byte {
+		s := make([]byte, 8)
+		binary.BigEndian.PutUint64(s, binary.BigEndian.Uint64(a)+binary.BigEndian.Uint64(b))
+		return s
+	}
+	for _, sn := range hc.SNodes {
+		sn.RegisterAggregator(one, sum)
+	}
+	done := make(chan *sign.SignedAggregate, 1)
+	hc.SNodes[0].RegisterAggregateDoneFunc(func(view int, sa *sign.SignedAggregate) { done <- sa })
+
+	err = hc.Run(false, sign.MerkleTree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sn := range hc.SNodes {
+		defer sn.Close()
+	}
+
+	hc.SNodes[0].LogTest = []byte("Hello Aggregate")
+	hc.SNodes[0].StartAnnouncement(&sign.AnnouncementMessage{LogTest: hc.SNodes[0].LogTest, Round: 1})
+
+	var sa *sign.SignedAggregate
+	select {
+	case sa = <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("no signed aggregate")
+	}
+	if n := binary.BigEndian.Uint64(sa.Aggregate); n != uint64(len(hc.SNodes)) {
+		t.Fatal("aggregate counted", n, "nodes out of", len(hc.SNodes))
+	}
+	suite := hc.SNodes[0].Suite()
+	keys := make([]abstract.Point, 0)
+	for _, sn := range hc.SNodes {
+		keys = append(keys, sn.PubKey)
+	}
+	if err := sign.VerifyAggregate(suite, sa, keys, 0); err != nil {
+		t.Fatal("signed aggregate rejected:", err)
+	}
+
+	// the signature binds the keys of the group
+	if err := sign.VerifyAggregate(suite, sa, keys[1:], 0); err == nil {
+		t.Fatal("signature accepted for a smaller group")
+	}
+	X_hat := sa.X_hat
+	sa.X_hat = keys[0]
+	if err := sign.VerifyAggregate(suite, sa, keys[:1], 0); err == nil {
+		t.Fatal("signature accepted for a key of the message")
+	}
+	sa.X_hat = X_hat
+
+	sa.Aggregate = sum(sa.Aggregate, sa.Aggregate)
+	if err := sign.VerifyAggregate(suite, sa, keys, 0); err == nil {
+		t.Fatal("signature accepted for another aggregate")
+	}
+}
+
+// Signers check the aggregate of the root before signing it, a signer
+// refusing it is excepted from the round
+func TestAggregateCheck(t *testing.T) {
+	hc, err := oldconfig.LoadConfig("../test/data/exconf.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	concat := func(a, b []byte) []byte {
+		return append(append([]byte{}, a...), b...)
+	}
+	refuser := hc.SNodes[len(hc.SNodes)-1]
+	var mu sync.Mutex
+	checked := make(map[string][]byte)
+	for _, sn := range hc.SNodes {
+		name := sn.Name()
+		sn.RegisterAggregator(func(view, Round int) []byte { return []byte(name) }, concat)
+		sn.RegisterAggregateCheckFunc(func(view, Round int, aggregate []byte) error {
+			mu.Lock()
+			checked[name] = aggregate
+			mu.Unlock()
+			if name == refuser.Name() {
+				return errors.New("refused")
+			}
+			return nil
+		})
+	}
+	root := hc.SNodes[0]
+	done := make(chan *sign.SignedAggregate, 1)
+	root.RegisterAggregateDoneFunc(func(view int, sa *sign.SignedAggregate) { done <- sa })
+
+	if err = hc.Run(false, sign.MerkleTree); err != nil {
+		t.Fatal(err)
+	}
+	for _, sn := range hc.SNodes {
+		defer sn.Close()
+	}
+
+	root.LogTest = []byte("Hello Aggregate Check")
+	root.StartAnnouncement(&sign.AnnouncementMessage{LogTest: root.LogTest, Round: 1})
+
+	var sa *sign.SignedAggregate
+	select {
+	case sa = <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("no signed aggregate")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := checked[root.Name()]; ok {
+		t.Fatal("root checked its own aggregate")
+	}
+	for _, sn := range hc.SNodes[1:] {
+		if !bytes.Equal(checked[sn.Name()], sa.Aggregate) {
+			t.Fatal(sn.Name(), "checked another aggregate than the one signed")
+		}
+	}
+	if len(sa.ExceptionList) != 1 || !sa.ExceptionList[0].Equal(refuser.PubKey) {
+		t.Fatal("refusing signer not excepted from the round")
+	}
+	if len(sa.ExceptedCommits) != 0 {
+		t.Fatal("refusing signer took its commitment out of the signature")
+	}
+	keys := make([]abstract.Point, 0)
+	for _, sn := range hc.SNodes {
+		keys = append(keys, sn.PubKey)
+	}
+	if err := sign.VerifyAggregate(root.Suite(), sa, keys, 0); err != nil {
+		t.Fatal("signed aggregate rejected:", err)
+	}
+	// unless every host must sign
+	if err := sign.VerifyAggregate(root.Suite(), sa, keys, len(keys)); err != sign.ErrTooFewSigners {
+		t.Fatal("aggregate accepted without the signature of every host")
+	}
+}
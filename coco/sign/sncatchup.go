@@ -0,0 +1,366 @@
+package sign
+
+import (
+	"errors"
+	"sort"
+	"sync/atomic"
+
+	log "github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+
+	"github.com/dedis/crypto/abstract"
+	"github.com/dedis/crypto/random"
+	"github.com/dedis/protobuf"
+)
+
+// Catching up on votes
+//
+// Peers answer catch up requests with a batch of up to MaxCatchUpBatch
+// votes. Nodes far behind, or asking for votes their peer replaced by a
+// snapshot, get the snapshot of the peer's state first: the hostlist,
+// root and failed roots of its view, votes pending for later views and
+// the last vote it applied. The snapshot is signed by the peer, carries
+// the certificates of its last vote and of the view change that made its
+// root, and is checked before being installed. Every node also replaces
+// the votes it applied by a snapshot of its own every SnapshotInterval
+// votes, which compacts the vote log kept on disk.
+
+// votes applied between two snapshots of a node's own state
+const SnapshotInterval = 128
+
+// State of a node after applying the votes up to LastVote
+type Snapshot struct {
+	LastVote int // last vote applied to the state
+
+	View        int          // view of the node
+	Root        string       // root of the view
+	HostList    []string     // hosts on the view
+	FailedRoots []FailedRoot // failed roots agreed on, see snroot.go
+	Pending     []*Vote      // confirmed votes acting on later views
+
+	LastCert *VoteCertificate // certificate of vote LastVote
+	RootCert *VoteCertificate // certificate of the view change to View, nil on view 0
+
+	From string   // node that took the snapshot
+	Sig  BasicSig // signature of From on the snapshot
+}
+
+func (s *Snapshot) Encode() ([]byte, error) {
+	return protobuf.Encode(s)
+}
+
+// Digest of a snapshot, without its signature
+func (s *Snapshot) Digest(suite abstract.Suite) ([]byte, error) {
+	sc := *s
+	sc.Sig = BasicSig{}
+	b, err := sc.Encode()
+	if err != nil {
+		return nil, err
+	}
+	h := suite.Hash()
+	h.Write(b)
+	return h.Sum(nil), nil
+}
+
+// Take a signed snapshot of our state
+func (sn *Node) TakeSnapshot() (*Snapshot, error) {
+	sn.viewmu.Lock()
+	view := sn.ViewNo
+	sn.viewmu.Unlock()
+
+	s := &Snapshot{
+		LastVote:    int(atomic.LoadInt64(&sn.LastAppliedVote)),
+		View:        view,
+		Root:        sn.RootFor(view),
+		HostList:    sn.HostListOn(view),
+		FailedRoots: sn.failedRootsFor(view + 1),
+		From:        sn.Name()}
+
+	// certificates of the last vote and of the view change to our view,
+	// taken from our last snapshot once the votes were replaced by it
+	sn.VoteLog.mu.Lock()
+	last := sn.VoteLog.Snap
+	sn.VoteLog.mu.Unlock()
+	if s.LastVote > 0 {
+		if cert, err := sn.Certificate(s.LastVote); err == nil {
+			s.LastCert = cert
+		} else if last != nil && last.LastVote == s.LastVote {
+			s.LastCert = last.LastCert
+		} else {
+			return nil, errors.New("no certificate of our last vote")
+		}
+	}
+	for i := s.LastVote; i > 0 && s.RootCert == nil; i-- {
+		cert, err := sn.Certificate(i)
+		if err == nil && cert.Vote.Type == ViewChangeVT && cert.Vote.Vcv.View == view {
+			s.RootCert = cert
+		}
+	}
+	if s.RootCert == nil && last != nil && last.View == view {
+		s.RootCert = last.RootCert
+	}
+
+	pending := sn.actionsAfter(view)
+	views := make([]int, 0)
+	for v := range pending {
+		views = append(views, v)
+	}
+	sort.Ints(views)
+	for _, v := range views {
+		s.Pending = append(s.Pending, pending[v]...)
+	}
+
+	b, err := s.Digest(sn.suite)
+	if err != nil {
+		return nil, err
+	}
+	s.Sig = ElGamalSign(sn.suite, random.Stream, b, sn.PrivKey)
+	return s, nil
+}
+
+// Check a snapshot received from a peer
+func (sn *Node) VerifySnapshot(s *Snapshot) error {
+	key := sn.keyOf(s.From)
+	if key == nil {
+		return errors.New("snapshot from unknown host: " + s.From)
+	}
+	b, err := s.Digest(sn.suite)
+	if err != nil {
+		return err
+	}
+	if err := ElGamalVerify(sn.suite, b, key, s.Sig); err != nil {
+		return errors.New("invalid snapshot signature")
+	}
+
+	// the group must have gone as far as the snapshot claims
+	if s.LastVote > int(atomic.LoadInt64(&sn.LastSeenVote)) {
+		return errors.New("snapshot ahead of votes seen")
+	}
+	if s.LastVote > 0 {
+		if s.LastCert == nil || s.LastCert.Vote == nil || s.LastCert.Vote.Index != s.LastVote {
+			return errors.New("snapshot without certificate of its last vote")
+		}
+		// the vote was taken on the hosts of the snapshot, or made them
+		if !sameHosts(s.LastCert.HostList, s.HostList) &&
+			!sameHosts(hostsAfter(s.LastCert.HostList, s.LastCert.Vote), s.HostList) {
+			return errors.New("snapshot hosts do not match its certificate")
+		}
+		if err := sn.verifyCertificate(s.LastCert); err != nil {
+			return err
+		}
+	}
+	// the root is the one the group agreed on for the view
+	if s.View == 0 {
+		if s.Root != sn.RootFor(0) {
+			return errors.New("snapshot root is not the root of view 0")
+		}
+	} else {
+		c := s.RootCert
+		if c == nil || c.Vote == nil || c.Vote.Type != ViewChangeVT || c.Vote.Vcv == nil ||
+			c.Vote.Vcv.View != s.View || c.Vote.Vcv.Root != s.Root || c.Vote.Index > s.LastVote {
+			return errors.New("snapshot root not certified by a view change to its view")
+		}
+		if err := sn.verifyCertificate(c); err != nil {
+			return err
+		}
+	}
+	found := false
+	for _, h := range s.HostList {
+		found = found || h == s.From
+	}
+	if !found {
+		return errors.New("snapshot taken by host not on its view")
+	}
+	for _, v := range s.Pending {
+		if !sn.voteAccepted(v.View, v) {
+			return errors.New("snapshot holds unconfirmed pending vote")
+		}
+	}
+	return nil
+}
+
+// Check a certificate against the members we know of the view its vote
+// was taken on, or of our own view if we never reached it
+func (sn *Node) verifyCertificate(cert *VoteCertificate) error {
+	hostlist := sn.HostListOn(cert.Vote.View)
+	if hostlist == nil {
+		sn.viewmu.Lock()
+		hostlist = sn.HostListOn(sn.ViewNo)
+		sn.viewmu.Unlock()
+	}
+	q := sn.QuorumFor(cert.Vote.proposal().Type)
+	return VerifyCertificate(sn.suite, cert, q, sn.memberKeys(hostlist))
+}
+
+// Replace the votes we applied by a snapshot of our state,
+// compacting the vote log
+func (sn *Node) snapshotVoteLog() {
+	s, err := sn.TakeSnapshot()
+	if err == nil {
+		err = sn.VoteLog.Install(s)
+	}
+	if err != nil {
+		log.Errorln(sn.Name(), "unable to snapshot applied votes:", err)
+	}
+}
+
+// Whether the host lists a and b hold the same hosts
+func sameHosts(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sa := append([]string(nil), a...)
+	sb := append([]string(nil), b...)
+	sort.Strings(sa)
+	sort.Strings(sb)
+	for i := range sa {
+		if sa[i] != sb[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Hosts of hostlist once the membership vote v is applied
+func hostsAfter(hostlist []string, v *Vote) []string {
+	hosts := make([]string, 0, len(hostlist)+1)
+	switch {
+	case v.Type == AddVT && v.Av != nil:
+		hosts = append(hosts, hostlist...)
+		hosts = append(hosts, v.Av.Name)
+	case v.Type == RemoveVT && v.Rv != nil:
+		for _, h := range hostlist {
+			if h != v.Rv.Name {
+				hosts = append(hosts, h)
+			}
+		}
+	default:
+		hosts = append(hosts, hostlist...)
+	}
+	return hosts
+}
+
+// Replace our state up to s.LastVote by the snapshot s
+func (sn *Node) installSnapshot(s *Snapshot) error {
+	if int64(s.LastVote) <= atomic.LoadInt64(&sn.LastAppliedVote) {
+		return errors.New("snapshot older than our state")
+	}
+	if err := sn.VoteLog.Install(s); err != nil {
+		return err
+	}
+	sn.restoreSnapshot(s)
+	return nil
+}
+
+// Set our state from a snapshot, keeping our place in the tree
+func (sn *Node) restoreSnapshot(s *Snapshot) {
+	sn.viewmu.Lock()
+	defer sn.viewmu.Unlock()
+	parent := sn.Parent(sn.ViewNo)
+	children := make([]string, 0)
+	for name := range sn.Children(sn.ViewNo) {
+		children = append(children, name)
+	}
+	if s.View != sn.ViewNo {
+		sn.NewView(s.View, parent, children, s.HostList)
+	} else {
+		sn.SetHostList(s.View, s.HostList)
+	}
+	sn.setRootFor(s.View, s.Root)
+	sn.setFailedRoots(s.View, s.FailedRoots)
+	sn.ViewNo = s.View
+
+	for _, v := range s.Pending {
+		switch v.Type {
+		case AddVT:
+			sn.AddAction(v.Av.View, v)
+		case RemoveVT:
+			sn.AddAction(v.Rv.View, v)
+		}
+	}
+
+	atomic.StoreInt64(&sn.LastAppliedVote, int64(s.LastVote))
+	if atomic.LoadInt64(&sn.LastSeenVote) < int64(s.LastVote) {
+		atomic.StoreInt64(&sn.LastSeenVote, int64(s.LastVote))
+	}
+	log.Println(sn.Name(), "installed snapshot of", s.From, "at vote", s.LastVote)
+}
+
+// Answer a catch up request with a batch of votes, after our snapshot
+// if the requester asked for it or for votes it replaced
+func (sn *Node) serveCatchUp(from string, req *CatchUpRequest) {
+	resp := &CatchUpResponse{}
+	index := req.Index
+
+	sn.VoteLog.mu.Lock()
+	first := sn.VoteLog.First
+	sn.VoteLog.mu.Unlock()
+	if req.Snapshot || index <= first {
+		s, err := sn.TakeSnapshot()
+		if err != nil {
+			log.Errorln(sn.Name(), "unable to take snapshot:", err)
+			return
+		}
+		resp.Snapshot = s
+		index = s.LastVote + 1
+	}
+
+	sn.VoteLog.mu.Lock()
+	for i := index; len(resp.Votes) < MaxCatchUpBatch; i++ {
+		v := sn.VoteLog.Get(i)
+		if v == nil {
+			break
+		}
+		resp.Votes = append(resp.Votes, v)
+	}
+	sn.VoteLog.mu.Unlock()
+
+	sn.PutTo(context.TODO(), from,
+		&SigningMessage{
+			From:         sn.Name(),
+			Type:         CatchUpResp,
+			LastSeenVote: int(atomic.LoadInt64(&sn.LastSeenVote)),
+			Curesp:       resp})
+}
+
+// Install the snapshot and votes of a catch up response,
+// and ask for more if we are still behind
+func (sn *Node) handleCatchUp(from string, resp *CatchUpResponse) {
+	if resp.Snapshot != nil {
+		if err := sn.VerifySnapshot(resp.Snapshot); err != nil {
+			log.Warnln(sn.Name(), "rejected snapshot from", from, ":", err)
+			return
+		}
+		if err := sn.installSnapshot(resp.Snapshot); err != nil {
+			log.Warnln(sn.Name(), "unable to install snapshot from", from, ":", err)
+		}
+	}
+
+	last := -1
+	for _, v := range resp.Votes {
+		if v == nil {
+			continue
+		}
+		sn.VoteLog.mu.Lock()
+		known := v.Index <= sn.VoteLog.First || sn.VoteLog.Get(v.Index) != nil
+		sn.VoteLog.mu.Unlock()
+		if known {
+			continue
+		}
+		// rejected votes are logged as no-ops, certified by the responses
+		// to their proposal
+		if v.Type == NoOpVT && !sn.voteRejected(v.View, v) ||
+			v.Type != NoOpVT && !sn.voteAccepted(v.View, v) {
+			log.Warnln(sn.Name(), "rejected undecided vote", v.Index, "from", from)
+			return
+		}
+		// put in votelog to be streamed and applied
+		sn.VoteLog.Put(v.Index, v)
+		last = max(last, v.Index)
+	}
+
+	// continue catching up
+	if last != -1 && int64(last) < atomic.LoadInt64(&sn.LastSeenVote) {
+		sn.CatchUp(last+1, from)
+	}
+}
@@ -0,0 +1,396 @@
+package sign
+
+import (
+	"bytes"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/dedis/crypto/abstract"
+	"github.com/dedis/prifi/coco/hashid"
+	"github.com/dedis/protobuf"
+)
+
+// Hash chained round history
+//
+// Every signing round commits to the previous signed round: the root
+// puts the round number and the back link, the hash of the record of the
+// newest signed round it knows of, in the message it computes the
+// challenge from. The record of a round holds its message, back link,
+// exception list and collective signature, so the chain of records can
+// be checked by anyone holding the keys of the group: a RecordVerifier.
+// Records must be signed by at least MinSigners of the group, a majority
+// by default, and carry the signed commitments they leave out, see
+// snaccount.go. Nodes check records against the keys of their view
+// before adopting them.
+// The root announces the record of its last round with the next one and
+// nodes send the newest record they know of up with their commitments:
+// every node keeps the chain, and a new root links to the last round of
+// the previous one. Records stay on their Round, and are handed to the
+// PersistFunc with it. A chain from round M to round N proves N was
+// signed after M; two chains holding different records for a round, or
+// two rounds linking to the same record, show a fork.
+
+// Signed round, as exported and checked by clients
+type RoundRecord struct {
+	Round     int
+	BackLink  hashid.HashId // hash of the record of the previous signed round
+	Message   []byte        // announced message or Merkle root
+	Aggregate []byte        // application aggregate, see snaggregate.go
+
+	C              abstract.Secret // collective challenge
+	R_hat          abstract.Secret // aggregate response
+	X_hat          abstract.Point  // aggregate key of the nodes that responded
+	V_hat          abstract.Point  // aggregate commitment
+	ExceptionV_hat abstract.Point  // commitments of nodes that did not respond
+	ExceptionList  []abstract.Point
+
+	ExceptedCommits []*ExceptedCommit // signed commitments in ExceptionV_hat
+}
+
+// Checks that a record was signed by a group
+type RecordVerifier interface {
+	Verify(suite abstract.Suite, rr *RoundRecord) error
+}
+
+// Public keys of the hosts of a group, a majority of which must sign
+type HostKeys []abstract.Point
+
+func (hk HostKeys) Verify(suite abstract.Suite, rr *RoundRecord) error {
+	return VerifyRecord(suite, rr, hk, 0)
+}
+
+// Public keys of the hosts of a group and the number of them that must
+// sign, a majority if 0
+type SignerKeys struct {
+	Keys []abstract.Point
+	Min  int
+}
+
+func (sk SignerKeys) Verify(suite abstract.Suite, rr *RoundRecord) error {
+	return VerifyRecord(suite, rr, sk.Keys, sk.Min)
+}
+
+// Group key of hosts signing in Threshold mode
+type GroupKey struct {
+	Key abstract.Point
+}
+
+func (gk GroupKey) Verify(suite abstract.Suite, rr *RoundRecord) error {
+	return VerifyThreshold(suite, gk.Key, rr)
+}
+
+// Called on the root with the record of every round it signed
+type RecordFunc func(view int, rr *RoundRecord)
+
+func (sn *Node) RegisterRecordFunc(rf RecordFunc) {
+	sn.historymu.Lock()
+	sn.RecordFunc = rf
+	sn.historymu.Unlock()
+}
+
+func (rr *RoundRecord) MarshalBinary() ([]byte, error) {
+	return protobuf.Encode(rr)
+}
+
+// Decode a record whose points and secrets belong to suite
+func UnmarshalRoundRecord(suite abstract.Suite, data []byte) (*RoundRecord, error) {
+	rr := &RoundRecord{}
+	if err := protobuf.DecodeWithConstructors(data, rr, suiteConstructors(suite)); err != nil {
+		return nil, err
+	}
+	return rr, nil
+}
+
+// Hash of the record, the back link of the next signed round
+func (rr *RoundRecord) Hash(suite abstract.Suite) hashid.HashId {
+	h := suite.Hash()
+	h.Write(intToByteSlice(rr.Round))
+	h.Write(rr.BackLink)
+	h.Write(intToByteSlice(len(rr.Message)))
+	h.Write(rr.Message)
+	h.Write(intToByteSlice(len(rr.Aggregate)))
+	h.Write(rr.Aggregate)
+	for _, s := range []abstract.Secret{rr.C, rr.R_hat} {
+		if s != nil {
+			b, _ := s.MarshalBinary()
+			h.Write(b)
+		}
+	}
+	writePoints(h, rr.X_hat, rr.V_hat, rr.ExceptionV_hat)
+	h.Write(intToByteSlice(len(rr.ExceptionList)))
+	writePoints(h, rr.ExceptionList...)
+	h.Write(intToByteSlice(len(rr.ExceptedCommits)))
+	for _, ec := range rr.ExceptedCommits {
+		if ec != nil {
+			h.Write(ec.Digest(suite, rr.Round))
+			writePoints(h, ec.Key, ec.ParentKey)
+		}
+	}
+	return h.Sum(nil)
+}
+
+// Message of round Round chained to the previous signed round
+func chainMessage(Round int, message []byte, backlink hashid.HashId) []byte {
+	m := make([]byte, 0, 16+len(message)+len(backlink))
+	m = append(m, intToByteSlice(Round)...)
+	m = append(m, intToByteSlice(len(message))...)
+	m = append(m, message...)
+	return append(m, backlink...)
+}
+
+// Announced message or Merkle root of a round
+func (sn *Node) roundMessage(round *Round) []byte {
+	if sn.Type == PubKey {
+		return sn.LogTest
+	}
+	return round.MTRoot
+}
+
+// Check the collective signature of a record by at least min of the
+// hosts of keys, those of its exception list left out.
+// min is a majority of the keys if 0.
+func VerifyRecord(suite abstract.Suite, rr *RoundRecord, keys []abstract.Point, min int) error {
+	if rr == nil || rr.X_hat == nil {
+		return ErrInvalidRecord
+	}
+	X, err := SignersKey(suite, keys, rr.ExceptionList, min)
+	if err == ErrTooFewSigners {
+		return err
+	}
+	if err != nil || !X.Equal(rr.X_hat) {
+		return ErrInvalidRecord
+	}
+	if err := verifyExceptedCommits(suite, rr.Round, keys, rr.ExceptionList,
+		rr.ExceptionV_hat, rr.ExceptedCommits); err != nil {
+		return err
+	}
+	return verifySignature(suite, rr, X)
+}
+
+// Check the collective signature of a record under the aggregate key X
+func verifySignature(suite abstract.Suite, rr *RoundRecord, X abstract.Point) error {
+	if rr == nil || rr.C == nil || rr.R_hat == nil || rr.V_hat == nil {
+		return ErrInvalidRecord
+	}
+	m := aggregateMessage(suite, chainMessage(rr.Round, rr.Message, rr.BackLink), rr.Aggregate)
+	if !hashElGamal(suite, m, rr.V_hat).Equal(rr.C) {
+		return ErrInvalidRecord
+	}
+
+	// base**r_hat * X**c * exceptions == V_hat
+	T := suite.Point().Mul(nil, rr.R_hat)
+	T.Add(T, suite.Point().Mul(X, rr.C))
+	if rr.ExceptionV_hat != nil {
+		T.Add(T, rr.ExceptionV_hat)
+	}
+	if !T.Equal(rr.V_hat) {
+		return ErrInvalidRecord
+	}
+	return nil
+}
+
+// Check that records, oldest first, form a single chain:
+// every record is signed by the group and links to the one before it
+func VerifyHistory(suite abstract.Suite, records []*RoundRecord, rv RecordVerifier) error {
+	for i, rr := range records {
+		if err := rv.Verify(suite, rr); err != nil {
+			return err
+		}
+		if i == 0 {
+			continue
+		}
+		prev := records[i-1]
+		if rr.Round <= prev.Round || !bytes.Equal(rr.BackLink, prev.Hash(suite)) {
+			return ErrBrokenHistory
+		}
+	}
+	return nil
+}
+
+// Check that records prove round N was signed after round M
+func VerifyOrder(suite abstract.Suite, records []*RoundRecord, M, N int, rv RecordVerifier) error {
+	if M >= N || len(records) < 2 || records[0].Round != M || records[len(records)-1].Round != N {
+		return ErrBrokenHistory
+	}
+	return VerifyHistory(suite, records, rv)
+}
+
+// Check that two verified chains agree on the rounds they share:
+// no round holds two records and no record has two successors
+func CheckFork(suite abstract.Suite, a, b []*RoundRecord) error {
+	rounds := make(map[int]string)
+	successors := make(map[string]int)
+	for _, rr := range a {
+		rounds[rr.Round] = string(rr.Hash(suite))
+		successors[string(rr.BackLink)] = rr.Round
+	}
+	for _, rr := range b {
+		if h, ok := rounds[rr.Round]; ok && h != string(rr.Hash(suite)) {
+			return ErrHistoryFork
+		}
+		if r, ok := successors[string(rr.BackLink)]; ok && r != rr.Round {
+			return ErrHistoryFork
+		}
+	}
+	return nil
+}
+
+// Newest signed round we know of
+func (sn *Node) historyHead() *RoundRecord {
+	sn.historymu.Lock()
+	defer sn.historymu.Unlock()
+	return sn.head
+}
+
+// Keys the records of view are checked against
+func (sn *Node) recordVerifier(view int) RecordVerifier {
+	if sn.Type == Threshold {
+		if tk := sn.thresholdKey(); tk != nil {
+			return GroupKey{tk.groupKey}
+		}
+	}
+	hostlist := sn.HostListOn(view)
+	keys := make([]abstract.Point, 0, len(hostlist))
+	for _, h := range hostlist {
+		if k := sn.keyOf(h); k != nil {
+			keys = append(keys, k)
+		}
+	}
+	return SignerKeys{keys, sn.config.MinSigners}
+}
+
+// Keep a record announced by the root or sent up by a child, once
+// checked against the keys of view
+func (sn *Node) addRecord(view int, rr *RoundRecord) error {
+	if rr == nil {
+		return nil
+	}
+	if err := sn.recordVerifier(view).Verify(sn.suite, rr); err != nil {
+		return err
+	}
+	h := rr.Hash(sn.suite)
+
+	sn.historymu.Lock()
+	defer sn.historymu.Unlock()
+	if head := sn.head; head != nil {
+		if head.Round == rr.Round && !bytes.Equal(head.Hash(sn.suite), h) ||
+			head.Round != rr.Round && bytes.Equal(head.BackLink, rr.BackLink) {
+			log.Errorln(sn.Name(), "fork in round history at round", rr.Round)
+			return ErrHistoryFork
+		}
+	}
+	if round := sn.GetRound(rr.Round); round != nil {
+		if round.Record != nil && !bytes.Equal(round.Record.Hash(sn.suite), h) {
+			log.Errorln(sn.Name(), "fork in round history at round", rr.Round)
+			return ErrHistoryFork
+		}
+		round.Record = rr
+	}
+	if sn.head == nil || rr.Round > sn.head.Round {
+		sn.head = rr
+	}
+	return nil
+}
+
+// Called on the root once the responses of a round were verified
+func (sn *Node) recordRound(view, Round int) {
+	round := sn.GetRound(Round)
+	if round == nil {
+		return
+	}
+	rr := &RoundRecord{
+		Round:           Round,
+		BackLink:        round.BackLink,
+		Message:         sn.roundMessage(round),
+		Aggregate:       round.Aggregate,
+		C:               round.c,
+		R_hat:           round.r_hat,
+		X_hat:           round.X_hat,
+		V_hat:           round.Log.V_hat,
+		ExceptionV_hat:  round.exceptionV_hat,
+		ExceptionList:   round.ExceptionList,
+		ExceptedCommits: round.ExceptedCommits}
+	if err := sn.addRecord(view, rr); err != nil {
+		log.Errorln(sn.Name(), "unable to record round", Round, ":", err)
+		return
+	}
+
+	sn.historymu.Lock()
+	rf := sn.RecordFunc
+	sn.historymu.Unlock()
+	if rf != nil {
+		rf(view, rr)
+	}
+}
+
+// Record of the signed round Round, the newest one if 0, nil if the
+// round is not in memory or was not signed
+func (sn *Node) SignedRound(Round int) *RoundRecord {
+	if Round == 0 {
+		return sn.historyHead()
+	}
+	round, err := sn.lookupRound(Round)
+	if err != nil || round == nil {
+		return nil
+	}
+	sn.roundLock.RLock()
+	defer sn.roundLock.RUnlock()
+	return round.Record
+}
+
+// Record of the signed round with the given message or Merkle root,
+// nil if no round in memory has one
+func (sn *Node) FindRecord(message []byte) *RoundRecord {
+	sn.roundLock.RLock()
+	defer sn.roundLock.RUnlock()
+	for _, rd := range sn.Rounds {
+		if rd.Record != nil && bytes.Equal(rd.Record.Message, message) {
+			return rd.Record
+		}
+	}
+	return nil
+}
+
+// Signed rounds from round from to round to, oldest first, found by
+// following the back links from the record of round to.
+// Only rounds still in memory can be exported.
+func (sn *Node) History(from, to int) ([]*RoundRecord, error) {
+	round, err := sn.lookupRound(to)
+	if err != nil {
+		return nil, err
+	}
+	if round == nil || round.Record == nil {
+		return nil, ErrBrokenHistory
+	}
+
+	byHash := make(map[string]*RoundRecord)
+	sn.roundLock.RLock()
+	evicted := sn.evictedRound
+	for _, rd := range sn.Rounds {
+		if rd.Record != nil {
+			byHash[string(rd.Record.Hash(sn.suite))] = rd.Record
+		}
+	}
+	sn.roundLock.RUnlock()
+
+	records := []*RoundRecord{round.Record}
+	for rr := round.Record; rr.Round > from; {
+		prev, ok := byHash[string(rr.BackLink)]
+		if !ok {
+			if from <= evicted {
+				return nil, ErrRoundEvicted
+			}
+			return nil, ErrBrokenHistory
+		}
+		records = append(records, prev)
+		rr = prev
+	}
+	if records[len(records)-1].Round != from {
+		return nil, ErrBrokenHistory
+	}
+
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+	return records, nil
+}
@@ -0,0 +1,116 @@
+package sign_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/dedis/crypto/random"
+	"github.com/dedis/prifi/coco/sign"
+	"github.com/dedis/prifi/coco/test/oldconfig"
+)
+
+// Every node holds the chain of rounds signed so far, the root up to the
+// last round, others up to the round before, as announced with the last one
+func TestRoundHistory(t *testing.T) {
+	hc, err := oldconfig.LoadConfig("../test/data/exconf.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sn := range hc.SNodes {
+		sn.RoundsPerView = 100
+	}
+	if err = hc.Run(false, sign.MerkleTree); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, sn := range hc.SNodes {
+			sn.Close()
+		}
+		time.Sleep(1 * time.Second)
+	}()
+
+	N := 4
+	root, leaf := hc.SNodes[0], hc.SNodes[len(hc.SNodes)-1]
+	for i := 1; i <= N; i++ {
+		root.LogTest = []byte("Hello History" + strconv.Itoa(i))
+		err = root.StartAnnouncement(&sign.AnnouncementMessage{LogTest: root.LogTest, Round: i})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	suite := root.Suite()
+	keys := make(sign.HostKeys, 0, len(hc.SNodes))
+	for _, sn := range hc.SNodes {
+		keys = append(keys, sn.PubKey)
+	}
+	chain, err := root.History(1, N)
+	if err != nil {
+		t.Fatal("unable to export history of the root:", err)
+	}
+	if err := sign.VerifyOrder(suite, chain, 1, N, keys); err != nil {
+		t.Fatal("history of the root rejected:", err)
+	}
+	if err := sign.VerifyOrder(suite, chain, N, 1, keys); err == nil {
+		t.Fatal("history accepted in the wrong order")
+	}
+	leafChain, err := leaf.History(1, N-1)
+	if err != nil {
+		t.Fatal("unable to export history of", leaf.Name(), ":", err)
+	}
+	if err := sign.VerifyOrder(suite, leafChain, 1, N-1, keys); err != nil {
+		t.Fatal("history of", leaf.Name(), "rejected:", err)
+	}
+	if err := sign.CheckFork(suite, chain, leafChain); err != nil {
+		t.Fatal("root and", leaf.Name(), "disagree:", err)
+	}
+
+	// a record rewritten after being signed breaks the chain
+	forged := *chain[1]
+	forged.Message = []byte("forged")
+	if err := sign.VerifyRecord(suite, &forged, keys, 0); err == nil {
+		t.Fatal("forged record accepted")
+	}
+	renumbered := *chain[1]
+	renumbered.Round = N + 1
+	if err := sign.VerifyRecord(suite, &renumbered, keys, 0); err == nil {
+		t.Fatal("record accepted under another round number")
+	}
+	if err := sign.VerifyRecord(suite, chain[1], keys[1:], 0); err == nil {
+		t.Fatal("record accepted without the keys of all signers")
+	}
+
+	// a single key holder can neither sign alone nor choose the
+	// commitments taken out of a signature
+	alone := *chain[1]
+	alone.ExceptionList = keys[1:]
+	alone.X_hat = root.PubKey
+	alone.ExceptionV_hat = suite.Point().Mul(nil, suite.Secret().Pick(random.Stream))
+	if err := sign.VerifyRecord(suite, &alone, keys, 0); err != sign.ErrTooFewSigners {
+		t.Fatal("record accepted with a single signer:", err)
+	}
+	if err := sign.VerifyRecord(suite, &alone, keys, 1); err != sign.ErrUntiedExceptions {
+		t.Fatal("record accepted with commitments left out unsigned:", err)
+	}
+	excepted := *chain[1]
+	excepted.ExceptionList = keys[:1]
+	excepted.X_hat, _ = sign.SignersKey(suite, keys, keys[:1], 0)
+	excepted.ExceptionV_hat = alone.ExceptionV_hat
+	ec := &sign.ExceptedCommit{Name: root.Name(), Key: root.PubKey,
+		V_hat: alone.ExceptionV_hat, ParentKey: root.PubKey}
+	ec.Ack = sign.ElGamalSign(suite, random.Stream, ec.Digest(suite, excepted.Round), root.PrivKey)
+	ec.Receipt = ec.Ack
+	excepted.ExceptedCommits = []*sign.ExceptedCommit{ec}
+	if err := sign.VerifyRecord(suite, &excepted, keys, 0); err != sign.ErrUntiedExceptions {
+		t.Fatal("record accepted with a commitment left out by its own signer:", err)
+	}
+	forkChain := []*sign.RoundRecord{chain[0], &forged}
+	if err := sign.CheckFork(suite, chain, forkChain); err != sign.ErrHistoryFork {
+		t.Fatal("fork not detected:", err)
+	}
+	skipped := []*sign.RoundRecord{chain[0], chain[2]}
+	if err := sign.VerifyHistory(suite, skipped, keys); err == nil {
+		t.Fatal("history with a missing round accepted")
+	}
+}
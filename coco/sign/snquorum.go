@@ -0,0 +1,288 @@
+package sign
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/dedis/crypto/abstract"
+)
+
+// Quorums and vote certificates
+//
+// Votes are decided from the signed VoteResponses they carry rather than
+// from the For/Against counters, which any node on the path could change.
+// Each vote type has its own Quorum. The root keeps only the valid
+// responses, sorted, along with the members of the view: the confirmed
+// vote then is a certificate that anyone knowing the public keys of the
+// members can check with VerifyCertificate. Responses are only checked
+// against these keys, never against the key they carry.
+// Rejected votes are logged as no-ops keeping the responses to their
+// proposal, so their certificate shows the proposal was put to the vote
+// at their index and fell short of its quorum.
+
+type QuorumRule int
+
+const (
+	TwoThirds QuorumRule = iota // more than two thirds, the default
+	Majority                    // more than half
+	Unanimous                   // every member
+)
+
+// Rule deciding a vote, applied to the weights of the members
+type Quorum struct {
+	Rule    QuorumRule
+	Weights map[string]int // weight of each member, members not listed weigh 1
+}
+
+var DefaultQuorum = &Quorum{Rule: TwoThirds}
+
+func (q *Quorum) Weight(name string) int {
+	if w, ok := q.Weights[name]; ok {
+		return w
+	}
+	return 1
+}
+
+// Whether a weight of forW votes out of total decides the vote
+func (q *Quorum) Reached(forW, total int) bool {
+	if total <= 0 {
+		return false
+	}
+	switch q.Rule {
+	case Majority:
+		return 2*forW > total
+	case Unanimous:
+		return forW == total
+	default:
+		return 3*forW > 2*total
+	}
+}
+
+// Set the quorum deciding votes of type vt
+func (sn *Node) SetQuorum(vt VoteType, q *Quorum) {
+	sn.votemu.Lock()
+	sn.quorums[vt] = q
+	sn.votemu.Unlock()
+}
+
+// Quorum deciding votes of type vt
+func (sn *Node) QuorumFor(vt VoteType) *Quorum {
+	sn.votemu.Lock()
+	defer sn.votemu.Unlock()
+	if q, ok := sn.quorums[vt]; ok {
+		return q
+	}
+	if h, ok := sn.voteTypes[vt]; ok && h.Quorum != nil {
+		return h.Quorum
+	}
+	return DefaultQuorum
+}
+
+// Digest signed by name when responding to v.
+// The count of the vote is left out as it changes on the way up.
+func VoteDigest(suite abstract.Suite, v *Vote, name string, accepted bool) ([]byte, error) {
+	vc := *v
+	vc.Count = nil
+	vc.Confirmed = false
+	b, err := vc.Encode()
+	if err != nil {
+		return nil, err
+	}
+	h := suite.Hash()
+	h.Write(b)
+	h.Write([]byte(name))
+	if accepted {
+		h.Write([]byte{1})
+	} else {
+		h.Write([]byte{0})
+	}
+	return h.Sum(nil), nil
+}
+
+// Check the response of a member to v against its known key
+func verifyVoteResponse(suite abstract.Suite, v *Vote, vr *VoteResponse, key abstract.Point) error {
+	if key == nil {
+		return errors.New("vote response of unknown member: " + vr.Name)
+	}
+	if vr.PubKey != nil && !key.Equal(vr.PubKey) {
+		return errors.New("vote response signed with wrong key")
+	}
+	b, err := VoteDigest(suite, v, vr.Name, vr.Accepted)
+	if err != nil {
+		return err
+	}
+	return ElGamalVerify(suite, b, key, vr.Sig)
+}
+
+// Keep the valid responses of members of hostlist, one per member,
+// sorted by name. keyOf returns the known key of a member, or nil and
+// the responses of the member are dropped.
+func validResponses(suite abstract.Suite, v *Vote, hostlist []string,
+	keyOf func(string) abstract.Point) []*VoteResponse {
+	members := make(map[string]bool, len(hostlist))
+	for _, h := range hostlist {
+		members[h] = true
+	}
+	valid := make([]*VoteResponse, 0)
+	if v.Count == nil {
+		return valid
+	}
+	for _, vr := range v.Count.Responses {
+		if vr == nil || !members[vr.Name] {
+			continue
+		}
+		if err := verifyVoteResponse(suite, v, vr, keyOf(vr.Name)); err != nil {
+			continue
+		}
+		members[vr.Name] = false // count every member once
+		valid = append(valid, vr)
+	}
+	sort.Sort(ByVoteResponse(valid))
+	return valid
+}
+
+// Weight of the valid responses for v, and total weight of hostlist
+func tallyVotes(suite abstract.Suite, v *Vote, hostlist []string, q *Quorum,
+	keyOf func(string) abstract.Point) (int, int) {
+	forW, total := 0, 0
+	for _, h := range hostlist {
+		total += q.Weight(h)
+	}
+	for _, vr := range validResponses(suite, v, hostlist, keyOf) {
+		if vr.Accepted {
+			forW += q.Weight(vr.Name)
+		}
+	}
+	return forW, total
+}
+
+// Called by the root before confirming v: keep only valid responses and
+// record the members of the view, so the vote can serve as certificate
+func (sn *Node) certifyVote(view int, v *Vote) {
+	if v.Count == nil {
+		return
+	}
+	v.Count.HostList = sn.HostListOn(view)
+	v.Count.Responses = validResponses(sn.suite, v, v.Count.HostList, sn.keyOf)
+	v.Count.For, v.Count.Against = 0, 0
+	for _, vr := range v.Count.Responses {
+		if vr.Accepted {
+			v.Count.For++
+		} else {
+			v.Count.Against++
+		}
+	}
+}
+
+// Whether v reached the quorum of its type on view, counting the
+// members of view as we know them, whatever hostlist v claims
+func (sn *Node) voteAccepted(view int, v *Vote) bool {
+	hostlist := sn.HostListOn(view)
+	q := sn.QuorumFor(v.Type)
+	forW, total := tallyVotes(sn.suite, v, hostlist, q, sn.keyOf)
+	return q.Reached(forW, total)
+}
+
+// Whether the no-op v shows its proposal was put to the vote on view
+// and fell short of its quorum
+func (sn *Node) voteRejected(view int, v *Vote) bool {
+	if v.Type != NoOpVT {
+		return false
+	}
+	p := v.proposal()
+	hostlist := sn.HostListOn(view)
+	q := sn.QuorumFor(p.Type)
+	return rejected(sn.suite, p, hostlist, q, sn.keyOf)
+}
+
+// Whether members of hostlist validly responded to v, too few to reach q
+func rejected(suite abstract.Suite, v *Vote, hostlist []string, q *Quorum,
+	keyOf func(string) abstract.Point) bool {
+	if len(validResponses(suite, v, hostlist, keyOf)) == 0 {
+		return false
+	}
+	forW, total := tallyVotes(suite, v, hostlist, q, keyOf)
+	return !q.Reached(forW, total)
+}
+
+// The vote as members responded to it: a no-op is turned
+// back into the proposal it was rejected as
+func (v *Vote) proposal() *Vote {
+	p := *v
+	if v.Type == NoOpVT {
+		p.Type, p.Proposed = v.Proposed, DefaultVT
+	}
+	return &p
+}
+
+// Compact proof that a vote was confirmed by a quorum of the group
+type VoteCertificate struct {
+	Vote      *Vote           // the vote, without its count
+	HostList  []string        // members of the view the vote was taken on
+	Responses []*VoteResponse // signed responses, sorted by name
+}
+
+// Certificate of the confirmed vote, or of the no-op logged for a
+// rejected one, at index of the vote log
+func (sn *Node) Certificate(index int) (*VoteCertificate, error) {
+	sn.VoteLog.mu.Lock()
+	v := sn.VoteLog.Get(index)
+	sn.VoteLog.mu.Unlock()
+	if v == nil || v.Count == nil || !v.Confirmed && v.Type != NoOpVT {
+		return nil, errors.New("no decided vote at index")
+	}
+	vc := *v
+	vc.Count = nil
+	return &VoteCertificate{
+		Vote:      &vc,
+		HostList:  v.Count.HostList,
+		Responses: v.Count.Responses}, nil
+}
+
+// Check that cert holds enough valid responses for q, or for a no-op
+// that its proposal was put to the vote and fell short of q, the quorum
+// of the proposal. keys maps the members of the view the vote was taken on, as the
+// verifier knows them, to their public keys: the weight is counted over
+// these members, the certificate must name exactly them and the responses
+// must be signed with these keys.
+func VerifyCertificate(suite abstract.Suite, cert *VoteCertificate, q *Quorum,
+	keys map[string]abstract.Point) error {
+	if cert.Vote == nil || len(cert.HostList) == 0 {
+		return errors.New("incomplete vote certificate")
+	}
+	members := make([]string, 0, len(keys))
+	for h, k := range keys {
+		if k != nil {
+			members = append(members, h)
+		}
+	}
+	if !sameHosts(cert.HostList, members) {
+		return errors.New("vote certificate members differ from the known members")
+	}
+	keyOf := func(name string) abstract.Point { return keys[name] }
+
+	v := cert.Vote.proposal()
+	v.Count = &Count{Responses: cert.Responses}
+	if cert.Vote.Type == NoOpVT {
+		if !rejected(suite, v, members, q, keyOf) {
+			return errors.New("no-op certificate does not show a rejected vote")
+		}
+		return nil
+	}
+	forW, total := tallyVotes(suite, v, members, q, keyOf)
+	if !q.Reached(forW, total) {
+		return ErrQuorumNotReached
+	}
+	return nil
+}
+
+// Known public keys of the hosts of hostlist, to check certificates
+func (sn *Node) memberKeys(hostlist []string) map[string]abstract.Point {
+	keys := make(map[string]abstract.Point, len(hostlist))
+	for _, h := range hostlist {
+		if k := sn.keyOf(h); k != nil {
+			keys[h] = k
+		}
+	}
+	return keys
+}
@@ -0,0 +1,117 @@
+package sign_test
+
+import (
+	"testing"
+
+	"github.com/dedis/crypto/abstract"
+	"github.com/dedis/crypto/nist"
+	"github.com/dedis/crypto/random"
+	"github.com/dedis/prifi/coco/sign"
+)
+
+func TestQuorumReached(t *testing.T) {
+	tests := []struct {
+		q       *sign.Quorum
+		for_    int
+		total   int
+		reached bool
+	}{
+		{&sign.Quorum{Rule: sign.TwoThirds}, 2, 3, false},
+		{&sign.Quorum{Rule: sign.TwoThirds}, 3, 4, true},
+		{&sign.Quorum{Rule: sign.Majority}, 2, 4, false},
+		{&sign.Quorum{Rule: sign.Majority}, 3, 5, true},
+		{&sign.Quorum{Rule: sign.Unanimous}, 4, 5, false},
+		{&sign.Quorum{Rule: sign.Unanimous}, 5, 5, true},
+		{&sign.Quorum{Rule: sign.Majority}, 0, 0, false},
+	}
+	for i, test := range tests {
+		if test.q.Reached(test.for_, test.total) != test.reached {
+			t.Error("test", i, "expected reached:", test.reached)
+		}
+	}
+}
+
+// Certificate with hosts a and b for and c against
+func testCertificate(suite abstract.Suite) (*sign.VoteCertificate, map[string]abstract.Point) {
+	v := &sign.Vote{Index: 1, View: 0, Round: 3, Type: sign.RemoveVT,
+		Rv: &sign.RemoveVote{View: 1, Name: "d", Parent: "a"}}
+	cert := &sign.VoteCertificate{Vote: v, HostList: []string{"a", "b", "c"}}
+	keys := make(map[string]abstract.Point)
+	for _, name := range cert.HostList {
+		priv := suite.Secret().Pick(random.Stream)
+		keys[name] = suite.Point().Mul(nil, priv)
+		vr := &sign.VoteResponse{Name: name, PubKey: keys[name], Accepted: name != "c"}
+		b, _ := sign.VoteDigest(suite, v, vr.Name, vr.Accepted)
+		vr.Sig = sign.ElGamalSign(suite, random.Stream, b, priv)
+		cert.Responses = append(cert.Responses, vr)
+	}
+	return cert, keys
+}
+
+func TestVerifyCertificate(t *testing.T) {
+	suite := nist.NewAES128SHA256P256()
+	cert, keys := testCertificate(suite)
+
+	if err := sign.VerifyCertificate(suite, cert, &sign.Quorum{Rule: sign.Majority}, keys); err != nil {
+		t.Fatal("majority certificate rejected:", err)
+	}
+	if err := sign.VerifyCertificate(suite, cert, sign.DefaultQuorum, keys); err != sign.ErrQuorumNotReached {
+		t.Fatal("two thirds reached with 2 out of 3 votes")
+	}
+	weighted := &sign.Quorum{Rule: sign.TwoThirds, Weights: map[string]int{"a": 2}}
+	if err := sign.VerifyCertificate(suite, cert, weighted, keys); err != nil {
+		t.Fatal("weighted certificate rejected:", err)
+	}
+
+	// responses can not be turned around
+	cert.Responses[2].Accepted = true
+	if err := sign.VerifyCertificate(suite, cert, sign.DefaultQuorum, keys); err != sign.ErrQuorumNotReached {
+		t.Fatal("certificate accepted with forged response")
+	}
+	cert.Responses[2].Accepted = false
+
+	// responses must be signed with the keys of the members
+	other := make(map[string]abstract.Point)
+	for name := range keys {
+		other[name] = suite.Point().Mul(nil, suite.Secret().Pick(random.Stream))
+	}
+	if err := sign.VerifyCertificate(suite, cert, &sign.Quorum{Rule: sign.Majority}, other); err == nil {
+		t.Fatal("certificate accepted with wrong keys")
+	}
+
+	// nor with the keys they carry themselves
+	if err := sign.VerifyCertificate(suite, cert, &sign.Quorum{Rule: sign.Majority}, nil); err == nil {
+		t.Fatal("certificate accepted without member keys")
+	}
+	partial := map[string]abstract.Point{"a": keys["a"], "b": keys["b"]}
+	if err := sign.VerifyCertificate(suite, cert, &sign.Quorum{Rule: sign.Majority}, partial); err == nil {
+		t.Fatal("certificate accepted with a member of unknown key")
+	}
+
+	// members voting against can not be left out of the certificate
+	cert.HostList = []string{"a", "b"}
+	cert.Responses = cert.Responses[:2]
+	if err := sign.VerifyCertificate(suite, cert, sign.DefaultQuorum, keys); err == nil {
+		t.Fatal("certificate accepted without a member")
+	}
+}
+
+// A rejected vote logged as a no-op is certified by the responses to its proposal
+func TestVerifyNoOpCertificate(t *testing.T) {
+	suite := nist.NewAES128SHA256P256()
+	cert, keys := testCertificate(suite)
+	noop := *cert.Vote
+	noop.Type, noop.Proposed = sign.NoOpVT, cert.Vote.Type
+	cert.Vote = &noop
+
+	if err := sign.VerifyCertificate(suite, cert, sign.DefaultQuorum, keys); err != nil {
+		t.Fatal("rejected vote not certified:", err)
+	}
+	if err := sign.VerifyCertificate(suite, cert, &sign.Quorum{Rule: sign.Majority}, keys); err == nil {
+		t.Fatal("no-op certified for a vote that reached its quorum")
+	}
+	cert.Responses = nil
+	if err := sign.VerifyCertificate(suite, cert, sign.DefaultQuorum, keys); err == nil {
+		t.Fatal("no-op certified without responses")
+	}
+}
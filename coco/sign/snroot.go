@@ -0,0 +1,222 @@
+package sign
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sort"
+
+	"github.com/dedis/crypto/abstract"
+)
+
+// Root selection for view changes
+//
+// The root of a new view is drawn from the record of the last round signed
+// on the previous view. The hash of the record covers the aggregate
+// response, which the root of that round only learns once the challenge is
+// fixed, from the secrets of the whole tree: it cannot grind the seed,
+// nobody knows the next root before the round was signed, and anyone
+// holding the keys of the group can check the record.
+// The proposer of a view change puts the record in its vote, with the
+// roots skipped as failed, so the selection is checked from the signed
+// vote alone. Nodes accept the newest record they hold or the next one
+// in the chain, and as failed roots those the group agreed on with earlier
+// view changes, plus the root of the previous view.
+
+// number of views during which a root that failed is not selected again
+const RootFailureMemory = 5
+
+// Host that failed as root of View
+type FailedRoot struct {
+	Name string
+	View int
+}
+
+// Seed the root of a view is drawn from: the hash of the record
+// of a signed round, nil without one
+func RecordSeed(suite abstract.Suite, rr *RoundRecord) []byte {
+	if rr == nil {
+		return nil
+	}
+	return rr.Hash(suite)
+}
+
+// Failed roots the group agreed on within RootFailureMemory views of view,
+// sorted by name
+func (sn *Node) failedRootsFor(view int) []FailedRoot {
+	sn.rootmu.Lock()
+	defer sn.rootmu.Unlock()
+	failed := make([]FailedRoot, 0)
+	for name, v := range sn.failedRoots {
+		if v < view && view-v <= RootFailureMemory {
+			failed = append(failed, FailedRoot{Name: name, View: v})
+		}
+	}
+	sort.Sort(byFailedName(failed))
+	return failed
+}
+
+type byFailedName []FailedRoot
+
+func (f byFailedName) Len() int           { return len(f) }
+func (f byFailedName) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
+func (f byFailedName) Less(i, j int) bool { return f[i].Name < f[j].Name }
+
+// Failed roots proposed for view: those agreed on, and root
+// if it is the root of the previous view and it failed
+func (sn *Node) proposeFailedRoots(view int, root string) []FailedRoot {
+	failed := sn.failedRootsFor(view)
+	if root == "" {
+		return failed
+	}
+	for i, f := range failed {
+		if f.Name == root {
+			failed[i].View = view - 1
+			return failed
+		}
+	}
+	failed = append(failed, FailedRoot{Name: root, View: view - 1})
+	sort.Sort(byFailedName(failed))
+	return failed
+}
+
+// Names of the failed roots
+func skipFailed(failed []FailedRoot) map[string]bool {
+	skip := make(map[string]bool)
+	for _, f := range failed {
+		skip[f.Name] = true
+	}
+	return skip
+}
+
+// Remember that we saw the root of view fail
+// it is skipped by RootFor until the group agrees on the next view
+func (sn *Node) suspectRoot(view int, root string) {
+	sn.rootmu.Lock()
+	sn.suspected[view] = root
+	sn.rootmu.Unlock()
+}
+
+// Adopt the failed roots the group agreed on when changing to view
+func (sn *Node) setFailedRoots(view int, failed []FailedRoot) {
+	sn.rootmu.Lock()
+	defer sn.rootmu.Unlock()
+	sn.failedRoots = make(map[string]int)
+	for _, f := range failed {
+		// forget failures too old to matter
+		if view-f.View <= RootFailureMemory {
+			sn.failedRoots[f.Name] = f.View
+		}
+	}
+}
+
+// Fix the root of a view once the group agreed on it
+func (sn *Node) setRootFor(view int, root string) {
+	sn.rootmu.Lock()
+	sn.viewRoots[view] = root
+	delete(sn.suspected, view-1)
+	sn.rootmu.Unlock()
+}
+
+// Deterministically select the root of view among hostlist from seed,
+// skipping the given hosts unless that would leave no candidate.
+// Anyone holding the seed and the hostlist can check the selection.
+func SelectRoot(suite abstract.Suite, seed []byte, view int, hostlist []string, skip map[string]bool) string {
+	candidates := make([]string, 0, len(hostlist))
+	for _, h := range hostlist {
+		if !skip[h] {
+			candidates = append(candidates, h)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = append(candidates, hostlist...)
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	sort.Strings(candidates)
+
+	h := suite.Hash()
+	h.Write(seed)
+	h.Write(intToByteSlice(view))
+	r := binary.BigEndian.Uint64(h.Sum(nil)[:8])
+	return candidates[r%uint64(len(candidates))]
+}
+
+// Check that the root of vcv is the one its seed record selects among
+// hostlist, the hosts of the previous view, skipping its failed roots
+func (vcv *ViewChangeVote) CheckRoot(suite abstract.Suite, hostlist []string) error {
+	seed := RecordSeed(suite, vcv.SeedRecord)
+	if SelectRoot(suite, seed, vcv.View, hostlist, skipFailed(vcv.FailedRoots)) != vcv.Root {
+		return ErrInvalidRoot
+	}
+	return nil
+}
+
+// Check the root proposed by vcv: its seed record must be signed by the
+// group and be the newest we hold or the next one, its failed roots those
+// the group agreed on and possibly the root of the previous view.
+func (sn *Node) VerifyRoot(vcv *ViewChangeVote) error {
+	prev := vcv.View - 1
+	if prev < 0 {
+		return ErrInvalidRoot
+	}
+	if err := sn.verifySeedRecord(prev, vcv.SeedRecord); err != nil {
+		return err
+	}
+	if err := sn.verifyFailedRoots(vcv); err != nil {
+		return err
+	}
+	return vcv.CheckRoot(sn.suite, sn.HostListOn(prev))
+}
+
+// Check that rr, signed on view, is our newest record or the next one
+func (sn *Node) verifySeedRecord(view int, rr *RoundRecord) error {
+	head := sn.historyHead()
+	if rr == nil {
+		if head != nil {
+			return ErrInvalidSeed
+		}
+		return nil
+	}
+	if err := sn.recordVerifier(view).Verify(sn.suite, rr); err != nil {
+		return err
+	}
+	if head == nil {
+		return nil
+	}
+	hh := head.Hash(sn.suite)
+	if rr.Round == head.Round && bytes.Equal(rr.Hash(sn.suite), hh) ||
+		rr.Round > head.Round && bytes.Equal(rr.BackLink, hh) {
+		return nil
+	}
+	return ErrInvalidSeed
+}
+
+// Check that the failed roots of vcv are the ones the group agreed on,
+// and possibly the root of the previous view
+func (sn *Node) verifyFailedRoots(vcv *ViewChangeVote) error {
+	prev := vcv.View - 1
+	listed := make(map[string]int)
+	for _, f := range vcv.FailedRoots {
+		if _, ok := listed[f.Name]; ok {
+			return errors.New("failed root listed twice: " + f.Name)
+		}
+		listed[f.Name] = f.View
+	}
+	for _, f := range sn.failedRootsFor(vcv.View) {
+		v, ok := listed[f.Name]
+		if !ok || v != f.View && v != prev {
+			return errors.New("agreed failed root missing from view change: " + f.Name)
+		}
+		if v == f.View {
+			delete(listed, f.Name)
+		}
+	}
+	for name, v := range listed {
+		if v != prev || name != sn.RootFor(prev) {
+			return errors.New("reported failed root was not root of previous view: " + name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package sign_test
+
+import (
+	"testing"
+
+	"github.com/dedis/crypto/nist"
+	"github.com/dedis/prifi/coco/sign"
+)
+
+func TestSelectRoot(t *testing.T) {
+	suite := nist.NewAES128SHA256P256()
+	hostlist := []string{"host0", "host1", "host2", "host3", "host4", "host5"}
+	seed := []byte("collective challenge of last round")
+
+	root := sign.SelectRoot(suite, seed, 1, hostlist, nil)
+	if root == "" {
+		t.Fatal("no root selected")
+	}
+
+	// every node computes the same root whatever its hostlist order
+	reversed := make([]string, len(hostlist))
+	for i, h := range hostlist {
+		reversed[len(hostlist)-1-i] = h
+	}
+	if r := sign.SelectRoot(suite, seed, 1, reversed, nil); r != root {
+		t.Fatal("root depends on hostlist order", r, root)
+	}
+
+	// failed roots are skipped
+	skip := map[string]bool{root: true}
+	if r := sign.SelectRoot(suite, seed, 1, hostlist, skip); r == root {
+		t.Fatal("failed root selected again")
+	}
+
+	// unless nobody else is left
+	skip = make(map[string]bool)
+	for _, h := range hostlist {
+		skip[h] = true
+	}
+	if r := sign.SelectRoot(suite, seed, 1, hostlist, skip); r == "" {
+		t.Fatal("no root selected when all hosts failed")
+	}
+
+	// different seeds spread the root over the group
+	roots := make(map[string]bool)
+	for i := 0; i < 64; i++ {
+		roots[sign.SelectRoot(suite, []byte{byte(i)}, 1, hostlist, nil)] = true
+	}
+	if len(roots) < 2 {
+		t.Fatal("root does not depend on seed")
+	}
+}
@@ -0,0 +1,141 @@
+package sign
+
+import (
+	"strconv"
+	"sync/atomic"
+
+	log "github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+// Retention of round state
+// Only the last Config.RoundsInMemory rounds are kept in sn.Rounds.
+// Older rounds are evicted as new ones are set up, and finished ones are
+// handed to the PersistFunc, if one was registered, before being dropped.
+
+// Called with every finished round evicted from memory
+// Allows the client of the Node to persist round state
+type PersistFunc func(Round int, round *Round) error
+
+func (sn *Node) RegisterPersistFunc(pf PersistFunc) {
+	sn.roundLock.Lock()
+	sn.PersistFunc = pf
+	sn.roundLock.Unlock()
+}
+
+// Returns the round state held in memory, nil if there is none
+// (the round was evicted or never set up): callers must check for nil
+func (sn *Node) GetRound(Round int) *Round {
+	sn.roundLock.RLock()
+	round := sn.Rounds[Round]
+	sn.roundLock.RUnlock()
+	return round
+}
+
+// Returns the round state for a message about Round
+// Messages for rounds that were evicted get ErrRoundEvicted,
+// rounds we were not announced of give nil
+func (sn *Node) lookupRound(Round int) (*Round, error) {
+	sn.roundLock.RLock()
+	defer sn.roundLock.RUnlock()
+	if Round <= sn.evictedRound {
+		return nil, ErrRoundEvicted
+	}
+	return sn.Rounds[Round], nil
+}
+
+// Returns the round state for a round the node is working on
+// Gives ErrRoundEvicted or ErrUnknownRound instead of a nil round
+func (sn *Node) roundFor(Round int) (*Round, error) {
+	round, err := sn.lookupRound(Round)
+	if err != nil {
+		return nil, err
+	}
+	if round == nil {
+		return nil, ErrUnknownRound
+	}
+	return round, nil
+}
+
+// Tell the sender of a message about an evicted round that it came too late
+func (sn *Node) replyEvicted(view int, to string, Round int) {
+	if to == "" {
+		return
+	}
+	sn.PutTo(context.TODO(), to, &SigningMessage{
+		Type:         Error,
+		View:         view,
+		From:         sn.Name(),
+		LastSeenVote: int(atomic.LoadInt64(&sn.LastSeenVote)),
+		Err:          &ErrorMessage{Err: ErrRoundEvicted.Error() + ": " + strconv.Itoa(Round)}})
+}
+
+// Store the state of a new round, evicting rounds that fall out of memory
+func (sn *Node) addRound(roundNo int, round *Round) {
+	sn.roundLock.Lock()
+	sn.Rounds[roundNo] = round
+
+	evicted := make(map[int]*Round)
+	keep := sn.config.RoundsInMemory
+	for r, rd := range sn.Rounds {
+		if r <= roundNo-keep {
+			evicted[r] = rd
+			delete(sn.Rounds, r)
+			sn.evictedRound = max(sn.evictedRound, r)
+		}
+	}
+	pf := sn.PersistFunc
+	sn.roundLock.Unlock()
+
+	for r, rd := range evicted {
+		if !rd.Finished {
+			log.Warnln(sn.Name(), "evicting unfinished round", r)
+			continue
+		}
+		if pf == nil {
+			continue
+		}
+		if err := pf(r, rd); err != nil {
+			log.Errorln(sn.Name(), "failed to persist round", r, err)
+		}
+	}
+}
+
+// Mark a round as done on our side: all responses were handled
+func (sn *Node) finishRound(Round int) {
+	sn.roundLock.Lock()
+	if round := sn.Rounds[Round]; round != nil {
+		round.Finished = true
+	}
+	sn.roundLock.Unlock()
+}
+
+// Number of rounds currently held in memory
+func (sn *Node) RoundsInMemory() int {
+	sn.roundLock.RLock()
+	n := len(sn.Rounds)
+	sn.roundLock.RUnlock()
+	return n
+}
+
+// Hand the finished rounds still in memory to the PersistFunc
+func (sn *Node) persistRounds() {
+	sn.roundLock.RLock()
+	pf := sn.PersistFunc
+	finished := make(map[int]*Round)
+	for r, rd := range sn.Rounds {
+		if rd.Finished {
+			finished[r] = rd
+		}
+	}
+	sn.roundLock.RUnlock()
+
+	if pf == nil {
+		return
+	}
+	for r, rd := range finished {
+		if err := pf(r, rd); err != nil {
+			log.Errorln(sn.Name(), "failed to persist round", r, err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package sign_test
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dedis/prifi/coco/sign"
+	"github.com/dedis/prifi/coco/test/oldconfig"
+)
+
+// Only the last rounds are kept in memory, finished ones are handed to
+// the PersistFunc when they are evicted
+func TestRoundEviction(t *testing.T) {
+	cfg := sign.DefaultConfig()
+	cfg.RoundsInMemory = 2
+	hc, err := oldconfig.LoadConfig("../test/data/exconf.json", oldconfig.ConfigOptions{Config: cfg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	persisted := make(map[string][]int)
+	for _, sn := range hc.SNodes {
+		sn.RoundsPerView = 100
+		name := sn.Name()
+		sn.RegisterPersistFunc(func(Round int, round *sign.Round) error {
+			mu.Lock()
+			persisted[name] = append(persisted[name], Round)
+			mu.Unlock()
+			return nil
+		})
+	}
+	if err = hc.Run(false, sign.MerkleTree); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, sn := range hc.SNodes {
+			sn.Close()
+		}
+		time.Sleep(1 * time.Second)
+	}()
+
+	N := 5
+	root := hc.SNodes[0]
+	for i := 1; i <= N; i++ {
+		root.LogTest = []byte("Hello Eviction" + strconv.Itoa(i))
+		err = root.StartAnnouncement(&sign.AnnouncementMessage{LogTest: root.LogTest, Round: i})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := root.RoundsInMemory(); n > 2 {
+		t.Fatal("root keeps", n, "rounds in memory")
+	}
+	if root.GetRound(1) != nil {
+		t.Fatal("round 1 still in memory")
+	}
+	if root.GetRound(N) == nil {
+		t.Fatal("last round evicted")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	got := make(map[int]bool)
+	for _, r := range persisted[root.Name()] {
+		if got[r] {
+			t.Fatal("round", r, "persisted twice")
+		}
+		got[r] = true
+	}
+	for r := 1; r <= N-2; r++ {
+		if !got[r] {
+			t.Fatal("evicted round", r, "not persisted:", persisted[root.Name()])
+		}
+	}
+	if got[N] {
+		t.Fatal("round in memory persisted")
+	}
+}
@@ -0,0 +1,192 @@
+package sign
+
+import (
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+// Graceful shutdown
+//
+// A confirmed ShutdownVT vote stops the group. Nodes stop starting rounds
+// as soon as they see the vote confirmed. Applying it, every node waits for
+// the rounds in flight to finish, runs its ShutdownFunc so applications can
+// answer their clients, and hands the rounds still in memory to the
+// PersistFunc. Connections are then closed from the leaves up: a node
+// closes once all its children told it they are Closing, the root last.
+// ExitStatus reports how the node ended, for deployment tooling.
+
+// Exit statuses of a node
+const (
+	ExitOK      = 0 // closed on request or by a voted shutdown
+	ExitFailure = 1 // closed on losing a connection
+	ExitTimeout = 2 // voted shutdown did not complete in time
+)
+
+type ShutdownVote struct {
+	Reason string // reported in the logs of every node
+}
+
+// Called on shutdown once the rounds in flight are done,
+// before connections are closed
+type ShutdownFunc func() error
+
+func (sn *Node) RegisterShutdownFunc(sf ShutdownFunc) {
+	sn.shutdownmu.Lock()
+	sn.ShutdownFunc = sf
+	sn.shutdownmu.Unlock()
+}
+
+// Propose to shut the group down
+func (sn *Node) Shutdown(reason string) error {
+	return sn.proposeVote(&Vote{Type: ShutdownVT, Sv: &ShutdownVote{Reason: reason}})
+}
+
+// Whether a shutdown was voted, no new rounds are started then
+func (sn *Node) ShuttingDown() bool {
+	sn.shutdownmu.Lock()
+	defer sn.shutdownmu.Unlock()
+	return sn.shuttingDown
+}
+
+// Closed once the node is closed
+func (sn *Node) Closed() chan error {
+	return sn.closed
+}
+
+// How the node ended, ExitOK while it is running
+func (sn *Node) ExitStatus() int {
+	sn.shutdownmu.Lock()
+	defer sn.shutdownmu.Unlock()
+	return sn.exitStatus
+}
+
+// Record how the node ended, the first status set is kept
+func (sn *Node) setExitStatus(status int) {
+	sn.shutdownmu.Lock()
+	if !sn.exited {
+		sn.exitStatus = status
+		sn.exited = true
+	}
+	sn.shutdownmu.Unlock()
+}
+
+// Stop starting rounds, returns false if already stopped
+func (sn *Node) stopRounds() bool {
+	sn.shutdownmu.Lock()
+	defer sn.shutdownmu.Unlock()
+	if sn.shuttingDown {
+		return false
+	}
+	sn.shuttingDown = true
+	return true
+}
+
+// Apply a confirmed shutdown vote
+func (sn *Node) shutdown(v *Vote) {
+	// votes replayed from a log kept on disk belong to a previous run
+	if v.Index <= sn.replayedVote {
+		log.Println(sn.Name(), "skipping shutdown vote", v.Index, "of previous run")
+		return
+	}
+	sn.stopRounds()
+	sn.shutdownmu.Lock()
+	if sn.closing {
+		sn.shutdownmu.Unlock()
+		return
+	}
+	sn.closing = true
+	sf := sn.ShutdownFunc
+	sn.shutdownmu.Unlock()
+
+	reason := ""
+	if v.Sv != nil {
+		reason = v.Sv.Reason
+	}
+	log.Infoln(sn.Name(), "shutting down:", reason)
+
+	sn.viewmu.Lock()
+	view := sn.ViewNo
+	sn.viewmu.Unlock()
+
+	go func() {
+		status := ExitOK
+		deadline := time.Now().Add(sn.Timeout())
+		if !sn.waitRounds(deadline) {
+			log.Warnln(sn.Name(), "shutting down with rounds in flight")
+			status = ExitTimeout
+		}
+		if sf != nil {
+			if err := sf(); err != nil {
+				log.Errorln(sn.Name(), "shutdown func:", err)
+			}
+		}
+		sn.persistRounds()
+
+		if !sn.waitChildrenClosing(view, deadline.Add(sn.Timeout())) {
+			log.Warnln(sn.Name(), "closing before all children")
+			status = ExitTimeout
+		}
+		if !sn.IsRoot(view) {
+			err := sn.PutUp(context.TODO(), view, &SigningMessage{
+				Type:         Closing,
+				View:         view,
+				LastSeenVote: int(atomic.LoadInt64(&sn.LastSeenVote))})
+			if err != nil {
+				log.Errorln(sn.Name(), "unable to tell parent of closing:", err)
+				status = ExitTimeout
+			}
+		}
+		sn.setExitStatus(status)
+		sn.Close()
+	}()
+}
+
+// Wait for the rounds in memory to finish, false on reaching deadline
+func (sn *Node) waitRounds(deadline time.Time) bool {
+	for {
+		sn.roundLock.RLock()
+		inflight := 0
+		for _, round := range sn.Rounds {
+			if !round.Finished {
+				inflight++
+			}
+		}
+		sn.roundLock.RUnlock()
+		if inflight == 0 {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// A child is done shutting down
+func (sn *Node) childClosing(name string) {
+	sn.shutdownmu.Lock()
+	sn.closingChildren[name] = true
+	sn.shutdownmu.Unlock()
+}
+
+// Wait for all children on view to be closing, false on reaching deadline
+func (sn *Node) waitChildrenClosing(view int, deadline time.Time) bool {
+	for {
+		done := true
+		sn.shutdownmu.Lock()
+		for name := range sn.Children(view) {
+			done = done && sn.closingChildren[name]
+		}
+		sn.shutdownmu.Unlock()
+		if done {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -0,0 +1,185 @@
+package sign
+
+import (
+	"errors"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/dedis/crypto/abstract"
+	"github.com/dedis/crypto/random"
+)
+
+// Operator view and control of a running node
+
+// State of a node as reported to operators
+type NodeStatus struct {
+	Name     string   `json:"name"`
+	View     int      `json:"view"`
+	Role     string   `json:"role"` // "root" or "regular"
+	Root     string   `json:"root"`
+	NextRoot string   `json:"next_root"` // starts the next view change
+	Parent   string   `json:"parent"`
+	Children []string `json:"children"`
+
+	LastRound       int           `json:"last_round"`
+	LastSeenVote    int           `json:"last_seen_vote"`
+	LastAppliedVote int           `json:"last_applied_vote"`
+	PendingVotes    []VoteSummary `json:"pending_votes"` // confirmed, acting on later views
+
+	ChangingView bool         `json:"changing_view"`
+	ShuttingDown bool         `json:"shutting_down"`
+	Peers        []PeerStatus `json:"peers"`
+}
+
+type VoteSummary struct {
+	Index int    `json:"index"`
+	View  int    `json:"view"` // view the vote acts on
+	Type  string `json:"type"`
+}
+
+// Health of the connection to a peer
+type PeerStatus struct {
+	Name       string    `json:"name"`
+	Connected  bool      `json:"connected"`
+	LastHeard  time.Time `json:"last_heard"` // zero if never heard from
+	Complaints int       `json:"complaints"` // verified complaints against the peer
+	Censoring  bool      `json:"censoring"`
+}
+
+// Record that a message was received from a peer
+func (sn *Node) heardFrom(name string) {
+	sn.peermu.Lock()
+	sn.lastHeard[name] = time.Now()
+	sn.peermu.Unlock()
+}
+
+// Report the state of the node
+func (sn *Node) Status() *NodeStatus {
+	sn.viewmu.Lock()
+	view := sn.ViewNo
+	changing := sn.ChangingView
+	sn.viewmu.Unlock()
+
+	st := &NodeStatus{
+		Name:            sn.Name(),
+		View:            view,
+		Role:            "regular",
+		Root:            sn.RootFor(view),
+		NextRoot:        sn.RootFor(view + 1),
+		Parent:          sn.Parent(view),
+		Children:        make([]string, 0),
+		LastRound:       sn.LastRound(),
+		LastSeenVote:    int(atomic.LoadInt64(&sn.LastSeenVote)),
+		LastAppliedVote: int(atomic.LoadInt64(&sn.LastAppliedVote)),
+		PendingVotes:    make([]VoteSummary, 0),
+		ChangingView:    changing,
+		ShuttingDown:    sn.ShuttingDown(),
+		Peers:           make([]PeerStatus, 0)}
+	if sn.IsRoot(view) {
+		st.Role = "root"
+	}
+	for name := range sn.Children(view) {
+		st.Children = append(st.Children, name)
+	}
+	sort.Strings(st.Children)
+
+	for v, votes := range sn.actionsAfter(view) {
+		for _, vote := range votes {
+			st.PendingVotes = append(st.PendingVotes,
+				VoteSummary{Index: vote.Index, View: v, Type: VoteRoundType(vote.Type).String()})
+		}
+	}
+
+	sn.peermu.Lock()
+	for name, c := range sn.Peers() {
+		st.Peers = append(st.Peers, PeerStatus{
+			Name:       name,
+			Connected:  !c.Closed(),
+			LastHeard:  sn.lastHeard[name],
+			Complaints: len(sn.Complaints(name)),
+			Censoring:  sn.Censoring(name)})
+	}
+	sn.peermu.Unlock()
+	sort.Sort(byPeerName(st.Peers))
+	return st
+}
+
+type byPeerName []PeerStatus
+
+func (p byPeerName) Len() int           { return len(p) }
+func (p byPeerName) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p byPeerName) Less(i, j int) bool { return p[i].Name < p[j].Name }
+
+// Ask for a view change. Only the root of the next view can start it:
+// other nodes forward the request to it, which needs a connection to it.
+func (sn *Node) RequestViewChange() error {
+	sn.viewmu.Lock()
+	view := sn.ViewNo + 1
+	sn.viewmu.Unlock()
+
+	root := sn.RootFor(view)
+	if root == sn.Name() {
+		return sn.TryViewChange(view, false)
+	}
+	sig := ElGamalSign(sn.suite, random.Stream, viewChangeDigest(sn.suite, view, sn.Name()), sn.PrivKey)
+	return sn.PutTo(context.TODO(), root, &SigningMessage{
+		Type:         GroupChange,
+		View:         view,
+		LastSeenVote: int(atomic.LoadInt64(&sn.LastSeenVote)),
+		Vrm: &VoteRequestMessage{
+			Vote: &Vote{Type: ViewChangeVT, Vcv: &ViewChangeVote{View: view}},
+			Sig:  &sig}})
+}
+
+// Digest signed by name to ask for a change to view
+func viewChangeDigest(suite abstract.Suite, view int, name string) []byte {
+	h := suite.Hash()
+	h.Write([]byte("viewchange"))
+	h.Write(intToByteSlice(view))
+	h.Write([]byte(name))
+	return h.Sum(nil)
+}
+
+// Start the view change requested by from, a member of the current view,
+// if we are the root of the next view
+func (sn *Node) handleViewChangeRequest(from string, vrm *VoteRequestMessage) error {
+	sn.viewmu.Lock()
+	view := sn.ViewNo
+	sn.viewmu.Unlock()
+
+	next := vrm.Vote.Vcv.View
+	if next != view+1 {
+		return errors.New("view change requested for a view other than the next one")
+	}
+	if sn.RootFor(next) != sn.Name() {
+		return errors.New("view change requested from a node not root of the next view")
+	}
+	member := false
+	for _, h := range sn.HostListOn(view) {
+		member = member || h == from
+	}
+	key := sn.keyOf(from)
+	if !member || key == nil {
+		return errors.New("view change requested by non member: " + from)
+	}
+	if vrm.Sig == nil {
+		return errors.New("unsigned view change request")
+	}
+	if err := ElGamalVerify(sn.suite, viewChangeDigest(sn.suite, next, from), key, *vrm.Sig); err != nil {
+		return errors.New("invalid signature on view change request")
+	}
+	return sn.TryViewChange(next, false)
+}
+
+// Propose to add name to the group as a child of parent
+func (sn *Node) ProposeAdd(name, parent string) error {
+	return sn.proposeVote(&Vote{Type: AddVT, Av: &AddVote{Name: name, Parent: parent}})
+}
+
+// Propose to remove name, child of parent, from the group
+func (sn *Node) ProposeRemove(name, parent string) error {
+	return sn.proposeVote(&Vote{Type: RemoveVT, Rv: &RemoveVote{Name: name, Parent: parent}})
+}
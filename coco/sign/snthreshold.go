@@ -0,0 +1,538 @@
+package sign
+
+import (
+	"errors"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+
+	"github.com/dedis/crypto/abstract"
+	"github.com/dedis/crypto/poly"
+	"github.com/dedis/crypto/random"
+	"github.com/dedis/prifi/coco/coconet"
+)
+
+// Threshold signatures
+//
+// In Threshold mode the group signs under a single key. At setup the root
+// runs a distributed key generation over the tree: the hosts send their
+// public keys up, then each of them deals shares of a random secret to
+// every host, along with the public polynomial to check them against
+// (dedis/crypto/poly). Shares are encrypted to the key of their host, so
+// the deals can travel through the tree. Hosts and keys are those of the
+// configured roster of the view, which every host checks the ones it is
+// sent against, and dealers sign their deals. The share of a host is the
+// sum of the shares dealt to it and the group key the sum of the dealt
+// secrets: no host ever knows the group secret.
+//
+// Signing rounds run as with Merkle trees, but commitments carry the
+// indexes of the hosts that committed. Once at least Threshold hosts did,
+// the root sends their indexes with the challenge and every host weighs
+// its share by its Lagrange coefficient for that set: the responses add up
+// to a Schnorr signature under the group key, whichever hosts took part.
+// A host failing between its commitment and its response fails the round,
+// as its nonce can not be left out of a threshold signature; hosts that
+// Abstain commit to no nonce and leave the signature to the others.
+// Key generation needs every host of the group to answer, and hosts
+// added to the group later take no part in signatures.
+
+// phases of the key generation, each one a pass down and up the tree
+const (
+	keyGenCollect = iota + 1 // public keys of the hosts are sent up
+	keyGenDeal               // deals are sent up
+	keyGenFinish             // hosts take their share, acknowledgements are sent up
+)
+
+// Shares of a random secret dealt by a host to all hosts
+type Deal struct {
+	Dealer string
+	Commit []byte            // public polynomial of the dealer
+	Shares []abstract.Secret // share of every host, encrypted to its key
+	Sig    BasicSig          // signature of the dealer on its deal
+}
+
+// Digest of a deal for t of hosts, signed by its dealer
+func (d *Deal) Digest(suite abstract.Suite, t int, hosts []string) []byte {
+	h := suite.Hash()
+	h.Write([]byte(d.Dealer))
+	h.Write(intToByteSlice(t))
+	for _, host := range hosts {
+		h.Write(intToByteSlice(len(host)))
+		h.Write([]byte(host))
+	}
+	h.Write(d.Commit)
+	for _, s := range d.Shares {
+		if s == nil {
+			continue
+		}
+		b, _ := s.MarshalBinary()
+		h.Write(b)
+	}
+	return h.Sum(nil)
+}
+
+// Sent down by the root to start a phase of the key generation,
+// and up by every node with the contributions of its subtree
+type KeyGenMessage struct {
+	Phase int
+	T     int              // hosts needed for a signature
+	Hosts []string         // hosts of the group, sorted
+	Keys  []abstract.Point // public keys of the hosts
+	Deals []*Deal
+	Err   string // first error met in the subtree
+}
+
+// Our part of the group key
+type thresholdKey struct {
+	t         int
+	hosts     []string
+	index     int              // our index in hosts
+	share     abstract.Secret  // our share of the group secret
+	groupKey  abstract.Point   // key every signature verifies against
+	pubShares []abstract.Point // public shares of every host
+}
+
+// State of the phase of key generation we take part in
+type keyGen struct {
+	kgm     *KeyGenMessage // message that started the phase
+	own     *KeyGenMessage // our contribution
+	replies []*KeyGenMessage
+	done    chan error // on the root only
+}
+
+// Key every signature of the group verifies against, nil before key generation
+func (sn *Node) GroupKey() abstract.Point {
+	if tk := sn.thresholdKey(); tk != nil {
+		return tk.groupKey
+	}
+	return nil
+}
+
+func (sn *Node) thresholdKey() *thresholdKey {
+	sn.thresholdmu.Lock()
+	defer sn.thresholdmu.Unlock()
+	return sn.tkey
+}
+
+// Set up the key of the group, *only* called by the root.
+// Does nothing outside of Threshold mode or once the key is set up.
+func (sn *Node) StartKeyGeneration() error {
+	if sn.Type != Threshold || sn.GroupKey() != nil {
+		return nil
+	}
+	sn.viewmu.Lock()
+	view := sn.ViewNo
+	sn.viewmu.Unlock()
+	if !sn.IsRoot(view) {
+		return errors.New("key generation must be started by the root")
+	}
+
+	done := make(chan error, 1)
+	sn.thresholdmu.Lock()
+	if sn.keygen != nil {
+		sn.thresholdmu.Unlock()
+		return errors.New("key generation already running")
+	}
+	sn.keygen = &keyGen{done: done}
+	sn.thresholdmu.Unlock()
+	defer func() {
+		sn.thresholdmu.Lock()
+		sn.keygen = nil
+		sn.thresholdmu.Unlock()
+	}()
+
+	sn.keyGenPhase(view, &KeyGenMessage{Phase: keyGenCollect, T: sn.config.Threshold})
+	select {
+	case err := <-done:
+		return err
+	case <-sn.closed:
+		return errors.New("closed")
+	case <-time.After(MAX_WILLING_TO_WAIT):
+		return errors.New("key generation timed out")
+	}
+}
+
+// Take part in a phase of the key generation and pass it on to our children
+func (sn *Node) keyGenPhase(view int, kgm *KeyGenMessage) {
+	own := &KeyGenMessage{Phase: kgm.Phase}
+	var err error
+	switch kgm.Phase {
+	case keyGenCollect:
+		own.Hosts = []string{sn.Name()}
+		own.Keys = []abstract.Point{sn.PubKey}
+	case keyGenDeal:
+		var d *Deal
+		if d, err = sn.deal(view, kgm); err == nil {
+			own.Deals = []*Deal{d}
+		}
+	case keyGenFinish:
+		err = sn.setThresholdKey(view, kgm)
+	default:
+		err = errors.New("unknown key generation phase")
+	}
+	if err != nil {
+		log.Errorln(sn.Name(), "key generation:", err)
+		own.Err = sn.Name() + ": " + err.Error()
+	}
+
+	sn.thresholdmu.Lock()
+	kg := &keyGen{kgm: kgm, own: own}
+	if sn.keygen != nil {
+		kg.done = sn.keygen.done
+	}
+	sn.keygen = kg
+	sn.thresholdmu.Unlock()
+
+	messgs := make([]coconet.BinaryMarshaler, sn.NChildren(view))
+	for i := range messgs {
+		messgs[i] = &SigningMessage{
+			Type:         KeyGen,
+			View:         view,
+			LastSeenVote: int(atomic.LoadInt64(&sn.LastSeenVote)),
+			Kgm:          kgm}
+	}
+	if err := sn.PutDown(context.TODO(), view, messgs); err != nil {
+		log.Errorln(sn.Name(), "unable to pass on key generation:", err)
+	}
+	if len(sn.Children(view)) == 0 {
+		sn.keyGenReply(view, nil)
+	}
+}
+
+// Count the contribution of a child, and once all are in
+// send those of our subtree up or start the next phase
+func (sn *Node) keyGenReply(view int, kgm *KeyGenMessage) {
+	sn.thresholdmu.Lock()
+	kg := sn.keygen
+	if kg == nil || kg.kgm == nil || kgm != nil && kgm.Phase != kg.kgm.Phase {
+		sn.thresholdmu.Unlock()
+		return
+	}
+	if kgm != nil {
+		kg.replies = append(kg.replies, kgm)
+	}
+	if len(kg.replies) < len(sn.Children(view)) {
+		sn.thresholdmu.Unlock()
+		return
+	}
+	merged := &KeyGenMessage{Phase: kg.kgm.Phase}
+	for _, m := range append([]*KeyGenMessage{kg.own}, kg.replies...) {
+		merged.Hosts = append(merged.Hosts, m.Hosts...)
+		merged.Keys = append(merged.Keys, m.Keys...)
+		merged.Deals = append(merged.Deals, m.Deals...)
+		if merged.Err == "" {
+			merged.Err = m.Err
+		}
+	}
+	kg.replies = nil
+	sn.thresholdmu.Unlock()
+
+	if sn.IsRoot(view) {
+		sn.keyGenNext(view, kg, merged)
+		return
+	}
+	sn.PutUp(context.TODO(), view, &SigningMessage{
+		Type:         KeyGenReply,
+		View:         view,
+		LastSeenVote: int(atomic.LoadInt64(&sn.LastSeenVote)),
+		Kgm:          merged})
+}
+
+// Start the phase after the one whose contributions are merged
+func (sn *Node) keyGenNext(view int, kg *keyGen, merged *KeyGenMessage) {
+	finish := func(err error) {
+		if kg.done != nil {
+			kg.done <- err
+		}
+	}
+	if merged.Err != "" {
+		finish(errors.New(merged.Err))
+		return
+	}
+
+	switch merged.Phase {
+	case keyGenCollect:
+		if len(merged.Keys) != len(merged.Hosts) {
+			finish(errors.New("hosts and keys do not match"))
+			return
+		}
+		hosts, keys, err := sn.keyGenRoster(view)
+		if err != nil {
+			finish(err)
+			return
+		}
+		// every host of the roster must answer with its configured key
+		collected := make(map[string]abstract.Point, len(merged.Hosts))
+		for i, h := range merged.Hosts {
+			collected[h] = merged.Keys[i]
+		}
+		if len(collected) != len(hosts) {
+			finish(errors.New("hosts outside the roster took part"))
+			return
+		}
+		for i, h := range hosts {
+			if k := collected[h]; k == nil || !k.Equal(keys[i]) {
+				finish(errors.New("no configured key from " + h))
+				return
+			}
+		}
+		n := len(hosts)
+		next := &KeyGenMessage{Phase: keyGenDeal, T: kg.kgm.T, Hosts: hosts, Keys: keys}
+		if next.T == 0 {
+			next.T = n/2 + 1
+		}
+		if next.T > n {
+			finish(errors.New("threshold above the number of hosts"))
+			return
+		}
+		sn.keyGenPhase(view, next)
+	case keyGenDeal:
+		next := &KeyGenMessage{Phase: keyGenFinish, T: kg.kgm.T, Hosts: kg.kgm.Hosts, Keys: kg.kgm.Keys}
+		deals := make(map[string]*Deal)
+		for _, d := range merged.Deals {
+			deals[d.Dealer] = d
+		}
+		for i, h := range next.Hosts {
+			d := deals[h]
+			if d == nil {
+				finish(errors.New("no deal from " + h))
+				return
+			}
+			if err := ElGamalVerify(sn.suite, d.Digest(sn.suite, next.T, next.Hosts), next.Keys[i], d.Sig); err != nil {
+				finish(errors.New("deal of " + h + " not signed by " + h))
+				return
+			}
+			next.Deals = append(next.Deals, d)
+		}
+		sn.keyGenPhase(view, next)
+	case keyGenFinish:
+		log.Println(sn.Name(), "set up threshold key for", len(kg.kgm.Hosts), "hosts")
+		finish(nil)
+	}
+}
+
+// Mask of the share dealt by dealer to host, from their Diffie-Hellman key
+func shareMask(suite abstract.Suite, dh abstract.Point, dealer, host string) abstract.Secret {
+	h := suite.Hash()
+	writePoints(h, dh)
+	h.Write([]byte(dealer))
+	h.Write([]byte(host))
+	return suite.Secret().Pick(suite.Cipher(h.Sum(nil)))
+}
+
+// Hosts of the configured roster of view, sorted, and their keys
+func (sn *Node) keyGenRoster(view int) ([]string, []abstract.Point, error) {
+	hosts := make([]string, len(sn.HostListOn(view)))
+	copy(hosts, sn.HostListOn(view))
+	sort.Strings(hosts)
+	keys := make([]abstract.Point, len(hosts))
+	for i, h := range hosts {
+		if keys[i] = sn.keyOf(h); keys[i] == nil {
+			return nil, nil, errors.New("no configured key for " + h)
+		}
+	}
+	return hosts, keys, nil
+}
+
+// Check that the hosts and keys of a phase are those of our roster
+func (sn *Node) checkKeyGenRoster(view int, kgm *KeyGenMessage) error {
+	hosts, keys, err := sn.keyGenRoster(view)
+	if err != nil {
+		return err
+	}
+	if len(kgm.Hosts) != len(hosts) || len(kgm.Keys) != len(keys) {
+		return errors.New("key generation hosts are not those of the roster")
+	}
+	for i := range hosts {
+		if kgm.Hosts[i] != hosts[i] || kgm.Keys[i] == nil || !kgm.Keys[i].Equal(keys[i]) {
+			return errors.New("key generation hosts are not those of the roster")
+		}
+	}
+	return nil
+}
+
+// Deal shares of a fresh secret to every host
+func (sn *Node) deal(view int, kgm *KeyGenMessage) (*Deal, error) {
+	n := len(kgm.Hosts)
+	if len(kgm.Keys) != n || kgm.T < 1 || kgm.T > n {
+		return nil, errors.New("invalid key generation parameters")
+	}
+	if err := sn.checkKeyGenRoster(view, kgm); err != nil {
+		return nil, err
+	}
+	secret := sn.suite.Secret().Pick(random.Stream)
+	pri := new(poly.PriPoly).Pick(sn.suite, kgm.T, secret, random.Stream)
+	shares := new(poly.PriShares).Split(pri, n)
+	commit, err := new(poly.PubPoly).Commit(pri, nil).MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Deal{Dealer: sn.Name(), Commit: commit, Shares: make([]abstract.Secret, n)}
+	for i, X := range kgm.Keys {
+		dh := sn.suite.Point().Mul(X, sn.PrivKey)
+		mask := shareMask(sn.suite, dh, sn.Name(), kgm.Hosts[i])
+		d.Shares[i] = sn.suite.Secret().Add(shares.Share(i), mask)
+	}
+	d.Sig = ElGamalSign(sn.suite, random.Stream, d.Digest(sn.suite, kgm.T, kgm.Hosts), sn.PrivKey)
+	return d, nil
+}
+
+// Take our share out of the deals of all hosts
+func (sn *Node) setThresholdKey(view int, kgm *KeyGenMessage) error {
+	if err := sn.checkKeyGenRoster(view, kgm); err != nil {
+		return err
+	}
+	n := len(kgm.Hosts)
+	index := -1
+	for i, h := range kgm.Hosts {
+		if h == sn.Name() {
+			index = i
+		}
+	}
+	if index < 0 || len(kgm.Keys) != n || len(kgm.Deals) != n {
+		return ErrInvalidDeal
+	}
+
+	share := sn.suite.Secret().Zero()
+	var pubs *poly.PubPoly
+	for i, d := range kgm.Deals {
+		if d.Dealer != kgm.Hosts[i] || len(d.Shares) != n {
+			return ErrInvalidDeal
+		}
+		if err := ElGamalVerify(sn.suite, d.Digest(sn.suite, kgm.T, kgm.Hosts), kgm.Keys[i], d.Sig); err != nil {
+			return ErrInvalidDeal
+		}
+		pub := new(poly.PubPoly)
+		pub.Init(sn.suite, kgm.T, nil)
+		if err := pub.UnmarshalBinary(d.Commit); err != nil {
+			return ErrInvalidDeal
+		}
+		dh := sn.suite.Point().Mul(kgm.Keys[i], sn.PrivKey)
+		s := sn.suite.Secret().Sub(d.Shares[index], shareMask(sn.suite, dh, d.Dealer, sn.Name()))
+		if !pub.Check(index, s) {
+			log.Errorln(sn.Name(), "invalid share dealt by", d.Dealer)
+			return ErrInvalidDeal
+		}
+		share.Add(share, s)
+		if pubs == nil {
+			pubs = pub
+		} else {
+			pubs = new(poly.PubPoly).Add(pubs, pub)
+		}
+	}
+
+	tk := &thresholdKey{
+		t:         kgm.T,
+		hosts:     kgm.Hosts,
+		index:     index,
+		share:     share,
+		groupKey:  pubs.SecretCommit(),
+		pubShares: make([]abstract.Point, n)}
+	for i := range tk.pubShares {
+		tk.pubShares[i] = pubs.Eval(i)
+	}
+	sn.thresholdmu.Lock()
+	sn.tkey = tk
+	sn.thresholdmu.Unlock()
+	return nil
+}
+
+// Lagrange coefficient at 0 of the host of index i within signers
+func lagrange(suite abstract.Suite, i int, signers []int) abstract.Secret {
+	num := suite.Secret().One()
+	den := suite.Secret().One()
+	xi := suite.Secret().SetInt64(int64(i + 1))
+	for _, j := range signers {
+		if j == i {
+			continue
+		}
+		xj := suite.Secret().SetInt64(int64(j + 1))
+		num.Mul(num, xj)
+		den.Mul(den, suite.Secret().Sub(xj, xi))
+	}
+	return num.Div(num, den)
+}
+
+// Commit to a fresh nonce as a signer, or to none without a share
+// or when we abstain
+func (sn *Node) initThresholdCommit(round *Round) {
+	tk := sn.thresholdKey()
+	if tk == nil || sn.Abstain {
+		round.Log.v = sn.suite.Secret().Zero()
+		round.Log.V = sn.suite.Point().Null()
+		round.Log.V_hat = sn.suite.Point().Null()
+		return
+	}
+	// a nonce used twice would give our share away
+	round.Log.v = sn.suite.Secret().Pick(random.Stream)
+	round.Log.V = sn.suite.Point().Mul(nil, round.Log.v)
+	round.Log.V_hat = sn.suite.Point().Null()
+	sn.add(round.Log.V_hat, round.Log.V)
+	round.Signers = []int{tk.index}
+}
+
+// Check that enough hosts committed, *only* called by root node
+func (sn *Node) checkSigners(round *Round) error {
+	tk := sn.thresholdKey()
+	if tk == nil {
+		return errors.New("no threshold key: key generation did not run")
+	}
+	sort.Ints(round.Signers)
+	if len(round.Signers) < tk.t {
+		return ErrThresholdNotReached
+	}
+	return nil
+}
+
+// Key our response is computed with: our share weighed
+// for the signers of the round in Threshold mode
+func (sn *Node) signingKey(round *Round) abstract.Secret {
+	if sn.Type != Threshold {
+		return sn.PrivKey
+	}
+	tk := sn.thresholdKey()
+	if tk == nil {
+		return sn.suite.Secret().Zero()
+	}
+	for _, j := range round.SignerSet {
+		if j == tk.index {
+			return sn.suite.Secret().Mul(lagrange(sn.suite, j, round.SignerSet), tk.share)
+		}
+	}
+	// our commitment was left out
+	return sn.suite.Secret().Zero()
+}
+
+// Responses of our subtree are checked against the weighed public shares
+// of its signers, which add up to the group key at the root
+func (sn *Node) thresholdResponses(round *Round, exceptionV_hat abstract.Point) error {
+	if round.Refused || !exceptionV_hat.Equal(sn.suite.Point().Null()) {
+		return ErrSignerFailed
+	}
+	tk := sn.thresholdKey()
+	round.X_hat = sn.suite.Point().Null()
+	if tk == nil {
+		return nil
+	}
+	for _, j := range round.Signers {
+		if j < 0 || j >= len(tk.pubShares) {
+			return ErrSignerFailed
+		}
+		w := sn.suite.Point().Mul(tk.pubShares[j], lagrange(sn.suite, j, round.SignerSet))
+		round.X_hat.Add(round.X_hat, w)
+	}
+	return nil
+}
+
+// Check that a record holds a threshold signature under groupKey
+func VerifyThreshold(suite abstract.Suite, groupKey abstract.Point, rr *RoundRecord) error {
+	if rr == nil || rr.X_hat == nil || groupKey == nil || !rr.X_hat.Equal(groupKey) ||
+		rr.ExceptionV_hat != nil && !rr.ExceptionV_hat.Equal(suite.Point().Null()) {
+		return ErrInvalidRecord
+	}
+	return verifySignature(suite, rr, groupKey)
+}
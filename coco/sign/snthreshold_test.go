@@ -0,0 +1,121 @@
+package sign_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/dedis/prifi/coco/sign"
+	"github.com/dedis/prifi/coco/test/oldconfig"
+)
+
+// Every signature of a threshold group verifies against the group key
+func TestTreeSmallConfigThreshold(t *testing.T) {
+	hc, err := oldconfig.LoadConfig("../test/data/exconf.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = hc.Run(false, sign.Threshold); err != nil {
+		t.Fatal("key generation failed:", err)
+	}
+	defer func() {
+		for _, sn := range hc.SNodes {
+			sn.Close()
+		}
+		time.Sleep(1 * time.Second)
+	}()
+
+	root := hc.SNodes[0]
+	suite := root.Suite()
+	X := root.GroupKey()
+	if X == nil {
+		t.Fatal("no group key on the root")
+	}
+	for _, sn := range hc.SNodes {
+		if k := sn.GroupKey(); k == nil || !k.Equal(X) {
+			t.Fatal(sn.Name(), "holds another group key")
+		}
+		if k := sn.GroupKey(); k.Equal(sn.PubKey) {
+			t.Fatal(sn.Name(), "holds the group key as its own")
+		}
+	}
+
+	N := 3
+	for i := 1; i <= N; i++ {
+		root.LogTest = []byte("Hello Threshold" + strconv.Itoa(i))
+		err = root.StartAnnouncement(&sign.AnnouncementMessage{LogTest: root.LogTest, Round: i})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	records, err := root.History(1, N)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rr := range records {
+		if err := sign.VerifyThreshold(suite, X, rr); err != nil {
+			t.Fatal("round", rr.Round, "not signed under the group key:", err)
+		}
+	}
+	if err := sign.VerifyThreshold(suite, root.PubKey, records[0]); err == nil {
+		t.Fatal("threshold signature accepted under another key")
+	}
+}
+
+// Hosts that abstain are left out: a strict subset of the hosts, as
+// large as the threshold, signs under the same group key
+func TestThresholdSubset(t *testing.T) {
+	hc, err := oldconfig.LoadConfig("../test/data/exconf.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	abstaining := []*sign.Node{hc.SNodes[2], hc.SNodes[5]}
+	for _, sn := range abstaining {
+		sn.Abstain = true
+	}
+	if err = hc.Run(false, sign.Threshold); err != nil {
+		t.Fatal("key generation failed:", err)
+	}
+	defer func() {
+		for _, sn := range hc.SNodes {
+			sn.Close()
+		}
+		time.Sleep(1 * time.Second)
+	}()
+
+	root := hc.SNodes[0]
+	X := root.GroupKey()
+	if X == nil {
+		t.Fatal("no group key on the root")
+	}
+	for _, sn := range abstaining {
+		if k := sn.GroupKey(); k == nil || !k.Equal(X) {
+			t.Fatal(sn.Name(), "holds another group key")
+		}
+	}
+
+	N := 2
+	for i := 1; i <= N; i++ {
+		root.LogTest = []byte("Hello Subset" + strconv.Itoa(i))
+		err = root.StartAnnouncement(&sign.AnnouncementMessage{LogTest: root.LogTest, Round: i})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	round := root.GetRound(N)
+	if round == nil {
+		t.Fatal("last round not in memory")
+	}
+	if n := len(round.SignerSet); n != len(hc.SNodes)-len(abstaining) {
+		t.Fatal(n, "hosts signed, expected", len(hc.SNodes)-len(abstaining))
+	}
+	records, err := root.History(1, N)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rr := range records {
+		if err := sign.VerifyThreshold(root.Suite(), X, rr); err != nil {
+			t.Fatal("round", rr.Round, "signed by a subset not under the group key:", err)
+		}
+	}
+}
@@ -0,0 +1,402 @@
+package sign
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+
+	"github.com/dedis/crypto/abstract"
+	"github.com/dedis/crypto/random"
+)
+
+// Latency aware trees
+//
+// Nodes ping their peers every GossipTime and keep the round trip times
+// measured, along with those their peers reported, in a latency table.
+// Every host signs the row of round trip times it measured, and rows are
+// only kept once checked against the key of the host they come from.
+// With a BranchingFactor configured, the root of a new view builds the
+// tree minimizing the latency of a round from that table and sends it
+// in the view change vote: every node takes its parent and children
+// from it instead of reusing the links of the previous view. Hosts that
+// joined or left are accounted for, as the tree is built from the
+// hostlist of the new view. A node seeing a link of its tree become much
+// slower than when the tree was built asks for a view change.
+
+// latency assumed for links never measured
+const UnknownLatency = 1 * time.Second
+
+// a link degraded when its round trip time grew by this factor
+// and by more than MinDegradation
+const DegradeFactor = 3
+const MinDegradation = 50 * time.Millisecond
+
+// Tree of a view: Parents[i] is the parent of Hosts[i], "" for the root.
+// Latencies[i] is the round trip time measured on that link, in ns.
+type Topology struct {
+	Root      string
+	Hosts     []string
+	Parents   []string
+	Latencies []int64
+}
+
+// Parent of name in the tree, and whether it is in the tree
+func (t *Topology) Parent(name string) (string, bool) {
+	for i, h := range t.Hosts {
+		if h == name {
+			return t.Parents[i], true
+		}
+	}
+	return "", false
+}
+
+// Children of name in the tree, sorted
+func (t *Topology) Children(name string) []string {
+	children := make([]string, 0)
+	for i, p := range t.Parents {
+		if p == name {
+			children = append(children, t.Hosts[i])
+		}
+	}
+	sort.Strings(children)
+	return children
+}
+
+// Latency recorded for the link between name and its parent
+func (t *Topology) Latency(name string) time.Duration {
+	for i, h := range t.Hosts {
+		if h == name && i < len(t.Latencies) {
+			return time.Duration(t.Latencies[i])
+		}
+	}
+	return 0
+}
+
+// Check that t is a tree rooted at root over exactly hostlist,
+// with at most bf children per node
+func (t *Topology) Validate(root string, hostlist []string, bf int) error {
+	if t.Root != root {
+		return errors.New("topology rooted at wrong host")
+	}
+	if len(t.Hosts) != len(t.Parents) || len(t.Hosts) != len(hostlist) {
+		return errors.New("topology does not cover the hostlist")
+	}
+	members := make(map[string]bool, len(hostlist))
+	for _, h := range hostlist {
+		members[h] = true
+	}
+	parents := make(map[string]string, len(t.Hosts))
+	nchildren := make(map[string]int)
+	for i, h := range t.Hosts {
+		if !members[h] {
+			return errors.New("topology holds host not on the view: " + h)
+		}
+		if _, ok := parents[h]; ok {
+			return errors.New("topology holds host twice: " + h)
+		}
+		p := t.Parents[i]
+		if (p == "") != (h == root) {
+			return errors.New("topology must have the root as only parentless host")
+		}
+		if p != "" && !members[p] {
+			return errors.New("topology parent not on the view: " + p)
+		}
+		parents[h] = p
+		nchildren[p]++
+		if p != "" && bf > 0 && nchildren[p] > bf {
+			return errors.New("topology exceeds branching factor at " + p)
+		}
+	}
+	// every host must reach the root
+	for _, h := range t.Hosts {
+		seen := make(map[string]bool)
+		for p := h; p != root; p = parents[p] {
+			if seen[p] {
+				return errors.New("topology has a cycle through " + h)
+			}
+			seen[p] = true
+		}
+	}
+	return nil
+}
+
+// Build the tree rooted at root over hosts, with at most bf children per
+// node, that keeps the latency from the root to every host low. Hosts are
+// attached one at a time to the node of the tree that can still take
+// children and gives them the lowest latency to the root.
+func LatencyTree(root string, hosts []string, bf int, rtt func(a, b string) time.Duration) *Topology {
+	sorted := make([]string, len(hosts))
+	copy(sorted, hosts)
+	sort.Strings(sorted)
+
+	t := &Topology{Root: root, Hosts: []string{root}, Parents: []string{""}, Latencies: []int64{0}}
+	dist := map[string]time.Duration{root: 0}
+	nchildren := make(map[string]int)
+	attached := []string{root}
+
+	for len(attached) < len(sorted) {
+		best, bestParent := "", ""
+		var bestDist, bestLink time.Duration
+		for _, h := range sorted {
+			if _, ok := dist[h]; ok {
+				continue
+			}
+			for _, p := range attached {
+				if bf > 0 && nchildren[p] >= bf {
+					continue
+				}
+				link := rtt(p, h)
+				if best == "" || dist[p]+link < bestDist {
+					best, bestParent, bestDist, bestLink = h, p, dist[p]+link, link
+				}
+			}
+		}
+		if best == "" {
+			break
+		}
+		dist[best] = bestDist
+		nchildren[bestParent]++
+		attached = append(attached, best)
+		t.Hosts = append(t.Hosts, best)
+		t.Parents = append(t.Parents, bestParent)
+		t.Latencies = append(t.Latencies, int64(bestLink))
+	}
+	return t
+}
+
+// Round trip times measured by a host to its peers
+type LatencyRow struct {
+	From  string
+	Peers []string
+	RTTs  []int64 // in ns
+	Time  int64   // unix time in ns the row was produced at
+
+	Sig BasicSig // signature of From on the row
+}
+
+// Digest of a row, without its signature
+func (r *LatencyRow) Digest(suite abstract.Suite) []byte {
+	h := suite.Hash()
+	h.Write([]byte(r.From))
+	binary.Write(h, binary.LittleEndian, r.Time)
+	binary.Write(h, binary.LittleEndian, int64(len(r.Peers)))
+	for i, p := range r.Peers {
+		binary.Write(h, binary.LittleEndian, int64(len(p)))
+		h.Write([]byte(p))
+		if i < len(r.RTTs) {
+			binary.Write(h, binary.LittleEndian, r.RTTs[i])
+		}
+	}
+	return h.Sum(nil)
+}
+
+// Ping and Pong messages measure round trip times and spread latency rows
+type LatencyMessage struct {
+	Sent int64 // unix time in ns the ping was sent at
+	Rows []*LatencyRow
+}
+
+// Our own latency row and the newest rows we know of other hosts
+func (sn *Node) latencyRows() []*LatencyRow {
+	sn.latencymu.Lock()
+	defer sn.latencymu.Unlock()
+	own := &LatencyRow{From: sn.Name(), Time: time.Now().UnixNano()}
+	for p, d := range sn.rtts {
+		own.Peers = append(own.Peers, p)
+		own.RTTs = append(own.RTTs, int64(d))
+	}
+	own.Sig = ElGamalSign(sn.suite, random.Stream, own.Digest(sn.suite), sn.PrivKey)
+	rows := []*LatencyRow{own}
+	for _, r := range sn.latencyTable {
+		rows = append(rows, r)
+	}
+	return rows
+}
+
+// Keep the rows newer than those we know, signed by the host they come from
+func (sn *Node) mergeLatencyRows(rows []*LatencyRow) {
+	for _, r := range rows {
+		if r == nil || r.From == sn.Name() || len(r.Peers) != len(r.RTTs) {
+			continue
+		}
+		sn.latencymu.Lock()
+		old, ok := sn.latencyTable[r.From]
+		sn.latencymu.Unlock()
+		if ok && old.Time >= r.Time {
+			continue
+		}
+		key := sn.keyOf(r.From)
+		if key == nil || ElGamalVerify(sn.suite, r.Digest(sn.suite), key, r.Sig) != nil {
+			log.Warnln(sn.Name(), "dropping unsigned latency row of", r.From)
+			continue
+		}
+		sn.latencymu.Lock()
+		if old, ok := sn.latencyTable[r.From]; !ok || old.Time < r.Time {
+			sn.latencyTable[r.From] = r
+		}
+		sn.latencymu.Unlock()
+	}
+}
+
+// Round trip time between a and b, from our measures or reported ones
+func (sn *Node) Latency(a, b string) time.Duration {
+	if a == b {
+		return 0
+	}
+	sn.latencymu.Lock()
+	defer sn.latencymu.Unlock()
+	if a == sn.Name() || b == sn.Name() {
+		other := a
+		if a == sn.Name() {
+			other = b
+		}
+		if d, ok := sn.rtts[other]; ok {
+			return d
+		}
+	}
+	for _, pair := range [][2]string{{a, b}, {b, a}} {
+		if r, ok := sn.latencyTable[pair[0]]; ok {
+			for i, p := range r.Peers {
+				if p == pair[1] {
+					return time.Duration(r.RTTs[i])
+				}
+			}
+		}
+	}
+	return UnknownLatency
+}
+
+// Ping all our peers
+func (sn *Node) pingPeers() {
+	lm := &LatencyMessage{Sent: time.Now().UnixNano(), Rows: sn.latencyRows()}
+	for name := range sn.Peers() {
+		go sn.PutTo(context.TODO(), name, &SigningMessage{
+			From:         sn.Name(),
+			Type:         Ping,
+			LastSeenVote: int(atomic.LoadInt64(&sn.LastSeenVote)),
+			Lm:           lm})
+	}
+}
+
+func (sn *Node) handlePing(from string, lm *LatencyMessage) {
+	sn.mergeLatencyRows(lm.Rows)
+	sn.PutTo(context.TODO(), from, &SigningMessage{
+		From:         sn.Name(),
+		Type:         Pong,
+		LastSeenVote: int(atomic.LoadInt64(&sn.LastSeenVote)),
+		Lm:           &LatencyMessage{Sent: lm.Sent, Rows: sn.latencyRows()}})
+}
+
+func (sn *Node) handlePong(from string, lm *LatencyMessage) {
+	rtt := time.Duration(time.Now().UnixNano() - lm.Sent)
+	if rtt < 0 {
+		return
+	}
+	sn.latencymu.Lock()
+	// smooth the measures, as TCP does
+	if old, ok := sn.rtts[from]; ok {
+		rtt = (7*old + rtt) / 8
+	}
+	sn.rtts[from] = rtt
+	sn.latencymu.Unlock()
+	sn.mergeLatencyRows(lm.Rows)
+	sn.checkLinkDegraded(from, rtt)
+}
+
+// Hostlist of view once the pending additions and removals are applied
+func (sn *Node) hostListFor(view int) []string {
+	hl := make([]string, 0)
+	removed := make(map[string]bool)
+	acts := sn.ActionsOn(view)
+	for _, act := range acts {
+		if act.Type == RemoveVT {
+			removed[act.Rv.Name] = true
+		}
+	}
+	for _, h := range sn.HostListOn(view - 1) {
+		if !removed[h] {
+			hl = append(hl, h)
+		}
+	}
+	for _, act := range acts {
+		if act.Type == AddVT && !removed[act.Av.Name] {
+			hl = append(hl, act.Av.Name)
+		}
+	}
+	return hl
+}
+
+// Tree proposed by root for view, nil without a branching factor
+func (sn *Node) proposeTopology(view int, root string) *Topology {
+	if sn.config.BranchingFactor == 0 {
+		return nil
+	}
+	return LatencyTree(root, sn.hostListFor(view), sn.config.BranchingFactor, sn.Latency)
+}
+
+// Take our place in the tree of a view change vote:
+// replace the links of view by those of the topology
+func (sn *Node) applyTopology(view int, from string, t *Topology) error {
+	parent, ok := t.Parent(sn.Name())
+	if !ok {
+		return errors.New("not part of the proposed topology")
+	}
+	if parent != from && from != "" {
+		return errors.New("view change proposal not sent by our parent in the topology")
+	}
+	children := t.Children(sn.Name())
+	for _, c := range children {
+		if _, ok := sn.Peers()[c]; ok {
+			continue
+		}
+		if err := sn.ConnectTo(c); err != nil {
+			log.Warnln(sn.Name(), "unable to connect to new child", c, ":", err)
+		}
+	}
+	sn.NewView(view, parent, children, sn.HostListOn(view))
+
+	sn.latencymu.Lock()
+	sn.topologies[view] = t
+	sn.latencymu.Unlock()
+	return nil
+}
+
+// Ask for a new tree once a link of the current one degraded
+func (sn *Node) checkLinkDegraded(peer string, rtt time.Duration) {
+	sn.viewmu.Lock()
+	view := sn.ViewNo
+	sn.viewmu.Unlock()
+
+	sn.latencymu.Lock()
+	t := sn.topologies[view]
+	if t == nil || sn.degradedView >= view {
+		sn.latencymu.Unlock()
+		return
+	}
+	var built time.Duration
+	if sn.IsParent(view, peer) {
+		built = t.Latency(sn.Name())
+	} else if sn.IsChild(view, peer) {
+		built = t.Latency(peer)
+	} else {
+		sn.latencymu.Unlock()
+		return
+	}
+	degraded := built > 0 && rtt > DegradeFactor*built && rtt-built > MinDegradation
+	if degraded {
+		sn.degradedView = view
+	}
+	sn.latencymu.Unlock()
+
+	if degraded {
+		log.Warnln(sn.Name(), "link to", peer, "degraded from", built, "to", rtt, ": asking for view change")
+		if err := sn.RequestViewChange(); err != nil {
+			log.Errorln(sn.Name(), "unable to ask for view change:", err)
+		}
+	}
+}
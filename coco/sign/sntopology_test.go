@@ -0,0 +1,86 @@
+package sign_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dedis/crypto/nist"
+	"github.com/dedis/crypto/random"
+	"github.com/dedis/prifi/coco/sign"
+)
+
+// Two sites far apart: hosts of the root site are reached without
+// leaving it, those of the other site with a single slow link on the way
+func TestLatencyTree(t *testing.T) {
+	hosts := []string{"a0", "a1", "a2", "a3", "b0", "b1", "b2", "b3"}
+	rtt := func(x, y string) time.Duration {
+		if x[0] == y[0] {
+			return 2 * time.Millisecond
+		}
+		return 100 * time.Millisecond
+	}
+
+	tree := sign.LatencyTree("a0", hosts, 2, rtt)
+	if err := tree.Validate("a0", hosts, 2); err != nil {
+		t.Fatal("invalid tree:", err)
+	}
+	for _, h := range hosts {
+		var d time.Duration
+		for n := h; n != "a0"; {
+			p, _ := tree.Parent(n)
+			d += rtt(n, p)
+			n = p
+		}
+		if h[0] == 'a' && d > 10*time.Millisecond || d > 110*time.Millisecond {
+			t.Error(h, "is", d, "away from the root")
+		}
+	}
+}
+
+func TestTopologyValidate(t *testing.T) {
+	hosts := []string{"h0", "h1", "h2"}
+	tests := []struct {
+		t   *sign.Topology
+		err string
+	}{
+		{&sign.Topology{Root: "h0", Hosts: hosts, Parents: []string{"", "h0", "h1"}}, ""},
+		{&sign.Topology{Root: "h1", Hosts: hosts, Parents: []string{"", "h0", "h1"}}, "wrong host"},
+		{&sign.Topology{Root: "h0", Hosts: hosts[:2], Parents: []string{"", "h0"}}, "cover"},
+		{&sign.Topology{Root: "h0", Hosts: hosts, Parents: []string{"", "h2", "h1"}}, "cycle"},
+		{&sign.Topology{Root: "h0", Hosts: hosts, Parents: []string{"", "h0", "h0"}}, "branching"},
+	}
+	for i, test := range tests {
+		err := test.t.Validate("h0", hosts, 1)
+		if test.err == "" && err != nil {
+			t.Error("test", i, "rejected valid topology:", err)
+		}
+		if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Error("test", i, "expected error", test.err, "got", err)
+		}
+	}
+}
+
+// Latency rows are signed by the host that measured them
+func TestLatencyRowSignature(t *testing.T) {
+	suite := nist.NewAES128SHA256P256()
+	x := suite.Secret().Pick(random.Stream)
+	X := suite.Point().Mul(nil, x)
+	r := &sign.LatencyRow{From: "a0", Peers: []string{"a1", "b0"},
+		RTTs: []int64{int64(2 * time.Millisecond), int64(100 * time.Millisecond)}, Time: time.Now().UnixNano()}
+	r.Sig = sign.ElGamalSign(suite, random.Stream, r.Digest(suite), x)
+	if err := sign.ElGamalVerify(suite, r.Digest(suite), X, r.Sig); err != nil {
+		t.Fatal("signed row rejected:", err)
+	}
+
+	// a relay can not make a link look faster
+	r.RTTs[1] = int64(time.Millisecond)
+	if err := sign.ElGamalVerify(suite, r.Digest(suite), X, r.Sig); err == nil {
+		t.Fatal("altered row accepted")
+	}
+	r.RTTs[1] = int64(100 * time.Millisecond)
+	r.Peers[0], r.Peers[1] = r.Peers[1], r.Peers[0]
+	if err := sign.ElGamalVerify(suite, r.Digest(suite), X, r.Sig); err == nil {
+		t.Fatal("row accepted with swapped peers")
+	}
+}
@@ -58,9 +58,9 @@ func (sn *Node) ReceivedHeartbeat(view int) {
 	// hearbeat is nil if we have sust close the signing node
 	if sn.heartbeat != nil {
 		sn.heartbeat.Stop()
-		sn.heartbeat = time.AfterFunc(HEARTBEAT, func() {
+		sn.heartbeat = time.AfterFunc(sn.config.Heartbeat, func() {
 			log.Println(sn.Name(), "NO HEARTBEAT - try view change:", view)
-			sn.TryViewChange(view + 1)
+			sn.TryViewChange(view+1, true)
 		})
 	}
 	sn.hbLock.Unlock()
@@ -114,8 +114,7 @@ func (sn *Node) TryFailure(view, Round int) error {
 
 // Create round lasting secret and commit point v and V
 // Initialize log structure for the round
-func (sn *Node) initCommitCrypto(Round int) {
-	round := sn.Rounds[Round]
+func (sn *Node) initCommitCrypto(round *Round) {
 	// generate secret and point commitment for this round
 	rand := sn.suite.Cipher([]byte(sn.Name()))
 	round.Log = SNLog{}
@@ -127,6 +126,11 @@ func (sn *Node) initCommitCrypto(Round int) {
 
 	round.X_hat = sn.suite.Point().Null()
 	sn.add(round.X_hat, sn.PubKey)
+	round.Keys = []abstract.Point{sn.PubKey}
+
+	if sn.Type == Threshold {
+		sn.initThresholdCommit(round)
+	}
 }
 
 func (sn *Node) setUpRound(view int, am *AnnouncementMessage) error {
@@ -159,14 +163,15 @@ func (sn *Node) setUpRound(view int, am *AnnouncementMessage) error {
 		log.Println("***", Round, len(sn.RoundTypes))
 		sn.RoundTypes[Round] = SigningRT
 	} else {
-		sn.RoundTypes[Round] = RoundType(am.Vote.Type)
+		sn.RoundTypes[Round] = VoteRoundType(am.Vote.Type)
 	}
 	sn.roundmu.Unlock()
 
 	// set up commit and response channels for the new round
-	sn.Rounds[Round] = NewRound(sn.suite)
-	sn.initCommitCrypto(Round)
-	sn.Rounds[Round].Vote = am.Vote
+	round := NewRound(sn.suite)
+	sn.initCommitCrypto(round)
+	round.Vote = am.Vote
+	sn.addRound(Round, round)
 
 	// update max seen round
 	sn.roundmu.Lock()
@@ -178,10 +183,6 @@ func (sn *Node) setUpRound(view int, am *AnnouncementMessage) error {
 		sn.RoundsAsRoot += 1
 		// TODO: is sn.Round needed if we have LastSeenRound
 		sn.Round = Round
-
-		// Create my back link to previous round
-		sn.SetBackLink(Round)
-		// sn.SetAccountableRound(Round)
 	}
 
 	return nil
@@ -5,7 +5,9 @@ import "log"
 func (sn *Node) ChangeView(vcv *ViewChangeVote) {
 	// log.Println(sn.Name(), " in CHANGE VIEW")
 	// at this point actions have already been applied
-	// all we need to do is switch our default view
+	// all we need to do is fix the root and switch our default view
+	sn.setFailedRoots(vcv.View, vcv.FailedRoots)
+	sn.setRootFor(vcv.View, vcv.Root)
 	sn.viewmu.Lock()
 	sn.ViewNo = vcv.View
 	sn.viewmu.Unlock()
@@ -0,0 +1,150 @@
+package sign
+
+import (
+	"errors"
+	"sync/atomic"
+
+	log "github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+// Application defined votes
+//
+// Applications run their own decisions (config changes, key rotation...)
+// through the voting layer by registering a VoteType with a VoteHandler.
+// The proposal travels in the vote as opaque bytes produced by Encode;
+// every node decodes it, accepts or rejects it with Validate, and once
+// the vote is confirmed and logged, Apply is called on every node.
+// All nodes of a group must register the same types.
+
+// vote types below FirstAppVT are reserved for the voting layer
+const FirstAppVT VoteType = 100
+
+type VoteHandler struct {
+	Name string
+
+	Encode func(data interface{}) ([]byte, error)
+	Decode func(b []byte) (interface{}, error)
+
+	// Validate decides whether this node votes for the proposal,
+	// nil accepts every proposal
+	Validate func(view int, data interface{}) error
+	// Apply is called with every confirmed proposal, in vote log order
+	Apply func(view int, data interface{})
+
+	// Quorum deciding the votes, nil for DefaultQuorum
+	Quorum *Quorum
+}
+
+// Payload of an application defined vote
+type AppVote struct {
+	Data []byte
+}
+
+// Register the handler of an application defined vote type
+func (sn *Node) RegisterVoteType(vt VoteType, h *VoteHandler) error {
+	if vt < FirstAppVT {
+		return errors.New("vote type reserved for the voting layer")
+	}
+	if h == nil || h.Encode == nil || h.Decode == nil || h.Apply == nil {
+		return errors.New("vote handler must encode, decode and apply")
+	}
+	sn.votemu.Lock()
+	defer sn.votemu.Unlock()
+	if _, ok := sn.voteTypes[vt]; ok {
+		return errors.New("vote type already registered: " + h.Name)
+	}
+	sn.voteTypes[vt] = h
+	return nil
+}
+
+func (sn *Node) voteHandler(vt VoteType) *VoteHandler {
+	sn.votemu.Lock()
+	defer sn.votemu.Unlock()
+	return sn.voteTypes[vt]
+}
+
+// Decode the proposal of an application defined vote
+func (sn *Node) decodeAppVote(v *Vote) (*VoteHandler, interface{}, error) {
+	h := sn.voteHandler(v.Type)
+	if h == nil {
+		return nil, nil, ErrUnknownVoteType
+	}
+	if v.App == nil {
+		return nil, nil, errors.New("application vote without payload")
+	}
+	data, err := h.Decode(v.App.Data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return h, data, nil
+}
+
+// Create a vote for data with the handler registered for vt
+func (sn *Node) NewAppVote(vt VoteType, data interface{}) (*Vote, error) {
+	h := sn.voteHandler(vt)
+	if h == nil {
+		return nil, ErrUnknownVoteType
+	}
+	b, err := h.Encode(data)
+	if err != nil {
+		return nil, err
+	}
+	return &Vote{Type: vt, App: &AppVote{Data: b}}, nil
+}
+
+// Propose data to the group as a vote of type vt.
+// Non root nodes send the proposal up to the root, which starts the vote.
+func (sn *Node) ProposeVote(vt VoteType, data interface{}) error {
+	v, err := sn.NewAppVote(vt, data)
+	if err != nil {
+		return err
+	}
+	return sn.proposeVote(v)
+}
+
+// Start a vote as root or send it up to the root
+func (sn *Node) proposeVote(v *Vote) error {
+	sn.viewmu.Lock()
+	view := sn.ViewNo
+	sn.viewmu.Unlock()
+	if sn.IsRoot(view) {
+		go sn.StartVotingRound(v)
+		return nil
+	}
+	return sn.PutUp(context.TODO(), view, &SigningMessage{
+		Type:         GroupChange,
+		View:         view,
+		LastSeenVote: int(atomic.LoadInt64(&sn.LastSeenVote)),
+		Vrm:          &VoteRequestMessage{Vote: v}})
+}
+
+// Whether this node votes for v
+func (sn *Node) acceptVote(view int, v *Vote) bool {
+	if v.Type < FirstAppVT {
+		return true
+	}
+	h, data, err := sn.decodeAppVote(v)
+	if err != nil {
+		log.Errorln(sn.Name(), "unable to decode vote", v.Index, ":", err)
+		return false
+	}
+	if h.Validate == nil {
+		return true
+	}
+	if err := h.Validate(view, data); err != nil {
+		log.Println(sn.Name(), "votes against", h.Name, "vote", v.Index, ":", err)
+		return false
+	}
+	return true
+}
+
+// Apply a confirmed application defined vote
+func (sn *Node) applyAppVote(v *Vote) {
+	h, data, err := sn.decodeAppVote(v)
+	if err != nil {
+		log.Errorln(sn.Name(), "applyvote:", err)
+		return
+	}
+	h.Apply(v.View, data)
+}
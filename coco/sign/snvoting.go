@@ -12,9 +12,12 @@ func (sn *Node) ApplyVotes(ch chan *Vote) {
 	go func() {
 		for v := range ch {
 			if sn.RoundTypes[v.Round] == EmptyRT {
-				sn.RoundTypes[v.Round] = RoundType(v.Type)
+				sn.RoundTypes[v.Round] = VoteRoundType(v.Type)
 			}
 			sn.ApplyVote(v)
+			if v.Index%SnapshotInterval == 0 {
+				sn.snapshotVoteLog()
+			}
 		}
 	}()
 }
@@ -36,14 +39,41 @@ func (sn *Node) ApplyVote(v *Vote) {
 	case RemoveVT:
 		sn.AddAction(v.Rv.View, v)
 	case ShutdownVT:
-		sn.Close()
+		sn.shutdown(v)
+	case NoOpVT:
 	default:
+		if v.Type >= FirstAppVT {
+			sn.applyAppVote(v)
+			return
+		}
 		log.Errorln("applyvote: unkown vote type")
 	}
 }
 
 func (sn *Node) AddAction(view int, v *Vote) {
+	sn.actionmu.Lock()
 	sn.Actions[view] = append(sn.Actions[view], v)
+	sn.actionmu.Unlock()
+}
+
+// Copy of the votes acting on view
+func (sn *Node) ActionsOn(view int) []*Vote {
+	sn.actionmu.Lock()
+	defer sn.actionmu.Unlock()
+	return append([]*Vote(nil), sn.Actions[view]...)
+}
+
+// Copy of the votes acting on views after view, by view
+func (sn *Node) actionsAfter(view int) map[int][]*Vote {
+	sn.actionmu.Lock()
+	defer sn.actionmu.Unlock()
+	acts := make(map[int][]*Vote)
+	for v, votes := range sn.Actions {
+		if v > view {
+			acts[v] = append([]*Vote(nil), votes...)
+		}
+	}
+	return acts
 }
 
 func (sn *Node) ApplyAction(view int, v *Vote) {
@@ -70,7 +100,7 @@ func (sn *Node) NotifyOfAction(view int, v *Vote) {
 		Type:         GroupChanged,
 		From:         sn.Name(),
 		View:         view,
-		LastSeenVote: int(sn.LastSeenVote),
+		LastSeenVote: int(atomic.LoadInt64(&sn.LastSeenVote)),
 		Gcm: &GroupChangedMessage{
 			V:        v,
 			HostList: sn.HostListOn(view)}}
@@ -129,17 +159,19 @@ func (sn *Node) RemoveSelf() error {
 func (sn *Node) CatchUp(vi int, from string) {
 	log.Println(sn.Name(), "attempting to catch up vote", vi)
 
+	// far behind: start from the state of our peer
+	behind := int(atomic.LoadInt64(&sn.LastSeenVote)) - vi
 	ctx := context.TODO()
 	sn.PutTo(ctx, from,
 		&SigningMessage{
 			From:  sn.Name(),
 			Type:  CatchUpReq,
-			Cureq: &CatchUpRequest{Index: vi}})
+			Cureq: &CatchUpRequest{Index: vi, Snapshot: behind > MaxCatchUpBatch}})
 }
 
 func (sn *Node) StartGossip() {
 	go func() {
-		t := time.Tick(GOSSIP_TIME)
+		t := time.Tick(sn.config.GossipTime)
 		for {
 			select {
 			case <-t:
@@ -155,6 +187,7 @@ func (sn *Node) StartGossip() {
 				sn.randmu.Unlock()
 				log.Errorln("Gossiping with: ", from)
 				sn.CatchUp(int(atomic.LoadInt64(&sn.LastAppliedVote)+1), from)
+				sn.pingPeers()
 			case <-sn.closed:
 				log.Warnln("stopping gossip: closed")
 				return
@@ -1,12 +1,7 @@
 package sign
 
 import (
-	"reflect"
-	"sync"
-	"time"
-
 	"github.com/dedis/crypto/abstract"
-	"github.com/dedis/crypto/nist"
 	"github.com/dedis/protobuf"
 )
 
@@ -35,9 +30,12 @@ type Vote struct {
 	Av   *AddVote
 	Rv   *RemoveVote
 	Vcv  *ViewChangeVote
+	Sv   *ShutdownVote
+	App  *AppVote // application defined votes, Type >= FirstAppVT
 
 	Count     *Count
 	Confirmed bool
+	Proposed  VoteType // type of a NoOpVT vote before it was rejected
 }
 
 type ViewChangeVote struct {
@@ -45,6 +43,17 @@ type ViewChangeVote struct {
 	Parent string // our parent currently
 	Root   string // the root for the new view
 	// TODO: potentially have signature of new root on proposing this view
+
+	// record of the last round signed on the previous view,
+	// the root is selected from its hash, see snroot.go
+	SeedRecord *RoundRecord
+	// roots skipped as failed: those the group agreed on, and the root
+	// of the previous view if the change was caused by its failure
+	FailedRoots []FailedRoot
+
+	// tree of the new view built from latencies, nil to keep the links
+	// of the previous view
+	Topology *Topology
 }
 
 type AddVote struct {
@@ -60,7 +69,8 @@ type RemoveVote struct {
 }
 
 type VoteResponse struct {
-	Name     string // name of the responder
+	Name     string         // name of the responder
+	PubKey   abstract.Point // key the response is signed with
 	Accepted bool
 	// signature proves ownership of vote and
 	// shows that it was emitted during a specifc Round
@@ -80,78 +90,34 @@ type Count struct {
 	Responses []*VoteResponse // vote responses from descendants
 	For       int             // number of votes for
 	Against   int             // number of votes against
+
+	HostList []string // members of the view, set by the root
 }
 
 type CatchUpRequest struct {
-	Index int // index of requested vote
+	Index    int  // index of first requested vote
+	Snapshot bool // whether to send a snapshot first
 }
 
 type CatchUpResponse struct {
-	Vote *Vote
-}
-
-func (v *Vote) MarshalBinary() ([]byte, error) {
-	return protobuf.Encode(v)
-}
-
-func (v *Vote) UnmarshalBinary(data []byte) error {
-	var cons = make(protobuf.Constructors)
-	var point abstract.Point
-	var secret abstract.Secret
-	var suite = nist.NewAES128SHA256P256()
-	cons[reflect.TypeOf(&point).Elem()] = func() interface{} { return suite.Point() }
-	cons[reflect.TypeOf(&secret).Elem()] = func() interface{} { return suite.Secret() }
-	return protobuf.DecodeWithConstructors(data, v, cons)
-}
-
-type VoteLog struct {
-	Entries []*Vote
-	Last    int // last set entry
-
-	mu sync.Mutex
+	Snapshot *Snapshot // state of the peer, when requested
+	Votes    []*Vote   // consecutive votes, after the snapshot if any
 }
 
-func (vl *VoteLog) Put(index int, v *Vote) {
-	vl.mu.Lock()
-	defer vl.mu.Unlock()
+// Votes have no MarshalBinary/UnmarshalBinary of their own: inside a
+// SigningMessage they are decoded along with it, with the suite of the
+// receiving node.
 
-	for index >= len(vl.Entries) {
-		buf := make([]*Vote, len(vl.Entries)+1)
-		vl.Entries = append(vl.Entries, buf...)
-	}
-	vl.Entries[index] = v
-
-	vl.Last = max(vl.Last, index)
+// Encode returns the bytes of a vote, as signed by voters
+func (v *Vote) Encode() ([]byte, error) {
+	return protobuf.Encode(v)
 }
 
-func (vl *VoteLog) Get(index int) *Vote {
-	if index >= len(vl.Entries) {
-		return nil
+// Decode a vote produced by Encode, using suite for its points and secrets
+func DecodeVote(suite abstract.Suite, data []byte) (*Vote, error) {
+	v := &Vote{}
+	if err := protobuf.DecodeWithConstructors(data, v, suiteConstructors(suite)); err != nil {
+		return nil, err
 	}
-
-	return vl.Entries[index]
-}
-
-func NewVoteLog() *VoteLog {
-	return &VoteLog{Last: -1}
-}
-
-func (vl *VoteLog) Stream() chan *Vote {
-	ch := make(chan *Vote, 0)
-	go func() {
-
-		i := 1
-		for {
-			vl.mu.Lock()
-			v := vl.Get(i)
-			vl.mu.Unlock()
-			if v != nil {
-				ch <- v
-				i++
-			} else {
-				time.Sleep(500 * time.Millisecond)
-			}
-		}
-	}()
-	return ch
+	return v, nil
 }
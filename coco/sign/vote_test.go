@@ -1,6 +1,7 @@
 package sign_test
 
 import (
+	"errors"
 	"testing"
 	"time"
 
@@ -36,6 +37,86 @@ func TestTreeSmallConfigVote(t *testing.T) {
 
 }
 
+// An application defined vote is validated and applied on every node
+func TestTreeSmallConfigAppVote(t *testing.T) {
+	hc, err := oldconfig.LoadConfig("../test/data/exconf.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const KeyRotationVT = sign.FirstAppVT
+	applied := make(chan string, len(hc.SNodes))
+	for _, sn := range hc.SNodes {
+		err = sn.RegisterVoteType(KeyRotationVT, &sign.VoteHandler{
+			Name:   "key rotation",
+			Encode: func(data interface{}) ([]byte, error) { return []byte(data.(string)), nil },
+			Decode: func(b []byte) (interface{}, error) { return string(b), nil },
+			Validate: func(view int, data interface{}) error {
+				if data.(string) == "" {
+					return errors.New("empty key")
+				}
+				return nil
+			},
+			Apply: func(view int, data interface{}) { applied <- data.(string) }})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = hc.SNodes[0].RegisterVoteType(sign.AddVT, &sign.VoteHandler{}); err == nil {
+		t.Fatal("registered a reserved vote type")
+	}
+
+	err = hc.Run(false, sign.Voter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = hc.SNodes[0].ProposeVote(KeyRotationVT, "new key"); err != nil {
+		t.Fatal(err)
+	}
+	for range hc.SNodes {
+		select {
+		case key := <-applied:
+			if key != "new key" {
+				t.Fatal("applied wrong proposal:", key)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("vote was not applied on every node")
+		}
+	}
+}
+
+// A voted shutdown closes every node, leaves first, with a clean status
+func TestTreeSmallConfigShutdown(t *testing.T) {
+	hc, err := oldconfig.LoadConfig("../test/data/exconf.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = hc.Run(false, sign.Voter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a leaf asks for the shutdown, the root runs the vote
+	if err = hc.SNodes[5].Shutdown("end of test"); err != nil {
+		t.Fatal(err)
+	}
+	for _, sn := range hc.SNodes {
+		select {
+		case <-sn.Closed():
+		case <-time.After(20 * time.Second):
+			t.Fatal(sn.Name(), "did not close")
+		}
+		if sn.ExitStatus() != sign.ExitOK {
+			t.Error(sn.Name(), "closed with status", sn.ExitStatus())
+		}
+	}
+	if err = hc.SNodes[0].StartSigningRound(); err != sign.ErrShuttingDown {
+		t.Error("started a round after shutdown")
+	}
+}
+
 func TestTCPStaticConfigVote(t *testing.T) {
 	hc, err := oldconfig.LoadConfig("../test/data/extcpconf.json", oldconfig.ConfigOptions{ConnType: "tcp", GenHosts: true})
 	if err != nil {
@@ -64,3 +145,15 @@ func TestTCPStaticConfigVote(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestVoteRoundType(t *testing.T) {
+	if rt := sign.VoteRoundType(sign.AddVT); rt != sign.AddRT {
+		t.Fatal("add vote runs in round", rt)
+	}
+	if rt := sign.VoteRoundType(sign.FirstAppVT + 3); rt != sign.AppRT || rt.String() != "application" {
+		t.Fatal("application vote runs in round", rt)
+	}
+	if s := sign.SigningRT.String(); s != "signing" {
+		t.Fatal("signing round named", s)
+	}
+}
@@ -0,0 +1,302 @@
+package sign
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/dedis/crypto/abstract"
+	"github.com/dedis/protobuf"
+)
+
+// VoteLog holds the confirmed votes by index.
+// Votes up to First are replaced by the snapshot Snap of the state they led to.
+// A log opened with OpenVoteLog is kept on disk as a sequence of records:
+// the latest snapshot followed by the votes put after it.
+type VoteLog struct {
+	Entries []*Vote
+	Last    int // last set entry
+	First   int // last entry covered by Snap
+	Snap    *Snapshot
+
+	suite abstract.Suite
+	path  string
+	file  *os.File // nil for logs kept in memory only
+
+	mu sync.Mutex
+}
+
+// kinds of records in vote log files
+const (
+	voteRecord byte = iota + 1
+	snapshotRecord
+)
+
+// largest record read from or written to a vote log file
+const MaxVoteRecord = 1 << 24
+
+func NewVoteLog() *VoteLog {
+	return &VoteLog{Last: -1}
+}
+
+// Open the vote log of host name in dir
+func openNodeVoteLog(dir, name string, suite abstract.Suite) (*VoteLog, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return OpenVoteLog(filepath.Join(dir, name+".votelog"), suite)
+}
+
+// Open the vote log kept in the file at path, creating it if needed.
+// Points and secrets of the votes are decoded with suite.
+func OpenVoteLog(path string, suite abstract.Suite) (*VoteLog, error) {
+	vl := NewVoteLog()
+	vl.suite = suite
+	vl.path = path
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := vl.load(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	vl.file = f
+	return vl, nil
+}
+
+// Read all records of f, leaving it positioned after the last complete one
+func (vl *VoteLog) load(f *os.File) error {
+	r := bufio.NewReader(f)
+	var offset int64
+	for {
+		kind, data, err := readRecord(r)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// a record cut by a crash is dropped
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch kind {
+		case voteRecord:
+			v, err := DecodeVote(vl.suite, data)
+			if err != nil {
+				return err
+			}
+			vl.put(v.Index, v)
+		case snapshotRecord:
+			s, err := DecodeSnapshot(vl.suite, data)
+			if err != nil {
+				return err
+			}
+			vl.install(s)
+		default:
+			return errors.New("corrupted vote log: unknown record")
+		}
+		offset += int64(5 + len(data))
+	}
+
+	if err := f.Truncate(offset); err != nil {
+		return err
+	}
+	_, err := f.Seek(offset, 0)
+	return err
+}
+
+func readRecord(r io.Reader) (byte, []byte, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	n := binary.BigEndian.Uint32(hdr[1:])
+	if n > MaxVoteRecord {
+		return 0, nil, errors.New("corrupted vote log: record too large")
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, nil, err
+	}
+	return hdr[0], data, nil
+}
+
+func writeRecord(w io.Writer, kind byte, data []byte) error {
+	if len(data) > MaxVoteRecord {
+		return errors.New("vote log record too large")
+	}
+	var hdr [5]byte
+	hdr[0] = kind
+	binary.BigEndian.PutUint32(hdr[1:], uint32(len(data)))
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func (vl *VoteLog) Put(index int, v *Vote) {
+	vl.mu.Lock()
+	defer vl.mu.Unlock()
+
+	if index <= vl.First {
+		return
+	}
+	vl.put(index, v)
+
+	if vl.file == nil {
+		return
+	}
+	b, err := v.Encode()
+	if err == nil {
+		err = writeRecord(vl.file, voteRecord, b)
+	}
+	if err == nil {
+		err = vl.file.Sync()
+	}
+	if err != nil {
+		log.Errorln("unable to persist vote", index, ":", err)
+	}
+}
+
+func (vl *VoteLog) put(index int, v *Vote) {
+	for index >= len(vl.Entries) {
+		buf := make([]*Vote, len(vl.Entries)+1)
+		vl.Entries = append(vl.Entries, buf...)
+	}
+	vl.Entries[index] = v
+
+	vl.Last = max(vl.Last, index)
+}
+
+func (vl *VoteLog) Get(index int) *Vote {
+	if index >= len(vl.Entries) {
+		return nil
+	}
+
+	return vl.Entries[index]
+}
+
+// Replace the votes up to s.LastVote by the snapshot s.
+// Log files are rewritten with the snapshot and the votes after it.
+func (vl *VoteLog) Install(s *Snapshot) error {
+	vl.mu.Lock()
+	defer vl.mu.Unlock()
+
+	if s.LastVote <= vl.First {
+		return errors.New("snapshot older than vote log")
+	}
+	vl.install(s)
+	if vl.file == nil {
+		return nil
+	}
+	return vl.compact()
+}
+
+func (vl *VoteLog) install(s *Snapshot) {
+	vl.Snap = s
+	vl.First = s.LastVote
+	for i := 0; i <= s.LastVote && i < len(vl.Entries); i++ {
+		vl.Entries[i] = nil
+	}
+	vl.Last = max(vl.Last, s.LastVote)
+}
+
+// Write the snapshot and the remaining votes to a new file and
+// move it in place of the current one
+func (vl *VoteLog) compact() error {
+	tmp := vl.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	err = func() error {
+		b, err := vl.Snap.Encode()
+		if err != nil {
+			return err
+		}
+		if err := writeRecord(w, snapshotRecord, b); err != nil {
+			return err
+		}
+		for i := vl.First + 1; i < len(vl.Entries); i++ {
+			if vl.Entries[i] == nil {
+				continue
+			}
+			b, err := vl.Entries[i].Encode()
+			if err != nil {
+				return err
+			}
+			if err := writeRecord(w, voteRecord, b); err != nil {
+				return err
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		return f.Sync()
+	}()
+	if err == nil {
+		err = os.Rename(tmp, vl.path)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	vl.file.Close()
+	vl.file = f
+	return nil
+}
+
+// Close the file of the vote log, if any
+func (vl *VoteLog) Close() error {
+	vl.mu.Lock()
+	defer vl.mu.Unlock()
+	if vl.file == nil {
+		return nil
+	}
+	err := vl.file.Close()
+	vl.file = nil
+	return err
+}
+
+// Stream the votes in order, starting after the snapshot if any
+func (vl *VoteLog) Stream() chan *Vote {
+	ch := make(chan *Vote, 0)
+	go func() {
+
+		i := 1
+		for {
+			vl.mu.Lock()
+			if i <= vl.First {
+				i = vl.First + 1
+			}
+			v := vl.Get(i)
+			vl.mu.Unlock()
+			if v != nil {
+				ch <- v
+				i++
+			} else {
+				time.Sleep(500 * time.Millisecond)
+			}
+		}
+	}()
+	return ch
+}
+
+// Decode a snapshot produced by Snapshot.Encode
+func DecodeSnapshot(suite abstract.Suite, data []byte) (*Snapshot, error) {
+	s := &Snapshot{}
+	if err := protobuf.DecodeWithConstructors(data, s, suiteConstructors(suite)); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
@@ -0,0 +1,88 @@
+package sign_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dedis/crypto/nist"
+	"github.com/dedis/prifi/coco/sign"
+)
+
+// Votes and snapshots survive closing and reopening the vote log
+func TestVoteLogPersistence(t *testing.T) {
+	suite := nist.NewAES128SHA256P256()
+	dir, err := ioutil.TempDir("", "votelog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "host0.votelog")
+
+	vl, err := sign.OpenVoteLog(path, suite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 5; i++ {
+		vl.Put(i, &sign.Vote{Index: i, Type: sign.NoOpVT})
+	}
+	vl.Close()
+
+	vl, err = sign.OpenVoteLog(path, suite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vl.Last != 5 || vl.Get(3) == nil || vl.Get(3).Index != 3 {
+		t.Fatal("votes not reloaded from disk")
+	}
+
+	s := &sign.Snapshot{LastVote: 3, View: 1, Root: "host1", HostList: []string{"host0", "host1"}}
+	if err = vl.Install(s); err != nil {
+		t.Fatal(err)
+	}
+	vl.Put(6, &sign.Vote{Index: 6, Type: sign.NoOpVT})
+	vl.Close()
+
+	// a record cut short by a crash is dropped
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{1, 0, 0, 0, 100, 42})
+	f.Close()
+
+	vl, err = sign.OpenVoteLog(path, suite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vl.Close()
+	if vl.Snap == nil || vl.First != 3 || vl.Snap.Root != "host1" {
+		t.Fatal("snapshot not reloaded from disk")
+	}
+	if vl.Get(2) != nil {
+		t.Fatal("votes covered by snapshot kept")
+	}
+	if vl.Get(4) == nil || vl.Get(6) == nil || vl.Last != 6 {
+		t.Fatal("votes after snapshot not reloaded")
+	}
+}
+
+// A record claiming more than MaxVoteRecord bytes is not allocated
+func TestVoteLogOversizedRecord(t *testing.T) {
+	suite := nist.NewAES128SHA256P256()
+	dir, err := ioutil.TempDir("", "votelog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "host0.votelog")
+
+	if err := ioutil.WriteFile(path, []byte{1, 0xff, 0xff, 0xff, 0xff, 42}, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if vl, err := sign.OpenVoteLog(path, suite); err == nil {
+		vl.Close()
+		t.Fatal("vote log with oversized record opened")
+	}
+}
@@ -0,0 +1,89 @@
+package stamp
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+
+	"github.com/dedis/crypto/abstract"
+	"github.com/dedis/prifi/coco/hashid"
+	"github.com/dedis/prifi/coco/sign"
+)
+
+// Randomness beacon
+//
+// Every signing round yields a public random value: the hash of its
+// collective commitment and response. The commitment sums a fresh random
+// commitment of every node that took part, so the value is unpredictable
+// before the round as long as one of them is honest; the root can still
+// bias it by aborting rounds, at the cost of the rounds it drops. Values
+// are bound to the number of their round, which the collective signature
+// covers, see sign.RoundRecord, and proven by the record, checked
+// against the roster of the group: a record must be signed by at least
+// MinSigners of its hosts, a majority by default, so that no single host
+// can sign a beacon value of its choosing.
+
+var ErrBadBeacon error = errors.New("beacon value does not match its round")
+
+var beaconTag = []byte("beacon")
+
+// Random value of a round with the record proving it
+type Beacon struct {
+	Round  int           // number of the round
+	Value  hashid.HashId // random value of the round
+	Record *sign.RoundRecord
+}
+
+// Random value of the round of rr
+func BeaconValue(suite abstract.Suite, rr *sign.RoundRecord) hashid.HashId {
+	h := suite.Hash()
+	h.Write(beaconTag)
+	binary.Write(h, binary.BigEndian, int64(rr.Round))
+	v, _ := rr.V_hat.MarshalBinary()
+	h.Write(v)
+	r, _ := rr.R_hat.MarshalBinary()
+	h.Write(r)
+	return h.Sum(nil)
+}
+
+// Beacon of the round of rr
+func RecordBeacon(suite abstract.Suite, rr *sign.RoundRecord) (*Beacon, error) {
+	if rr.V_hat == nil || rr.R_hat == nil {
+		return nil, ErrBadBeacon
+	}
+	return &Beacon{Round: rr.Round, Value: BeaconValue(suite, rr), Record: rr}, nil
+}
+
+// Check that the beacon was signed by the hosts of the group of r in
+// its round
+func (b *Beacon) Verify(suite abstract.Suite, r *Roster) error {
+	if b.Record == nil {
+		return ErrBadBeacon
+	}
+	if err := r.Verify(suite, b.Record); err != nil {
+		return err
+	}
+	if b.Record.Round != b.Round ||
+		subtle.ConstantTimeCompare(BeaconValue(suite, b.Record), b.Value) != 1 {
+		return ErrBadBeacon
+	}
+	return nil
+}
+
+// Beacon of round Round, the newest if 0
+func (c *Client) Beacon(suite abstract.Suite, Round int, TSServerName string) (*Beacon, error) {
+	tsm, err := c.request(TSServerName, &TimeStampMessage{
+		Type: BeaconRequestType,
+		Breq: &BeaconRequest{Round: Round}})
+	if err != nil {
+		return nil, err
+	}
+	rr, err := sign.UnmarshalRoundRecord(suite, tsm.Brep.Rec)
+	if err != nil {
+		return nil, err
+	}
+	if Round != 0 && rr.Round != Round {
+		return nil, ErrBadBeacon
+	}
+	return RecordBeacon(suite, rr)
+}
@@ -0,0 +1,65 @@
+package stamp_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dedis/prifi/coco/sign"
+	"github.com/dedis/prifi/coco/stamp"
+	"github.com/dedis/prifi/coco/test/oldconfig"
+)
+
+// Beacon values served for rounds verify against the roster of the group
+// and differ from round to round
+func TestBeacon(t *testing.T) {
+	g := startGroup(t, "test", "../test/data/exconf.json", oldconfig.ConfigOptions{Config: testConfig()}, 5, nil)
+	defer g.Close()
+	suite, roster := g.hc.SNodes[0].Suite(), g.roster
+	c, server := g.clients[0], g.stampers[1].Name()
+
+	newest, err := c.Beacon(suite, 0, server)
+	if err != nil {
+		t.Fatal("no beacon:", err)
+	}
+	if err := newest.Verify(suite, roster); err != nil {
+		t.Fatal("beacon not signed by the group:", err)
+	}
+	old, err := c.Beacon(suite, newest.Round-1, server)
+	if err != nil {
+		t.Fatal("no beacon for round", newest.Round-1, ":", err)
+	}
+	if old.Round != newest.Round-1 {
+		t.Fatal("asked for round", newest.Round-1, "got", old.Round)
+	}
+	if err := old.Verify(suite, roster); err != nil {
+		t.Fatal("beacon not signed by the group:", err)
+	}
+	if bytes.Equal(old.Value, newest.Value) {
+		t.Fatal("same value for two rounds")
+	}
+
+	forged := *old
+	forged.Round = newest.Round
+	if err := forged.Verify(suite, roster); err == nil {
+		t.Fatal("beacon accepted at another round")
+	}
+	forged = *old
+	forged.Value = newest.Value
+	if err := forged.Verify(suite, roster); err == nil {
+		t.Fatal("beacon accepted with another value")
+	}
+	// the round number is signed with the record
+	rr := *old.Record
+	rr.Round = newest.Round
+	forged = stamp.Beacon{Round: rr.Round, Value: stamp.BeaconValue(suite, &rr), Record: &rr}
+	if err := forged.Verify(suite, roster); err == nil {
+		t.Fatal("beacon accepted from a renumbered record")
+	}
+	// a single host cannot sign a beacon on its own
+	rr = *old.Record
+	rr.ExceptionList, rr.X_hat = roster.Keys[1:], roster.Keys[0]
+	forged = stamp.Beacon{Round: rr.Round, Value: stamp.BeaconValue(suite, &rr), Record: &rr}
+	if err := forged.Verify(suite, roster); err != sign.ErrTooFewSigners {
+		t.Fatal("beacon accepted from a record signed by a single host:", err)
+	}
+}
@@ -9,7 +9,9 @@ import (
 
 	log "github.com/Sirupsen/logrus"
 
+	"github.com/dedis/crypto/abstract"
 	"github.com/dedis/prifi/coco/coconet"
+	"github.com/dedis/prifi/coco/hashid"
 	"github.com/dedis/prifi/coco/sign"
 )
 
@@ -32,6 +34,9 @@ type Client struct {
 	curRoundSig []byte // merkle tree root of last round
 	// roundChan   chan int // round numberd are sent in as rounds change
 	Error error
+
+	RoundTime time.Duration // round time of the servers, used to time out requests
+	Debug     bool          // log connection errors and timeouts
 }
 
 func NewClient(name string) (c *Client) {
@@ -39,6 +44,7 @@ func NewClient(name string) (c *Client) {
 	c.Servers = make(map[string]coconet.Conn)
 	c.history = make(map[SeqNo]TimeStampMessage)
 	c.doneChan = make(map[SeqNo]chan error)
+	c.RoundTime = sign.DefaultRoundTime
 	// c.roundChan = make(chan int)
 	return
 }
@@ -61,7 +67,7 @@ func (c *Client) handleServer(s coconet.Conn) error {
 			if err == coconet.ErrNotEstablished {
 				continue
 			}
-			if sign.DEBUG {
+			if c.Debug {
 				log.Warn("error getting from connection:", err)
 			}
 			return err
@@ -80,7 +86,9 @@ func (c *Client) handleResponse(tsm *TimeStampMessage) {
 		// reply sequence number that the reply was received
 		// we know that there is no error at this point
 		c.ProcessStampReply(tsm)
-
+	case RecordReplyType, AttestReplyType, HeadReplyType, ConsistencyReplyType,
+		InclusionReplyType, BeaconReplyType, Error:
+		c.processReply(tsm)
 	}
 }
 
@@ -102,19 +110,19 @@ func (c *Client) AddServer(name string, conn coconet.Conn) {
 				c.Mux.Lock()
 				c.Servers[name] = conn
 				c.Mux.Unlock()
-				if sign.DEBUG {
+				if c.Debug {
 					log.Println("SUCCESS: connected to server:", conn)
 				}
 				err := c.handleServer(conn)
 				// if a server encounters any terminating error
 				// terminate all pending client transactions and kill the client
 				if err != nil {
-					if sign.DEBUG {
+					if c.Debug {
 						log.Errorln("EOF DETECTED: sending EOF to all pending TimeStamps")
 					}
 					c.Mux.Lock()
 					for _, ch := range c.doneChan {
-						if sign.DEBUG {
+						if c.Debug {
 							log.Println("Sending to Receiving Channel")
 						}
 						ch <- io.EOF
@@ -147,61 +155,111 @@ var ErrClientToTSTimeout error = errors.New("client timeouted on waiting for res
 // When client asks for val to be timestamped
 // It blocks until it get a stamp reply back
 func (c *Client) TimeStamp(val []byte, TSServerName string) error {
+	_, err := c.Stamp(val, TSServerName)
+	if err == ErrClientToTSTimeout {
+		// only logged, servers may be changing views
+		return nil
+	}
+	return err
+}
+
+// Timestamp val, returning the Merkle root of the round and the path to it
+func (c *Client) Stamp(val []byte, TSServerName string) (*StampReply, error) {
+	tsm, err := c.request(TSServerName, &TimeStampMessage{
+		Type: StampRequestType,
+		Sreq: &StampRequest{Val: val}})
+	if err != nil {
+		return nil, err
+	}
+	return tsm.Srep, nil
+}
+
+// Record of the signed round with Merkle root root
+func (c *Client) Record(suite abstract.Suite, root hashid.HashId, TSServerName string) (*sign.RoundRecord, error) {
+	tsm, err := c.request(TSServerName, &TimeStampMessage{
+		Type: RecordRequestType,
+		Rreq: &RecordRequest{Root: root}})
+	if err != nil {
+		return nil, err
+	}
+	if tsm.Rrep == nil || len(tsm.Rrep.Rec) == 0 {
+		return nil, ErrNoRecord
+	}
+	return sign.UnmarshalRoundRecord(suite, tsm.Rrep.Rec)
+}
+
+// Attestations by peer groups of the round with Merkle root root
+func (c *Client) Attestations(suite abstract.Suite, root hashid.HashId, TSServerName string) (FederatedProof, error) {
+	tsm, err := c.request(TSServerName, &TimeStampMessage{
+		Type: AttestRequestType,
+		Areq: &AttestRequest{Root: root}})
+	if err != nil {
+		return nil, err
+	}
+	if tsm.Arep == nil || len(tsm.Arep.Hops) == 0 {
+		return nil, ErrNotAttested
+	}
+	fp, err := UnmarshalFederatedProof(suite, tsm.Arep.Hops)
+	if err == nil && len(fp) == 0 {
+		err = ErrNotAttested
+	}
+	return fp, err
+}
+
+// Send a request to the server and block until its reply
+func (c *Client) request(TSServerName string, tsm *TimeStampMessage) (*TimeStampMessage, error) {
 	c.Mux.Lock()
 	if c.Error != nil {
 		c.Mux.Unlock()
-		return c.Error
+		return nil, c.Error
 	}
 	c.reqno++
 	myReqno := c.reqno
-	c.doneChan[c.reqno] = make(chan error, 1) // new done channel for new req
+	myChan := make(chan error, 1) // new done channel for new req
+	c.doneChan[myReqno] = myChan
 	c.Mux.Unlock()
-	// send request to TSServer
-	// log.Println("SENDING TIME STAMP REQUEST TO: ", TSServerName)
-	err := c.PutToServer(TSServerName,
-		&TimeStampMessage{
-			Type:  StampRequestType,
-			ReqNo: myReqno,
-			Sreq:  &StampRequest{Val: val}})
+	defer func() {
+		// delete channel as it is of no longer meaningful
+		c.Mux.Lock()
+		delete(c.doneChan, myReqno)
+		c.Mux.Unlock()
+	}()
+
+	tsm.ReqNo = myReqno
+	err := c.PutToServer(TSServerName, tsm)
 	if err != nil {
 		if err != coconet.ErrNotEstablished {
-			if sign.DEBUG {
-				log.Warn("error timestamping: ", err)
+			if c.Debug {
+				log.Warn("error sending request: ", err)
 			}
 		}
 		// pass back up all errors from putting to server
-		return err
+		return nil, err
 	}
 
-	// get channel associated with request
-	c.Mux.Lock()
-	myChan := c.doneChan[myReqno]
-	c.Mux.Unlock()
-
-	// wait until ProcessStampReply signals that reply was received
+	// wait until the reply is processed
 	select {
 	case err = <-myChan:
-		// log.Println("-------------client received  response from" + TSServerName)
-		break
-	case <-time.After(10 * ROUND_TIME):
-		if sign.DEBUG == true {
+	case <-time.After(10 * c.RoundTime):
+		if c.Debug == true {
 			log.Errorln(errors.New("client timeouted on waiting for response from" + TSServerName))
 		}
-		break
-		// err = ErrClientToTSTimeout
+		return nil, ErrClientToTSTimeout
 	}
 	if err != nil {
-		if sign.DEBUG {
+		if c.Debug {
 			log.Errorln("error received from DoneChan:", err)
 		}
-		return err
+		return nil, err
 	}
 
-	// delete channel as it is of no longer meaningful
 	c.Mux.Lock()
-	delete(c.doneChan, myReqno)
+	reply := c.history[myReqno]
 	c.Mux.Unlock()
-	return err
+	if reply.Type == Error {
+		return nil, errors.New(reply.Erep.Msg)
+	}
+	return &reply, nil
 }
 
 func (c *Client) ProcessStampReply(tsm *TimeStampMessage) {
@@ -221,5 +279,18 @@ func (c *Client) ProcessStampReply(tsm *TimeStampMessage) {
 	} else {
 		c.Mux.Unlock()
 	}
-	done <- nil
+	if done != nil {
+		done <- nil
+	}
+}
+
+// Keep a reply other than a stamp reply and wake up its request
+func (c *Client) processReply(tsm *TimeStampMessage) {
+	c.Mux.Lock()
+	c.history[tsm.ReqNo] = *tsm
+	done := c.doneChan[tsm.ReqNo]
+	c.Mux.Unlock()
+	if done != nil {
+		done <- nil
+	}
 }
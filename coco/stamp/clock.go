@@ -0,0 +1,375 @@
+package stamp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/dedis/crypto/abstract"
+	"github.com/dedis/prifi/coco/sign"
+)
+
+// Signed round time
+//
+// Every server reads its clock when it commits to a round, signs the
+// reading with the number of the round and its name, and adds it to the
+// aggregate of the round next to its head, see history.go: the group
+// keeps the reading of the root along with the earliest and latest ones.
+// The record of a round thus proves, under the collective signature, the
+// time the root signed it and the spread of the clocks of the group at
+// that time, each reading under the signature of its node, and clients
+// get the interval their stamp was signed in and the LogEntry of the
+// round with its time. Signers refuse rounds whose root reading is not
+// signed by the root, or further than Config.MaxDrift from their own
+// clock, and the root flags the nodes whose clock is further than that
+// from its own. Readings are checked against the keys the hosts are
+// known under. Only the earliest and the latest readings reach the root,
+// so that the aggregate does not grow with the group: a node past the
+// bound is flagged in the rounds its clock is the furthest off, the
+// worst offenders first, and the others once they are fixed or removed.
+
+var ErrNoTime error = errors.New("no signed time for this round")
+var ErrNotStamped error = errors.New("reply is not a receipt for the value")
+var ErrBadReading error = errors.New("clock reading not signed by its node")
+var ErrClockDrift error = errors.New("time of the root too far from our clock")
+
+var clockTag = []byte("clock")
+
+// Clock reading of a node for a round, Unix time in nanoseconds
+type Reading struct {
+	Time int64
+	Node string // name of the node
+	Key  []byte // encoded public key of the node
+	Sig  []byte // signature of the node on the reading, see readingMessage
+}
+
+// Message a node signs its reading of round Round with
+func readingMessage(Round int, t int64, node string) []byte {
+	var b bytes.Buffer
+	b.Write(clockTag)
+	binary.Write(&b, binary.BigEndian, []int64{int64(Round), t})
+	b.WriteString(node)
+	return b.Bytes()
+}
+
+// Check that the reading of round Round was signed by its node, one of
+// keys if not nil
+func (r *Reading) Verify(suite abstract.Suite, Round int, keys []abstract.Point) error {
+	X := suite.Point()
+	if err := X.UnmarshalBinary(r.Key); err != nil {
+		return ErrBadReading
+	}
+	if keys != nil {
+		found := false
+		for _, k := range keys {
+			found = found || k.Equal(X)
+		}
+		if !found {
+			return ErrBadReading
+		}
+	}
+	n := len(r.Sig) / 2
+	sig := sign.BasicSig{C: suite.Secret(), R: suite.Secret()}
+	if sig.C.UnmarshalBinary(r.Sig[:n]) != nil || sig.R.UnmarshalBinary(r.Sig[n:]) != nil {
+		return ErrBadReading
+	}
+	if sign.ElGamalVerify(suite, readingMessage(Round, r.Time, r.Node), X, sig) != nil {
+		return ErrBadReading
+	}
+	return nil
+}
+
+func (r *Reading) equal(o *Reading) bool {
+	return r.Time == o.Time && r.Node == o.Node &&
+		bytes.Equal(r.Key, o.Key) && bytes.Equal(r.Sig, o.Sig)
+}
+
+// Clocks of the nodes of a round
+type Clock struct {
+	Root     Reading // reading of the root
+	Min, Max Reading // earliest and latest readings
+}
+
+// Interval the round was signed in, by the clocks of the group
+func (c *Clock) Interval() (earliest, latest time.Time) {
+	return time.Unix(0, c.Min.Time), time.Unix(0, c.Max.Time)
+}
+
+// Aggregate of a round: the head of the history of the root and the
+// clocks of the nodes
+type roundAggregate struct {
+	Head  Head
+	Clock Clock
+}
+
+func putBytes(b *bytes.Buffer, data []byte) {
+	binary.Write(b, binary.BigEndian, uint32(len(data)))
+	b.Write(data)
+}
+
+func getBytes(b *bytes.Buffer) ([]byte, error) {
+	var n uint32
+	if err := binary.Read(b, binary.BigEndian, &n); err != nil {
+		return nil, err
+	}
+	if int(n) > b.Len() {
+		return nil, ErrNoTime
+	}
+	return b.Next(int(n)), nil
+}
+
+func (r *Reading) put(b *bytes.Buffer) {
+	binary.Write(b, binary.BigEndian, r.Time)
+	putBytes(b, []byte(r.Node))
+	putBytes(b, r.Key)
+	putBytes(b, r.Sig)
+}
+
+func (r *Reading) get(b *bytes.Buffer) error {
+	if err := binary.Read(b, binary.BigEndian, &r.Time); err != nil {
+		return ErrNoTime
+	}
+	node, err := getBytes(b)
+	if err != nil {
+		return err
+	}
+	r.Node = string(node)
+	if r.Key, err = getBytes(b); err != nil {
+		return err
+	}
+	r.Sig, err = getBytes(b)
+	return err
+}
+
+// Encode the aggregate: the length of the head, the head, then the
+// readings of the root, the earliest and the latest clocks
+func (ra *roundAggregate) MarshalBinary() ([]byte, error) {
+	var b bytes.Buffer
+	h, err := ra.Head.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	putBytes(&b, h)
+	ra.Clock.Root.put(&b)
+	ra.Clock.Min.put(&b)
+	ra.Clock.Max.put(&b)
+	return b.Bytes(), nil
+}
+
+func (ra *roundAggregate) UnmarshalBinary(data []byte) error {
+	b := bytes.NewBuffer(data)
+	h, err := getBytes(b)
+	if err != nil {
+		return ErrNoHead
+	}
+	if err := ra.Head.UnmarshalBinary(h); err != nil {
+		return err
+	}
+	c := &ra.Clock
+	for _, r := range []*Reading{&c.Root, &c.Min, &c.Max} {
+		if err := r.get(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Our clock
+func (s *Server) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+// Aggregate of a node: the head of its history and its signed clock
+// reading
+func (s *Server) roundAggregate(view, Round int) []byte {
+	r := Reading{Time: s.now().UnixNano(), Node: s.Name()}
+	r.Key, _ = s.PublicKey().MarshalBinary()
+	sig := s.SignMessage(readingMessage(Round, r.Time, r.Node))
+	c, _ := sig.C.MarshalBinary()
+	rs, _ := sig.R.MarshalBinary()
+	r.Sig = append(c, rs...)
+	ra := &roundAggregate{Head: s.head(), Clock: Clock{Root: r, Min: r, Max: r}}
+	b, _ := ra.MarshalBinary()
+	return b
+}
+
+// The group keeps the head and reading of the first node, the root, and
+// the earliest and latest readings
+func combineRounds(a, b []byte) []byte {
+	if a == nil {
+		return b
+	}
+	ra, rb := &roundAggregate{}, &roundAggregate{}
+	if ra.UnmarshalBinary(a) != nil || rb.UnmarshalBinary(b) != nil {
+		return a
+	}
+	if rb.Clock.Min.Time < ra.Clock.Min.Time {
+		ra.Clock.Min = rb.Clock.Min
+	}
+	if rb.Clock.Max.Time > ra.Clock.Max.Time {
+		ra.Clock.Max = rb.Clock.Max
+	}
+	c, _ := ra.MarshalBinary()
+	return c
+}
+
+// Check a reading of round Round against the key we know its node under
+func (s *Server) verifyReading(r *Reading, Round int) error {
+	k := s.KeyOf(r.Node)
+	if k == nil {
+		return ErrBadReading
+	}
+	return r.Verify(s.Suite(), Round, []abstract.Point{k})
+}
+
+// Check the aggregate of the root before signing a round: its head must
+// be one of our history and its clock, signed by the root, within the
+// bound of ours
+func (s *Server) checkRound(view, Round int, aggregate []byte) error {
+	ra := &roundAggregate{}
+	if err := ra.UnmarshalBinary(aggregate); err != nil {
+		return err
+	}
+	if ra.Clock.Root.Node != s.RootFor(view) {
+		return ErrBadReading
+	}
+	if err := s.verifyReading(&ra.Clock.Root, Round); err != nil {
+		return err
+	}
+	if max := s.Config().MaxDrift; max != 0 {
+		off := time.Duration(s.now().UnixNano() - ra.Clock.Root.Time)
+		if off > max || off < -max {
+			log.Warnln(s.Name(), "refusing round of", ra.Clock.Root.Node, "at", off, "from our clock")
+			return ErrClockDrift
+		}
+	}
+	return s.checkHead(&ra.Head)
+}
+
+// Nodes whose clocks drifted, with the number of rounds they were
+// flagged in
+type drift struct {
+	mu      sync.Mutex
+	flagged map[string]int
+}
+
+// Flag the nodes of a round signed by the root whose clocks are too far
+// from the one of the root: the earliest and the latest one only
+func (s *Server) checkDrift(view int, sa *sign.SignedAggregate) {
+	max := s.Config().MaxDrift
+	ra := &roundAggregate{}
+	if max == 0 || ra.UnmarshalBinary(sa.Aggregate) != nil {
+		return
+	}
+	c := &ra.Clock
+	s.drift.mu.Lock()
+	defer s.drift.mu.Unlock()
+	if s.drift.flagged == nil {
+		s.drift.flagged = make(map[string]int)
+	}
+	// only readings signed by their node count against it
+	if off := time.Duration(c.Root.Time - c.Min.Time); off > max &&
+		s.verifyReading(&c.Min, sa.Round) == nil {
+		log.Warnln(s.Name(), "clock of", c.Min.Node, "is", off, "behind the root")
+		s.drift.flagged[c.Min.Node]++
+	}
+	if off := time.Duration(c.Max.Time - c.Root.Time); off > max &&
+		s.verifyReading(&c.Max, sa.Round) == nil {
+		log.Warnln(s.Name(), "clock of", c.Max.Node, "is", off, "ahead of the root")
+		s.drift.flagged[c.Max.Node]++
+	}
+}
+
+// Nodes flagged for drifting clocks, with the number of rounds they
+// were flagged in. Only the roots of rounds flag nodes.
+func (s *Server) Drifted() map[string]int {
+	s.drift.mu.Lock()
+	defer s.drift.mu.Unlock()
+	d := make(map[string]int, len(s.drift.flagged))
+	for name, n := range s.drift.flagged {
+		d[name] = n
+	}
+	return d
+}
+
+// Clocks of a round with the record signing them
+type SignedTime struct {
+	Clock
+	Record *sign.RoundRecord
+}
+
+// Clocks carried by the aggregate of a record
+func RecordTime(rr *sign.RoundRecord) (*SignedTime, error) {
+	ra := &roundAggregate{}
+	if err := ra.UnmarshalBinary(rr.Aggregate); err != nil {
+		return nil, ErrNoTime
+	}
+	return &SignedTime{Clock: ra.Clock, Record: rr}, nil
+}
+
+// Check that the clocks were signed by the hosts of the group of r, and
+// each reading by its node, one of the roster if it lists their keys
+func (st *SignedTime) Verify(suite abstract.Suite, r *Roster) error {
+	if st.Record == nil {
+		return ErrNoTime
+	}
+	rt, err := RecordTime(st.Record)
+	if err != nil || !rt.Root.equal(&st.Root) || !rt.Min.equal(&st.Min) || !rt.Max.equal(&st.Max) {
+		return ErrNoTime
+	}
+	if err := r.Verify(suite, st.Record); err != nil {
+		return err
+	}
+	for _, rd := range []*Reading{&st.Root, &st.Min, &st.Max} {
+		if err := rd.Verify(suite, st.Record.Round, r.Keys); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Log entry of the round, with its Merkle root and the time of its
+// root. Its sequence number is the number of the round, wrapped to a
+// SeqNo.
+func (st *SignedTime) Entry() *LogEntry {
+	t := st.Root.Time
+	return &LogEntry{Seq: SeqNo(st.Record.Round), Root: st.Record.Message, Time: &t}
+}
+
+// Signed time of the round val was stamped in with reply, checked
+// against the roster r of the group of the server
+func (c *Client) StampTime(suite abstract.Suite, r *Roster, val []byte, reply *StampReply, TSServerName string) (*SignedTime, error) {
+	if !reply.Verify(suite.Hash, val) {
+		return nil, ErrNotStamped
+	}
+	// servers other than the root get the record with the next round
+	var rr *sign.RoundRecord
+	var err error
+	for try := 0; try < 3; try++ {
+		if rr, err = c.Record(suite, reply.Sig, TSServerName); err != ErrNoRecord {
+			break
+		}
+		time.Sleep(c.RoundTime)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(rr.Message, reply.Sig) {
+		return nil, ErrNotStamped
+	}
+	st, err := RecordTime(rr)
+	if err != nil {
+		return nil, err
+	}
+	if err := st.Verify(suite, r); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
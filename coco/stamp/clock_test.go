@@ -0,0 +1,77 @@
+package stamp_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/prifi/coco/stamp"
+	"github.com/dedis/prifi/coco/test/oldconfig"
+)
+
+// A stamp comes with the signed interval of its round, each reading
+// signed by its node; a node whose clock drifts past the bound refuses
+// the rounds and the root flags it
+func TestStampTime(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxDrift = time.Minute
+	ahead := func() time.Time { return time.Now().Add(time.Hour) }
+	g := startGroup(t, "test", "../test/data/exconf.json", oldconfig.ConfigOptions{Config: cfg}, 1,
+		func(stampers []*stamp.Server) { stampers[5].Now = ahead })
+	defer g.Close()
+	suite, roster := g.hc.SNodes[0].Suite(), g.roster
+	c, server := g.clients[0], g.stampers[1].Name()
+	drifter := g.stampers[5]
+
+	val := []byte("value stamped at a signed time..")
+	before := time.Now()
+	reply, err := c.Stamp(val, server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := time.Now()
+	st, err := c.StampTime(suite, roster, val, reply, server)
+	if err != nil {
+		t.Fatal("no signed time:", err)
+	}
+	earliest, latest := st.Interval()
+	if earliest.Before(before) || earliest.After(after) {
+		t.Fatal("earliest clock", earliest, "for a stamp asked in", before, after)
+	}
+	if root := time.Unix(0, st.Root.Time); root.Before(earliest) || root.After(after) {
+		t.Fatal("time of the root", root, "out of", earliest, after)
+	}
+	if st.Max.Node != drifter.Name() || latest.Before(after.Add(time.Minute)) {
+		t.Fatal("latest clock", latest, "of", st.Max.Node, "instead of the drifting node")
+	}
+	if e := st.Entry(); e.Time == nil || *e.Time != st.Root.Time {
+		t.Fatal("log entry of the round without the time of the root")
+	}
+
+	// the drifting node refused to sign the round
+	refused := false
+	for _, k := range st.Record.ExceptionList {
+		refused = refused || k.Equal(drifter.PublicKey())
+	}
+	if !refused {
+		t.Fatal("drifting node not excepted from the round")
+	}
+
+	forged := *st
+	forged.Max.Time -= int64(time.Hour)
+	if err := forged.Verify(suite, roster); err == nil {
+		t.Fatal("forged time accepted")
+	}
+	if err := forged.Max.Verify(suite, st.Record.Round, roster.Keys); err != stamp.ErrBadReading {
+		t.Fatal("reading accepted with another time")
+	}
+	if err := st.Max.Verify(suite, st.Record.Round+1, roster.Keys); err != stamp.ErrBadReading {
+		t.Fatal("reading accepted for another round")
+	}
+	if _, err := c.StampTime(suite, roster, []byte("another value"), reply, server); err != stamp.ErrNotStamped {
+		t.Fatal("signed time for a value not stamped")
+	}
+
+	if g.stampers[0].Drifted()[drifter.Name()] == 0 {
+		t.Fatal("drifting node not flagged for its clock")
+	}
+}
@@ -1,10 +0,0 @@
-package stamp
-
-import (
-	"time"
-
-	"github.com/dedis/prifi/coco/sign"
-)
-
-// time we wait between rounds
-var ROUND_TIME time.Duration = sign.ROUND_TIME
@@ -0,0 +1,416 @@
+package stamp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/dedis/crypto/abstract"
+	"github.com/dedis/prifi/coco/coconet"
+	"github.com/dedis/prifi/coco/hashid"
+	"github.com/dedis/prifi/coco/proof"
+	"github.com/dedis/prifi/coco/sign"
+)
+
+// Federated timestamping
+//
+// Independent groups attest each other's signed rounds: every Every
+// rounds the root of a group stamps the hash of the record of its round
+// at each peer group, as any client would, and keeps the record of the
+// peer round holding it. A federated proof is a chain of hops, each a
+// Merkle path from a leaf to the message of a round signed by one group,
+// the leaf of every hop being the hash of the record of the hop before.
+// It is checked against the rosters of the groups, which carry their
+// public keys, and shows the value was stamped before the round of every
+// group on the chain. Attestations are kept by the root that collected
+// them, for as many rounds as it keeps in memory. A record verifies
+// against a roster under the keys of its hosts but those of the
+// exception list it carries, as long as at least MinSigners of them,
+// a majority by default, signed.
+
+var ErrForeignSignature error = errors.New("record not signed by the hosts of its group")
+var ErrBadFederatedProof error = errors.New("federated proof does not chain")
+var ErrUnknownGroup error = errors.New("no roster for group")
+var ErrNotAttested error = errors.New("round not attested by peer groups")
+var ErrNoRecord error = errors.New("server holds no record of the round")
+
+// Public view of a group
+type Roster struct {
+	Name     string
+	Servers  []string         // stamp servers of the group, clients connect here
+	Keys     []abstract.Point // public keys of the hosts
+	GroupKey abstract.Point   // key of the group if it signs in Threshold mode
+
+	// hosts that must sign a record, 0 for a majority of Keys
+	MinSigners int
+}
+
+// Check that the round of rr was signed by the hosts of the group
+func (r *Roster) Verify(suite abstract.Suite, rr *sign.RoundRecord) error {
+	if r.GroupKey != nil {
+		return sign.VerifyThreshold(suite, r.GroupKey, rr)
+	}
+	if err := sign.VerifyRecord(suite, rr, r.Keys, r.MinSigners); err == sign.ErrTooFewSigners {
+		return err
+	} else if err != nil {
+		return ErrForeignSignature
+	}
+	return nil
+}
+
+// Step of a federated proof
+type Hop struct {
+	Group  string        // name of the group that signed Record
+	Leaf   hashid.HashId // stamped value, or hash of the record of the hop before
+	Nonce  []byte        // salt of Leaf in the tree, nil if not salted
+	Path   proof.Proof   // Merkle path from Leaf to the message of Record
+	Record *sign.RoundRecord
+}
+
+// Leaf of the hop in the Merkle tree of Record
+func (hop *Hop) leaf(suite abstract.Suite) hashid.HashId {
+	if len(hop.Nonce) == 0 {
+		return hop.Leaf
+	}
+	return proof.SaltedLeaf(suite.Hash, hop.Nonce, hop.Leaf)
+}
+
+type FederatedProof []*Hop
+
+// Hop as sent to clients, the record encoded
+type wireHop struct {
+	Group string
+	Leaf  hashid.HashId
+	Nonce []byte
+	Path  proof.Proof
+	Rec   []byte
+}
+
+func (fp FederatedProof) MarshalBinary() ([]byte, error) {
+	hops := make([]wireHop, len(fp))
+	for i, hop := range fp {
+		rec, err := hop.Record.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		hops[i] = wireHop{Group: hop.Group, Leaf: hop.Leaf, Nonce: hop.Nonce, Path: hop.Path, Rec: rec}
+	}
+	return gobEncode(hops)
+}
+
+// Decode a federated proof whose records belong to suite
+func UnmarshalFederatedProof(suite abstract.Suite, data []byte) (FederatedProof, error) {
+	var hops []wireHop
+	if err := gobDecode(data, &hops); err != nil {
+		return nil, err
+	}
+	fp := make(FederatedProof, len(hops))
+	for i, h := range hops {
+		rr, err := sign.UnmarshalRoundRecord(suite, h.Rec)
+		if err != nil {
+			return nil, err
+		}
+		fp[i] = &Hop{Group: h.Group, Leaf: h.Leaf, Nonce: h.Nonce, Path: h.Path, Record: rr}
+	}
+	return fp, nil
+}
+
+// Check that every hop of fp was signed by its group and chains to the
+// hop before, the first one starting from val
+func VerifyFederatedProof(suite abstract.Suite, rosters map[string]*Roster, val []byte, fp FederatedProof) error {
+	if len(fp) == 0 {
+		return ErrBadFederatedProof
+	}
+	leaf := hashid.HashId(val)
+	for _, hop := range fp {
+		if hop == nil || hop.Record == nil || !bytes.Equal(hop.Leaf, leaf) ||
+			!hop.Path.Check(suite.Hash, hop.Record.Message, hop.leaf(suite)) {
+			return ErrBadFederatedProof
+		}
+		r, ok := rosters[hop.Group]
+		if !ok {
+			return ErrUnknownGroup
+		}
+		if err := r.Verify(suite, hop.Record); err != nil {
+			return err
+		}
+		leaf = hop.Record.Hash(suite)
+	}
+	return nil
+}
+
+// Federated proof that val, stamped at the first group of route with
+// reply, was then signed by every group of route in turn, each group
+// attesting the round of the one before. The client must be connected
+// to the servers of the route; the roots hold the attestations.
+func (c *Client) Prove(suite abstract.Suite, val []byte, reply *StampReply, route []*Roster) (FederatedProof, error) {
+	if len(route) == 0 {
+		return nil, ErrUnknownGroup
+	}
+	var rr *sign.RoundRecord
+	err := c.askGroup(route[0], func(server string) (err error) {
+		rr, err = c.Record(suite, reply.Sig, server)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	fp := FederatedProof{&Hop{Group: route[0].Name, Leaf: val, Nonce: reply.Nonce, Path: reply.Prf, Record: rr}}
+
+	for i := 1; i < len(route); i++ {
+		var hop *Hop
+		err := c.askGroup(route[i-1], func(server string) error {
+			hops, err := c.Attestations(suite, rr.Message, server)
+			if err != nil {
+				return err
+			}
+			for _, h := range hops {
+				if h.Group == route[i].Name {
+					hop = h
+					return nil
+				}
+			}
+			return ErrNotAttested
+		})
+		if err != nil {
+			return nil, err
+		}
+		fp = append(fp, hop)
+		rr = hop.Record
+	}
+
+	rosters := make(map[string]*Roster, len(route))
+	for _, r := range route {
+		rosters[r.Name] = r
+	}
+	return fp, VerifyFederatedProof(suite, rosters, val, fp)
+}
+
+// Ask the servers of a group in turn until one answers
+func (c *Client) askGroup(r *Roster, ask func(server string) error) error {
+	err := ErrUnknownGroup
+	for _, server := range r.Servers {
+		if err = ask(server); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// Configuration of the groups we attest our rounds at
+type FederationConfig struct {
+	Group string    // name of our group in the rosters of the peers
+	Every int       // rounds between attestations
+	Peers []*Roster // our own group, if listed, is skipped
+}
+
+// FederationConfig as it appears in json files, keys are hex encoded
+type federationJSON struct {
+	Group string `json:"group"`
+	Every int    `json:"every,omitempty"`
+	Peers []struct {
+		Name       string   `json:"name"`
+		Servers    []string `json:"servers"`
+		Keys       []string `json:"keys,omitempty"`
+		GroupKey   string   `json:"group_key,omitempty"`
+		MinSigners int      `json:"min_signers,omitempty"`
+	} `json:"peers"`
+}
+
+func decodePoint(suite abstract.Suite, s string) (abstract.Point, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	p := suite.Point()
+	if err := p.UnmarshalBinary(b); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Load the federation configuration from a json file
+func LoadFederationConfig(suite abstract.Suite, file string) (*FederationConfig, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var fj federationJSON
+	if err := json.Unmarshal(b, &fj); err != nil {
+		return nil, err
+	}
+	if fj.Group == "" || fj.Every < 0 {
+		return nil, errors.New("federation config needs our group and a non negative period")
+	}
+
+	fc := &FederationConfig{Group: fj.Group, Every: fj.Every}
+	if fc.Every == 0 {
+		fc.Every = 1
+	}
+	for _, pj := range fj.Peers {
+		if pj.Name == "" || len(pj.Servers) == 0 || len(pj.Keys) == 0 && pj.GroupKey == "" {
+			return nil, errors.New("federation peer needs a name, servers and keys")
+		}
+		if pj.MinSigners < 0 || pj.MinSigners > len(pj.Keys) {
+			return nil, errors.New("federation peer needs between 0 and all of its keys to sign")
+		}
+		r := &Roster{Name: pj.Name, Servers: pj.Servers, MinSigners: pj.MinSigners}
+		for _, k := range pj.Keys {
+			p, err := decodePoint(suite, k)
+			if err != nil {
+				return nil, err
+			}
+			r.Keys = append(r.Keys, p)
+		}
+		if pj.GroupKey != "" {
+			if r.GroupKey, err = decodePoint(suite, pj.GroupKey); err != nil {
+				return nil, err
+			}
+		}
+		fc.Peers = append(fc.Peers, r)
+	}
+	return fc, nil
+}
+
+// Attests the rounds signed by a server at the peer groups
+type Federation struct {
+	mu      sync.Mutex
+	suite   abstract.Suite
+	config  *FederationConfig
+	keep    int                // rounds whose attestations are kept
+	clients map[string]*Client // connections to the peer groups
+	hops    map[string]FederatedProof
+	roots   []string // attested Merkle roots, oldest first
+}
+
+// Attest the rounds this server signs as root at the peer groups of fc
+func (s *Server) Federate(fc *FederationConfig) {
+	f := &Federation{
+		suite:   s.Suite(),
+		config:  fc,
+		keep:    s.Config().RoundsInMemory,
+		clients: make(map[string]*Client),
+		hops:    make(map[string]FederatedProof)}
+	s.fedmu.Lock()
+	s.fed = f
+	s.fedmu.Unlock()
+	s.RegisterRecordFunc(f.onRecord)
+}
+
+// Federation the server attests its rounds with, nil if it does not
+func (s *Server) federation() *Federation {
+	s.fedmu.Lock()
+	defer s.fedmu.Unlock()
+	return s.fed
+}
+
+// Attestations of the round with Merkle root root, one hop per peer group
+func (f *Federation) Attested(root hashid.HashId) FederatedProof {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.hops[string(root)]
+}
+
+func (f *Federation) onRecord(view int, rr *sign.RoundRecord) {
+	if rr.Round%f.config.Every != 0 {
+		return
+	}
+	go f.attest(rr)
+}
+
+// Stamp the hash of rr at every peer group and keep their records
+func (f *Federation) attest(rr *sign.RoundRecord) {
+	leaf := rr.Hash(f.suite)
+	hops := make([]*Hop, len(f.config.Peers))
+	var wg sync.WaitGroup
+	for i, peer := range f.config.Peers {
+		if peer.Name == f.config.Group {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, peer *Roster) {
+			defer wg.Done()
+			hop, err := f.attestAt(peer, leaf)
+			if err != nil {
+				log.Warnln("round", rr.Round, "not attested by", peer.Name, ":", err)
+				return
+			}
+			hops[i] = hop
+		}(i, peer)
+	}
+	wg.Wait()
+
+	var fp FederatedProof
+	for _, hop := range hops {
+		if hop != nil {
+			fp = append(fp, hop)
+		}
+	}
+	if len(fp) == 0 {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.hops[string(rr.Message)] = fp
+	f.roots = append(f.roots, string(rr.Message))
+	for len(f.roots) > f.keep {
+		delete(f.hops, f.roots[0])
+		f.roots = f.roots[1:]
+	}
+}
+
+// Client connected to the servers of peer, replaced once its
+// connections failed
+func (f *Federation) client(peer *Roster) *Client {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c := f.clients[peer.Name]
+	if c != nil {
+		c.Mux.Lock()
+		failed := c.Error != nil
+		c.Mux.Unlock()
+		if !failed {
+			return c
+		}
+		c.Close()
+	}
+	c = NewClient(f.config.Group)
+	for _, server := range peer.Servers {
+		c.AddServer(server, coconet.NewTCPConn(server))
+	}
+	f.clients[peer.Name] = c
+	return c
+}
+
+func (f *Federation) attestAt(peer *Roster, leaf hashid.HashId) (*Hop, error) {
+	c := f.client(peer)
+	rosters := map[string]*Roster{peer.Name: peer}
+	var hop *Hop
+	err := c.askGroup(peer, func(server string) error {
+		reply, err := c.Stamp(leaf, server)
+		if err != nil {
+			return err
+		}
+		// servers other than the root get the record with the next round
+		for try := 0; try < 3; try++ {
+			rr, err := c.Record(f.suite, reply.Sig, server)
+			if err == ErrNoRecord {
+				time.Sleep(c.RoundTime)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			hop = &Hop{Group: peer.Name, Leaf: leaf, Nonce: reply.Nonce, Path: reply.Prf, Record: rr}
+			return VerifyFederatedProof(f.suite, rosters, leaf, FederatedProof{hop})
+		}
+		return ErrNoRecord
+	})
+	return hop, err
+}
@@ -0,0 +1,160 @@
+package stamp_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/crypto/abstract"
+	"github.com/dedis/prifi/coco/coconet"
+	"github.com/dedis/prifi/coco/hashid"
+	"github.com/dedis/prifi/coco/proof"
+	"github.com/dedis/prifi/coco/sign"
+	"github.com/dedis/prifi/coco/stamp"
+	"github.com/dedis/prifi/coco/test/oldconfig"
+)
+
+// Sign one round holding leaf on a new group, returning its roster,
+// the path from leaf to the signed message and the record of the round
+func signLeaf(t *testing.T, name string, leaf hashid.HashId) (abstract.Suite, *stamp.Roster, proof.Proof, *sign.RoundRecord) {
+	hc, err := oldconfig.LoadConfig("../test/data/exconf.json", oldconfig.ConfigOptions{Config: testConfig()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = hc.Run(false, sign.PubKey); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, sn := range hc.SNodes {
+			sn.Close()
+		}
+		time.Sleep(1 * time.Second)
+	}()
+
+	root := hc.SNodes[0]
+	mtRoot, proofs := proof.ProofTree(root.Suite().Hash, []hashid.HashId{leaf, hashid.HashId(name)})
+	root.LogTest = mtRoot
+	if err = root.StartAnnouncement(&sign.AnnouncementMessage{LogTest: root.LogTest, Round: 1}); err != nil {
+		t.Fatal(err)
+	}
+	rr := root.FindRecord(mtRoot)
+	if rr == nil {
+		t.Fatal("no record of the round signed by", name)
+	}
+
+	r := &stamp.Roster{Name: name}
+	for _, sn := range hc.SNodes {
+		r.Keys = append(r.Keys, sn.PubKey)
+	}
+	return root.Suite(), r, proofs[0], rr
+}
+
+// A value stamped by one group and attested by another verifies
+// against the rosters of both
+func TestFederatedProof(t *testing.T) {
+	val := hashid.HashId("federated value, hash sized......")
+	suite, a, pathA, rrA := signLeaf(t, "a", val)
+	_, b, pathB, rrB := signLeaf(t, "b", rrA.Hash(suite))
+
+	fp := stamp.FederatedProof{
+		&stamp.Hop{Group: "a", Leaf: val, Path: pathA, Record: rrA},
+		&stamp.Hop{Group: "b", Leaf: rrA.Hash(suite), Path: pathB, Record: rrB}}
+	rosters := map[string]*stamp.Roster{"a": a, "b": b}
+	if err := stamp.VerifyFederatedProof(suite, rosters, val, fp); err != nil {
+		t.Fatal("federated proof rejected:", err)
+	}
+
+	data, err := fp.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := stamp.UnmarshalFederatedProof(suite, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stamp.VerifyFederatedProof(suite, rosters, val, decoded); err != nil {
+		t.Fatal("decoded federated proof rejected:", err)
+	}
+
+	if err := stamp.VerifyFederatedProof(suite, rosters, []byte("other value"), fp); err == nil {
+		t.Fatal("federated proof accepted for another value")
+	}
+	swapped := map[string]*stamp.Roster{"a": b, "b": a}
+	if err := stamp.VerifyFederatedProof(suite, swapped, val, fp); err == nil {
+		t.Fatal("federated proof accepted under the keys of another group")
+	}
+	strict := *a
+	strict.MinSigners = len(a.Keys) + 1
+	if err := strict.Verify(suite, rrA); err != sign.ErrTooFewSigners {
+		t.Fatal("record accepted with fewer signers than the roster requires:", err)
+	}
+	if err := stamp.VerifyFederatedProof(suite, map[string]*stamp.Roster{"a": &strict, "b": b}, val, fp); err == nil {
+		t.Fatal("federated proof accepted with fewer signers than the roster requires")
+	}
+	unchained := stamp.FederatedProof{fp[1], fp[0]}
+	if err := stamp.VerifyFederatedProof(suite, rosters, val, unchained); err == nil {
+		t.Fatal("hops accepted out of order")
+	}
+}
+
+// The root of group a attests its rounds at group b: a client proves
+// a value stamped at a with the record and attestations a serves
+func TestFederation(t *testing.T) {
+	oldconfig.StartConfigPort += 2010
+	tcp := func() oldconfig.ConfigOptions {
+		return oldconfig.ConfigOptions{ConnType: "tcp", GenHosts: true, Config: testConfig()}
+	}
+	b := startGroup(t, "b", "../test/data/extcpconf.json", tcp(), 1, nil)
+	defer b.Close()
+	a := startGroup(t, "a", "../test/data/extcpconf.json", tcp(), 1, func(stampers []*stamp.Server) {
+		stampers[0].Federate(&stamp.FederationConfig{Group: "a", Every: 1, Peers: []*stamp.Roster{b.roster}})
+	})
+	defer a.Close()
+
+	suite := a.hc.SNodes[0].Suite()
+	c := stamp.NewClient("prover")
+	for _, server := range a.roster.Servers {
+		c.AddServer(server, coconet.NewTCPConn(server))
+	}
+	defer c.Close()
+
+	// the round of the value is attested once b signed the hash of its record
+	val := []byte("value attested by a peer group..")
+	route := []*stamp.Roster{a.roster, b.roster}
+	var reply *stamp.StampReply
+	var fp stamp.FederatedProof
+	var err error
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		if reply == nil {
+			reply, err = c.Stamp(val, a.roster.Servers[1])
+		}
+		if reply != nil {
+			if fp, err = c.Prove(suite, val, reply, route); err == nil {
+				break
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no federated proof:", err)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	if len(fp) != 2 || fp[0].Group != "a" || fp[1].Group != "b" {
+		t.Fatal("federated proof does not follow the route")
+	}
+	rosters := map[string]*stamp.Roster{"a": a.roster, "b": b.roster}
+	if err := stamp.VerifyFederatedProof(suite, rosters, val, fp); err != nil {
+		t.Fatal("federated proof rejected:", err)
+	}
+	swapped := map[string]*stamp.Roster{"a": b.roster, "b": a.roster}
+	if err := stamp.VerifyFederatedProof(suite, swapped, val, fp); err == nil {
+		t.Fatal("federated proof accepted under the keys of another group")
+	}
+
+	if _, err := c.Record(suite, hashid.HashId("root of no round"), a.roster.Servers[0]); err != stamp.ErrNoRecord {
+		t.Fatal("record served for an unknown round:", err)
+	}
+	if _, err := c.Attestations(suite, fp[0].Record.Message, a.roster.Servers[1]); err != stamp.ErrNotAttested {
+		t.Fatal("attestations served by a server that does not federate:", err)
+	}
+}
@@ -0,0 +1,187 @@
+package stamp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sync"
+
+	"github.com/dedis/crypto/abstract"
+	"github.com/dedis/prifi/coco/hashid"
+	"github.com/dedis/prifi/coco/proof"
+	"github.com/dedis/prifi/coco/sign"
+)
+
+// Round history tree
+//
+// Every server appends the Merkle root of each round it sees done to a
+// history tree, see proof/history.go. Servers aggregate their head, the
+// size and root of their history, into every round and the group keeps
+// the head of the root, so the record of round N carries the head of the
+// rounds before it under the collective signature, next to the clocks of
+// the round, see clock.go. Clients fetch a signed
+// head, check it against the roster of the group, then ask for proofs
+// that it extends an older head or includes the root of a round. Servers
+// check the head of the root against their own history before signing a
+// round, and refuse to sign it otherwise: a server that missed rounds
+// holds another history than the root, is excepted from the rounds that
+// follow and finds no signed head matching its own.
+
+var ErrNoHead error = errors.New("no signed head of this size")
+var ErrForeignHead error = errors.New("head of the root is not one of our history")
+
+// Head of the history of rounds
+type Head struct {
+	Size int           // number of rounds
+	Root hashid.HashId // root of the history tree
+}
+
+func (h *Head) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 8, 8+len(h.Root))
+	binary.BigEndian.PutUint64(b, uint64(h.Size))
+	return append(b, h.Root...), nil
+}
+
+func (h *Head) UnmarshalBinary(data []byte) error {
+	if len(data) < 8 {
+		return ErrNoHead
+	}
+	h.Size = int(binary.BigEndian.Uint64(data))
+	h.Root = hashid.HashId(data[8:])
+	return nil
+}
+
+// Head with the record of the round that signed it
+type SignedHead struct {
+	Head
+	Record *sign.RoundRecord
+}
+
+// Head carried by the aggregate of a record
+func RecordHead(rr *sign.RoundRecord) (*SignedHead, error) {
+	ra := &roundAggregate{}
+	if err := ra.UnmarshalBinary(rr.Aggregate); err != nil {
+		return nil, err
+	}
+	return &SignedHead{Head: ra.Head, Record: rr}, nil
+}
+
+// Check that the head was signed by the hosts of the group of r
+func (sh *SignedHead) Verify(suite abstract.Suite, r *Roster) error {
+	if sh.Record == nil {
+		return ErrNoHead
+	}
+	rh, err := RecordHead(sh.Record)
+	if err != nil || rh.Size != sh.Size || !bytes.Equal(rh.Root, sh.Root) {
+		return ErrNoHead
+	}
+	return r.Verify(suite, sh.Record)
+}
+
+// History of the rounds seen by a server
+type history struct {
+	mu   sync.Mutex
+	tree *proof.History
+}
+
+// Head of the history of the node
+func (s *Server) head() Head {
+	s.hist.mu.Lock()
+	defer s.hist.mu.Unlock()
+	n := s.hist.tree.Size()
+	root, _ := s.hist.tree.Root(n)
+	return Head{Size: n, Root: root}
+}
+
+// Check that the head of the root is one of our history
+func (s *Server) checkHead(h *Head) error {
+	s.hist.mu.Lock()
+	defer s.hist.mu.Unlock()
+	root, err := s.hist.tree.Root(h.Size)
+	if err != nil || !bytes.Equal(root, h.Root) {
+		return ErrForeignHead
+	}
+	return nil
+}
+
+func (s *Server) appendHistory(root hashid.HashId) {
+	s.hist.mu.Lock()
+	s.hist.tree.Append(root)
+	s.hist.mu.Unlock()
+}
+
+// Newest record signing a head of our history, of the given size if
+// not 0. Records are looked for among the rounds in memory.
+func (s *Server) signedHead(size int) (*sign.RoundRecord, error) {
+	s.hist.mu.Lock()
+	defer s.hist.mu.Unlock()
+	n := s.hist.tree.Size()
+	for i := n - 1; i >= 0 && i >= n-s.Config().RoundsInMemory; i-- {
+		rr := s.FindRecord(s.hist.tree.Leaf(i))
+		if rr == nil {
+			continue
+		}
+		sh, err := RecordHead(rr)
+		if err != nil || size != 0 && sh.Size != size {
+			continue
+		}
+		if root, err := s.hist.tree.Root(sh.Size); err == nil && bytes.Equal(root, sh.Root) {
+			return rr, nil
+		}
+	}
+	return nil, ErrNoHead
+}
+
+func (s *Server) consistency(old, new int) (proof.Proof, error) {
+	s.hist.mu.Lock()
+	defer s.hist.mu.Unlock()
+	return s.hist.tree.Consistency(old, new)
+}
+
+func (s *Server) inclusion(index, size int) (hashid.HashId, proof.Proof, error) {
+	s.hist.mu.Lock()
+	defer s.hist.mu.Unlock()
+	prf, err := s.hist.tree.Inclusion(index, size)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.hist.tree.Leaf(index), prf, nil
+}
+
+// Signed head of the given size, the newest if 0
+func (c *Client) Head(suite abstract.Suite, size int, TSServerName string) (*SignedHead, error) {
+	tsm, err := c.request(TSServerName, &TimeStampMessage{
+		Type: HeadRequestType,
+		Hreq: &HeadRequest{Size: size}})
+	if err != nil {
+		return nil, err
+	}
+	rr, err := sign.UnmarshalRoundRecord(suite, tsm.Hrep.Rec)
+	if err != nil {
+		return nil, err
+	}
+	return RecordHead(rr)
+}
+
+// Proof that the head of size new extends the head of size old
+func (c *Client) Consistency(old, new int, TSServerName string) (proof.Proof, error) {
+	tsm, err := c.request(TSServerName, &TimeStampMessage{
+		Type: ConsistencyRequestType,
+		Creq: &ConsistencyRequest{Old: old, New: new}})
+	if err != nil {
+		return nil, err
+	}
+	return tsm.Crep.Prf, nil
+}
+
+// Merkle root of round index in the history, with the proof it is
+// included in the head of size size
+func (c *Client) Inclusion(index, size int, TSServerName string) (hashid.HashId, proof.Proof, error) {
+	tsm, err := c.request(TSServerName, &TimeStampMessage{
+		Type: InclusionRequestType,
+		Ireq: &InclusionRequest{Index: index, Size: size}})
+	if err != nil {
+		return nil, nil, err
+	}
+	return tsm.Irep.Root, tsm.Irep.Prf, nil
+}
@@ -0,0 +1,50 @@
+package stamp_test
+
+import (
+	"testing"
+
+	"github.com/dedis/prifi/coco/proof"
+	"github.com/dedis/prifi/coco/test/oldconfig"
+)
+
+// Heads served by a server are signed by the group, extend the heads
+// before them and include the roots of the rounds done
+func TestRoundHistoryTree(t *testing.T) {
+	g := startGroup(t, "test", "../test/data/exconf.json", oldconfig.ConfigOptions{Config: testConfig()}, 5, nil)
+	defer g.Close()
+	suite, roster := g.hc.SNodes[0].Suite(), g.roster
+	c, server := g.clients[0], g.stampers[1].Name()
+
+	head, err := c.Head(suite, 0, server)
+	if err != nil {
+		t.Fatal("no signed head:", err)
+	}
+	if err := head.Verify(suite, roster); err != nil {
+		t.Fatal("head not signed by the group:", err)
+	}
+	old, err := c.Head(suite, head.Size-1, server)
+	if err != nil {
+		t.Fatal("no signed head of size", head.Size-1, ":", err)
+	}
+	if err := old.Verify(suite, roster); err != nil {
+		t.Fatal("head not signed by the group:", err)
+	}
+
+	prf, err := c.Consistency(old.Size, head.Size, server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proof.VerifyConsistency(suite.Hash, old.Size, head.Size, old.Root, head.Root, prf) {
+		t.Fatal("head", head.Size, "does not extend head", old.Size)
+	}
+	root, prf, err := c.Inclusion(0, head.Size, server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proof.VerifyInclusion(suite.Hash, 0, head.Size, root, prf, head.Root) {
+		t.Fatal("first round not included in head", head.Size)
+	}
+	if _, _, err := c.Inclusion(head.Size+100, head.Size, server); err == nil {
+		t.Fatal("inclusion proof of a round past the head")
+	}
+}
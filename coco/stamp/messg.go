@@ -32,8 +32,15 @@ type StampRequest struct {
 	Val []byte // Hash-size value to timestamp
 }
 type StampReply struct {
-	Sig []byte      // Signature on the root
-	Prf proof.Proof // Merkle proof of value
+	Sig   []byte      // Signature on the root
+	Prf   proof.Proof // Merkle proof of value
+	Nonce []byte      // Salt of the leaf of the value, see proof.SaltedLeaf
+}
+
+// Check that the reply is a receipt for val: the proof leads from val
+// salted with the nonce to the root
+func (Srep *StampReply) Verify(newHash proof.HashFunc, val []byte) bool {
+	return proof.CheckSaltedProof(newHash, Srep.Sig, Srep.Nonce, val, Srep.Prf)
 }
 
 // Request to obtain an old log-entry and, optionally,
@@ -66,6 +73,59 @@ type BlockReply struct {
 	Dat [][]byte // Content of block(s) requested
 }
 
+// Request the record of the signed round whose Merkle root is Root,
+// a client checks the signature on it against the keys of the group.
+// The record reaches servers other than the root with the next round.
+type RecordRequest struct {
+	Root hashid.HashId // Merkle root of the round, the Sig of a StampReply
+}
+type RecordReply struct {
+	Rec []byte // Encoded sign.RoundRecord, empty if unknown to the server
+}
+
+// Request the attestations of a round by peer groups, see federation.go.
+// Only the root that signed the round holds them.
+type AttestRequest struct {
+	Root hashid.HashId // Merkle root of the round
+}
+type AttestReply struct {
+	Hops []byte // Encoded FederatedProof, one hop per attesting group
+}
+
+// Request a head of the history of rounds signed by the group,
+// see history.go
+type HeadRequest struct {
+	Size int // Size of the head, 0 for the newest one
+}
+type HeadReply struct {
+	Rec []byte // Encoded sign.RoundRecord whose aggregate is the head
+}
+
+// Request a proof that the head of size New extends the head of size Old
+type ConsistencyRequest struct {
+	Old, New int // Sizes of the old and new heads
+}
+type ConsistencyReply struct {
+	Prf proof.Proof // Consistency proof, see proof.VerifyConsistency
+}
+
+// Request a proof that the Merkle root of round Index is in the head of size Size
+type InclusionRequest struct {
+	Index, Size int // Index of the round in the history and size of the head
+}
+type InclusionReply struct {
+	Root hashid.HashId // Merkle root of the round
+	Prf  proof.Proof   // Inclusion proof, see proof.VerifyInclusion
+}
+
+// Request the random value of a round, see beacon.go
+type BeaconRequest struct {
+	Round int // number of the round, 0 for the newest one
+}
+type BeaconReply struct {
+	Rec []byte // Encoded sign.RoundRecord of the round
+}
+
 type ErrorReply struct {
 	Msg string // Human-readable error message
 }
@@ -76,14 +136,39 @@ const (
 	Error MessageType = iota
 	StampRequestType
 	StampReplyType
+	RecordRequestType
+	RecordReplyType
+	AttestRequestType
+	AttestReplyType
+	HeadRequestType
+	HeadReplyType
+	ConsistencyRequestType
+	ConsistencyReplyType
+	InclusionRequestType
+	InclusionReplyType
+	BeaconRequestType
+	BeaconReplyType
 )
 
 type TimeStampMessage struct {
 	ReqNo SeqNo // Request sequence number
-	// ErrorReply *ErrorReply // Generic error reply to any request
-	Type MessageType
+	Type  MessageType
+
+	Erep *ErrorReply // Generic error reply to any request, of type Error
 	Sreq *StampRequest
 	Srep *StampReply
+	Rreq *RecordRequest
+	Rrep *RecordReply
+	Areq *AttestRequest
+	Arep *AttestReply
+	Hreq *HeadRequest
+	Hrep *HeadReply
+	Creq *ConsistencyRequest
+	Crep *ConsistencyReply
+	Ireq *InclusionRequest
+	Irep *InclusionReply
+	Breq *BeaconRequest
+	Brep *BeaconReply
 }
 
 func (tsm TimeStampMessage) MarshalBinary() ([]byte, error) {
@@ -98,6 +183,32 @@ func (tsm TimeStampMessage) MarshalBinary() ([]byte, error) {
 		sub, err = tsm.Sreq.MarshalBinary()
 	case StampReplyType:
 		sub, err = tsm.Srep.MarshalBinary()
+	case RecordRequestType:
+		sub, err = gobEncode(tsm.Rreq.Root)
+	case RecordReplyType:
+		sub, err = gobEncode(tsm.Rrep.Rec)
+	case AttestRequestType:
+		sub, err = gobEncode(tsm.Areq.Root)
+	case AttestReplyType:
+		sub, err = gobEncode(tsm.Arep.Hops)
+	case HeadRequestType:
+		sub, err = gobEncode(tsm.Hreq)
+	case HeadReplyType:
+		sub, err = gobEncode(tsm.Hrep)
+	case ConsistencyRequestType:
+		sub, err = gobEncode(tsm.Creq)
+	case ConsistencyReplyType:
+		sub, err = gobEncode(tsm.Crep)
+	case InclusionRequestType:
+		sub, err = gobEncode(tsm.Ireq)
+	case InclusionReplyType:
+		sub, err = gobEncode(tsm.Irep)
+	case BeaconRequestType:
+		sub, err = gobEncode(tsm.Breq)
+	case BeaconReplyType:
+		sub, err = gobEncode(tsm.Brep)
+	case Error:
+		sub, err = gobEncode(tsm.Erep)
 	}
 	if err == nil {
 		b.Write(sub)
@@ -117,11 +228,59 @@ func (sm *TimeStampMessage) UnmarshalBinary(data []byte) error {
 	case StampReplyType:
 		sm.Srep = &StampReply{}
 		err = sm.Srep.UnmarshalBinary(msgBytes)
-
+	case RecordRequestType:
+		sm.Rreq = &RecordRequest{}
+		err = gobDecode(msgBytes, &sm.Rreq.Root)
+	case RecordReplyType:
+		sm.Rrep = &RecordReply{}
+		err = gobDecode(msgBytes, &sm.Rrep.Rec)
+	case AttestRequestType:
+		sm.Areq = &AttestRequest{}
+		err = gobDecode(msgBytes, &sm.Areq.Root)
+	case AttestReplyType:
+		sm.Arep = &AttestReply{}
+		err = gobDecode(msgBytes, &sm.Arep.Hops)
+	case HeadRequestType:
+		sm.Hreq = &HeadRequest{}
+		err = gobDecode(msgBytes, sm.Hreq)
+	case HeadReplyType:
+		sm.Hrep = &HeadReply{}
+		err = gobDecode(msgBytes, sm.Hrep)
+	case ConsistencyRequestType:
+		sm.Creq = &ConsistencyRequest{}
+		err = gobDecode(msgBytes, sm.Creq)
+	case ConsistencyReplyType:
+		sm.Crep = &ConsistencyReply{}
+		err = gobDecode(msgBytes, sm.Crep)
+	case InclusionRequestType:
+		sm.Ireq = &InclusionRequest{}
+		err = gobDecode(msgBytes, sm.Ireq)
+	case InclusionReplyType:
+		sm.Irep = &InclusionReply{}
+		err = gobDecode(msgBytes, sm.Irep)
+	case BeaconRequestType:
+		sm.Breq = &BeaconRequest{}
+		err = gobDecode(msgBytes, sm.Breq)
+	case BeaconReplyType:
+		sm.Brep = &BeaconReply{}
+		err = gobDecode(msgBytes, sm.Brep)
+	case Error:
+		sm.Erep = &ErrorReply{}
+		err = gobDecode(msgBytes, sm.Erep)
 	}
 	return err
 }
 
+func gobEncode(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	err := gob.NewEncoder(&b).Encode(v)
+	return b.Bytes(), err
+}
+
+func gobDecode(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewBuffer(data)).Decode(v)
+}
+
 func (Sreq StampRequest) MarshalBinary() ([]byte, error) {
 	var b bytes.Buffer
 	enc := gob.NewEncoder(&b)
@@ -140,6 +299,12 @@ func (Srep StampReply) MarshalBinary() ([]byte, error) {
 	var b bytes.Buffer
 	enc := gob.NewEncoder(&b)
 	err := enc.Encode(Srep.Sig)
+	if err == nil {
+		err = enc.Encode(Srep.Prf)
+	}
+	if err == nil {
+		err = enc.Encode(Srep.Nonce)
+	}
 	return b.Bytes(), err
 }
 
@@ -147,5 +312,11 @@ func (Srep *StampReply) UnmarshalBinary(data []byte) error {
 	b := bytes.NewBuffer(data)
 	dec := gob.NewDecoder(b)
 	err := dec.Decode(&Srep.Sig)
+	if err == nil {
+		err = dec.Decode(&Srep.Prf)
+	}
+	if err == nil {
+		err = dec.Decode(&Srep.Nonce)
+	}
 	return err
 }
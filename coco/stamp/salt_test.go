@@ -0,0 +1,39 @@
+package stamp_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dedis/prifi/coco/test/oldconfig"
+)
+
+// Stamp replies carry the nonce salting the leaf of the value, and
+// their proofs reveal neither the value nor those of other clients
+func TestSaltedReceipt(t *testing.T) {
+	g := startGroup(t, "test", "../test/data/exconf.json", oldconfig.ConfigOptions{Config: testConfig()}, 1, nil)
+	defer g.Close()
+
+	suite := g.hc.SNodes[0].Suite()
+	val := []byte("low entropy value, hash sized...")
+	other := []byte("another value stamped alongside")
+	server := g.stampers[1].Name()
+	go g.clients[0].Stamp(other, server)
+	reply, err := g.clients[0].Stamp(val, server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reply.Nonce) == 0 {
+		t.Fatal("stamp reply without a nonce")
+	}
+	if !reply.Verify(suite.Hash, val) {
+		t.Fatal("receipt does not verify")
+	}
+	if reply.Verify(suite.Hash, other) {
+		t.Fatal("receipt verifies for another value")
+	}
+	for _, h := range reply.Prf {
+		if bytes.Equal(h, val) || bytes.Equal(h, other) {
+			t.Fatal("proof reveals a stamped value")
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 	log "github.com/Sirupsen/logrus"
 
+	"github.com/dedis/crypto/random"
 	"github.com/dedis/prifi/coco/coconet"
 	"github.com/dedis/prifi/coco/hashid"
 	"github.com/dedis/prifi/coco/proof"
@@ -30,11 +31,19 @@ type Server struct {
 	Leaves []hashid.HashId // can be removed after we verify protocol
 	Root   hashid.HashId
 	Proofs []proof.Proof
+	Nonces [][]byte // salts of the leaves, sent back to clients
 
 	rLock     sync.Mutex
-	maxRounds int
+	maxRounds int // rounds to run, -1 until Run is called
 	closeChan chan bool
 
+	fedmu sync.Mutex
+	fed   *Federation // attests our rounds at peer groups, see Federate
+	hist  history     // Merkle roots of the rounds done, see history.go
+	drift drift       // nodes with drifting clocks, see clock.go
+
+	Now func() time.Time // clock read for the rounds, time.Now if nil, see clock.go
+
 	Logger   string
 	Hostname string
 	App      string
@@ -51,7 +60,11 @@ func NewServer(signer sign.Signer) *Server {
 	s.Signer = signer
 	s.Signer.RegisterAnnounceFunc(s.OnAnnounce())
 	s.Signer.RegisterDoneFunc(s.OnDone())
-	s.rLock = sync.Mutex{}
+	s.Signer.RegisterShutdownFunc(s.OnShutdown())
+	s.hist.tree = proof.NewHistory(signer.Suite().Hash)
+	s.Signer.RegisterAggregator(s.roundAggregate, combineRounds)
+	s.Signer.RegisterAggregateDoneFunc(s.checkDrift)
+	s.Signer.RegisterAggregateCheckFunc(s.checkRound)
 
 	// listen for client requests at one port higher
 	// than the signing node
@@ -66,6 +79,7 @@ func NewServer(signer sign.Signer) *Server {
 	s.Queue[s.READING] = make([]MustReplyMessage, 0)
 	s.Queue[s.PROCESSING] = make([]MustReplyMessage, 0)
 	s.closeChan = make(chan bool, 5)
+	s.maxRounds = -1
 	return s
 }
 
@@ -107,22 +121,15 @@ func (s *Server) Listen() error {
 					for {
 						tsm := TimeStampMessage{}
 						err := c.Get(&tsm)
+						if err != nil && s.ShuttingDown() {
+							return
+						}
 						if err != nil {
 							log.Errorf("%p Failed to get from child:", s, err)
 							s.Close()
 							return
 						}
-						switch tsm.Type {
-						default:
-							log.Errorf("Message of unknown type: %v\n", tsm.Type)
-						case StampRequestType:
-							// log.Println("RECEIVED STAMP REQUEST")
-							s.mux.Lock()
-							READING := s.READING
-							s.Queue[READING] = append(s.Queue[READING],
-								MustReplyMessage{Tsm: tsm, To: c.Name()})
-							s.mux.Unlock()
-						}
+						s.serve(tsm, c.Name())
 					}
 				}(c)
 			}
@@ -142,6 +149,9 @@ func (s *Server) ListenToClients() {
 			for {
 				tsm := TimeStampMessage{}
 				err := c.Get(&tsm)
+				if err == coconet.ErrClosed && s.ShuttingDown() {
+					return
+				}
 				if err == coconet.ErrClosed {
 					log.Errorf("%p Failed to get from client:", s, err)
 					s.Close()
@@ -152,22 +162,108 @@ func (s *Server) ListenToClients() {
 						"file": logutils.File(),
 					}).Errorf("%p failed To get message:", s, err)
 				}
-				switch tsm.Type {
-				default:
-					log.Errorln("Message of unknown type")
-				case StampRequestType:
-					// log.Println("STAMP REQUEST")
-					s.mux.Lock()
-					READING := s.READING
-					s.Queue[READING] = append(s.Queue[READING],
-						MustReplyMessage{Tsm: tsm, To: c.Name()})
-					s.mux.Unlock()
-				}
+				s.serve(tsm, c.Name())
 			}
 		}(c)
 	}
 }
 
+// Act on a request of the client named from
+func (s *Server) serve(tsm TimeStampMessage, from string) {
+	switch tsm.Type {
+	default:
+		log.Errorf("Message of unknown type: %v\n", tsm.Type)
+	case StampRequestType:
+		// log.Println("RECEIVED STAMP REQUEST")
+		s.mux.Lock()
+		READING := s.READING
+		s.Queue[READING] = append(s.Queue[READING],
+			MustReplyMessage{Tsm: tsm, To: from})
+		s.mux.Unlock()
+	case RecordRequestType:
+		var rec []byte
+		if rr := s.FindRecord(tsm.Rreq.Root); rr != nil {
+			var err error
+			if rec, err = rr.MarshalBinary(); err != nil {
+				log.Errorln(s.Name(), "unable to encode record:", err)
+			}
+		}
+		s.PutToClient(from, TimeStampMessage{
+			Type:  RecordReplyType,
+			ReqNo: tsm.ReqNo,
+			Rrep:  &RecordReply{Rec: rec}})
+	case AttestRequestType:
+		var hops []byte
+		if fed := s.federation(); fed != nil {
+			var err error
+			if hops, err = fed.Attested(tsm.Areq.Root).MarshalBinary(); err != nil {
+				log.Errorln(s.Name(), "unable to encode attestations:", err)
+			}
+		}
+		s.PutToClient(from, TimeStampMessage{
+			Type:  AttestReplyType,
+			ReqNo: tsm.ReqNo,
+			Arep:  &AttestReply{Hops: hops}})
+	case HeadRequestType:
+		rr, err := s.signedHead(tsm.Hreq.Size)
+		var rec []byte
+		if err == nil {
+			rec, err = rr.MarshalBinary()
+		}
+		if err != nil {
+			s.putError(from, tsm.ReqNo, err)
+			break
+		}
+		s.PutToClient(from, TimeStampMessage{
+			Type:  HeadReplyType,
+			ReqNo: tsm.ReqNo,
+			Hrep:  &HeadReply{Rec: rec}})
+	case ConsistencyRequestType:
+		prf, err := s.consistency(tsm.Creq.Old, tsm.Creq.New)
+		if err != nil {
+			s.putError(from, tsm.ReqNo, err)
+			break
+		}
+		s.PutToClient(from, TimeStampMessage{
+			Type:  ConsistencyReplyType,
+			ReqNo: tsm.ReqNo,
+			Crep:  &ConsistencyReply{Prf: prf}})
+	case InclusionRequestType:
+		root, prf, err := s.inclusion(tsm.Ireq.Index, tsm.Ireq.Size)
+		if err != nil {
+			s.putError(from, tsm.ReqNo, err)
+			break
+		}
+		s.PutToClient(from, TimeStampMessage{
+			Type:  InclusionReplyType,
+			ReqNo: tsm.ReqNo,
+			Irep:  &InclusionReply{Root: root, Prf: prf}})
+	case BeaconRequestType:
+		rr := s.SignedRound(tsm.Breq.Round)
+		var rec []byte
+		err := ErrNoRecord
+		if rr != nil {
+			rec, err = rr.MarshalBinary()
+		}
+		if err != nil {
+			s.putError(from, tsm.ReqNo, err)
+			break
+		}
+		s.PutToClient(from, TimeStampMessage{
+			Type:  BeaconReplyType,
+			ReqNo: tsm.ReqNo,
+			Brep:  &BeaconReply{Rec: rec}})
+	}
+}
+
+// Send err back to the client named to as the reply to request reqno
+func (s *Server) putError(to string, reqno SeqNo, err error) {
+	s.PutToClient(to, TimeStampMessage{
+		Type:  Error,
+		ReqNo: reqno,
+		Erep:  &ErrorReply{Msg: err.Error()}})
+}
+
 func (s *Server) ConnectToLogger() {
 	return
 	if s.Logger == "" || s.Hostname == "" || s.App == "" {
@@ -213,22 +309,43 @@ func (s *Server) LogReRun(nextRole string, curRole string) {
 
 }
 
+// rounds the root waits for the group to shut down after the max round
+// before closing on its own
+const ShutdownGraceRounds = 5
+
 func (s *Server) runAsRoot(nRounds int) string {
 	// every 5 seconds start a new round
-	ticker := time.Tick(ROUND_TIME)
+	ticker := time.Tick(s.Config().RoundTime)
 	if s.LastRound()+1 > nRounds {
 		log.Errorln(s.Name(), "runAsRoot called with too large round number")
 		return "close"
 	}
 
 	log.Infoln(s.Name(), "running as root", s.LastRound(), int64(nRounds))
+	if err := s.StartKeyGeneration(); err != nil {
+		log.Errorln(s.Name(), "unable to set up the group key:", err)
+		return "close"
+	}
+	shutdown := false // shutdown of the group proposed
+	grace := 0        // rounds waited since
 	for {
 		select {
 		case nextRole := <-s.ViewChangeCh():
 			log.Println(s.Name(), "assuming next role")
 			return nextRole
 			// s.reRunWith(nextRole, nRounds, true)
+		case <-s.Closed():
+			log.Infoln(s.Name(), "closed after", s.LastRound(), "rounds")
+			return ""
 		case <-ticker:
+			// hard stop if the group shutdown does not go through
+			if shutdown {
+				grace++
+			}
+			if grace > ShutdownGraceRounds || s.LastRound() >= nRounds+ShutdownGraceRounds {
+				log.Errorln(s.Name(), "group not shut down", ShutdownGraceRounds, "rounds after the max round: closing")
+				return "close"
+			}
 
 			start := time.Now()
 			log.Println(s.Name(), "is STAMP SERVER STARTING SIGNING ROUND FOR:", s.LastRound()+1, "of", nRounds)
@@ -245,7 +362,10 @@ func (s *Server) runAsRoot(nRounds int) string {
 				err = s.StartSigningRound()
 			}
 
-			if err == sign.ChangingViewError {
+			if err == sign.ErrShuttingDown {
+				// wait for the group to close
+				break
+			} else if err == sign.ChangingViewError {
 				// report change in view, and continue with the select
 				log.WithFields(log.Fields{
 					"file": logutils.File(),
@@ -260,9 +380,13 @@ func (s *Server) runAsRoot(nRounds int) string {
 				break
 			}
 
-			if s.LastRound()+1 >= nRounds {
-				log.Errorln(s.Name(), "reports exceeded the max round: terminating", s.LastRound()+1, ">=", nRounds)
-				return "close"
+			if s.LastRound()+1 >= nRounds && !shutdown {
+				shutdown = true
+				log.Infoln(s.Name(), "reached the max round: shutting down", s.LastRound()+1, ">=", nRounds)
+				if err := s.Shutdown("reached max rounds"); err != nil {
+					log.Errorln(s.Name(), "unable to shut down the group:", err)
+					return "close"
+				}
 			}
 
 			elapsed := time.Since(start)
@@ -286,6 +410,10 @@ func (s *Server) runAsRegular() string {
 		}).Infoln("server" + s.Name() + "has closed")
 		return ""
 
+	case <-s.Closed():
+		log.Infoln(s.Name(), "closed with status", s.ExitStatus())
+		return ""
+
 	case nextRole := <-s.ViewChangeCh():
 		return nextRole
 	}
@@ -375,6 +503,7 @@ func (s *Server) OnAnnounce() sign.CommitFunc {
 
 func (s *Server) OnDone() sign.DoneFunc {
 	return func(view int, SNRoot hashid.HashId, LogHash hashid.HashId, p proof.Proof) {
+		s.appendHistory(SNRoot)
 		s.mux.Lock()
 		for i, msg := range s.Queue[s.PROCESSING] {
 			// proof to get from s.Root to big root
@@ -385,14 +514,14 @@ func (s *Server) OnDone() sign.DoneFunc {
 			combProof = append(combProof, s.Proofs[i]...)
 
 			// proof that i can get from a leaf message to the big root
-			if sign.DEBUG == true {
+			if s.Config().Debug == true {
 				proof.CheckProof(s.Signer.(*sign.Node).Suite().Hash, SNRoot, s.Leaves[i], combProof)
 			}
 
 			respMessg := TimeStampMessage{
 				Type:  StampReplyType,
 				ReqNo: msg.Tsm.ReqNo,
-				Srep:  &StampReply{Sig: SNRoot, Prf: combProof}}
+				Srep:  &StampReply{Sig: SNRoot, Prf: combProof, Nonce: s.Nonces[i]}}
 
 			s.PutToClient(msg.To, respMessg)
 		}
@@ -401,6 +530,26 @@ func (s *Server) OnDone() sign.DoneFunc {
 
 }
 
+// Called once the last rounds are done on a shutdown of the group:
+// replies were sent for all signed rounds, clients with requests left
+// over have them fail as their connection closes
+func (s *Server) OnShutdown() sign.ShutdownFunc {
+	return func() error {
+		s.mux.Lock()
+		pending := len(s.Queue[s.READING])
+		s.Queue[s.READING] = s.Queue[s.READING][:0]
+		s.mux.Unlock()
+		if pending != 0 {
+			log.Warnln(s.Name(), "shutting down with", pending, "unsigned requests")
+		}
+
+		for _, c := range s.Clients {
+			c.Close()
+		}
+		return nil
+	}
+}
+
 func (s *Server) AggregateCommits(view int) []byte {
 	//log.Println(s.Name(), "calling AggregateCommits")
 	s.mux.Lock()
@@ -421,28 +570,34 @@ func (s *Server) AggregateCommits(view int) []byte {
 		return s.Root
 	}
 
-	// pull out to be Merkle Tree leaves
+	// pull out to be Merkle Tree leaves, salted so that proofs do not
+	// reveal the values of other clients
 	s.Leaves = make([]hashid.HashId, 0)
+	s.Nonces = make([][]byte, 0)
 	for _, msg := range Queue[PROCESSING] {
-		s.Leaves = append(s.Leaves, hashid.HashId(msg.Tsm.Sreq.Val))
+		nonce := random.Bytes(proof.NonceSize, random.Stream)
+		s.Nonces = append(s.Nonces, nonce)
+		s.Leaves = append(s.Leaves, proof.SaltedLeaf(s.Suite().Hash, nonce, msg.Tsm.Sreq.Val))
 	}
 	s.mux.Unlock()
 
-	// non root servers keep track of rounds here
+	// non root servers stop on their own if the group shutdown does not
+	// go through
 	if !s.IsRoot(view) {
 		s.rLock.Lock()
-		lsr := s.LastRound()
 		mr := s.maxRounds
 		s.rLock.Unlock()
-		// if this is our last round then close the connections
-		if lsr >= mr && mr >= 0 {
-			s.closeChan <- true
+		if mr >= 0 && s.LastRound() >= mr+ShutdownGraceRounds {
+			select {
+			case s.closeChan <- true:
+			default:
+			}
 		}
 	}
 
 	// create Merkle tree for this round's messages and check corectness
 	s.Root, s.Proofs = proof.ProofTree(s.Suite().Hash, s.Leaves)
-	if sign.DEBUG == true {
+	if s.Config().Debug == true {
 		if proof.CheckLocalProofs(s.Suite().Hash, s.Root, s.Leaves, s.Proofs) == true {
 			log.Println("Local Proofs of", s.Name(), "successful for round "+strconv.Itoa(int(s.LastRound())))
 		} else {
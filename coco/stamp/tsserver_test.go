@@ -2,6 +2,7 @@ package stamp_test
 
 import (
 	"fmt"
+	"net"
 	"strconv"
 	"sync"
 	"testing"
@@ -22,16 +23,97 @@ import (
 // 	//log.SetOutput(ioutil.Discard)
 // }
 
+// Returns the configuration used by test nodes: verify all paths and signatures
+func testConfig() *sign.Config {
+	return &sign.Config{Debug: true}
+}
+
+// Stamp servers of a group running rounds, see startGroup
+type testGroup struct {
+	hc       *oldconfig.HostConfig
+	stampers []*stamp.Server // the root first
+	clients  []*stamp.Client // one per server but the root
+	roster   *stamp.Roster
+}
+
+// Run the stamp servers of the group of file, after setup if not nil, and
+// wait until the root signed rounds rounds. The servers of the roster are
+// the addresses clients connect to.
+func startGroup(t *testing.T, name, file string, opts oldconfig.ConfigOptions, rounds int,
+	setup func(stampers []*stamp.Server)) *testGroup {
+	hc, err := oldconfig.LoadConfig(file, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range hc.SNodes {
+		n.RoundsPerView = 1000
+	}
+	if err = hc.Run(true, sign.MerkleTree); err != nil {
+		t.Fatal(err)
+	}
+	stampers, clients, err := hc.RunTimestamper(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := &testGroup{hc: hc, stampers: stampers, clients: clients, roster: &stamp.Roster{Name: name}}
+	for _, sn := range hc.SNodes {
+		g.roster.Keys = append(g.roster.Keys, sn.PubKey)
+	}
+	for _, s := range stampers {
+		g.roster.Servers = append(g.roster.Servers, clientAddr(hc, s))
+	}
+	if setup != nil {
+		setup(stampers)
+	}
+
+	for _, s := range stampers[1:] {
+		go s.Run("regular", 1000)
+		if hc.Dir != nil {
+			go s.ListenToClients()
+		}
+	}
+	go stampers[0].Run("root", 1000)
+	if hc.Dir != nil {
+		go stampers[0].ListenToClients()
+	}
+
+	deadline := time.Now().Add(30 * time.Second)
+	for hc.SNodes[0].LastRound() < rounds {
+		if time.Now().After(deadline) {
+			g.Close()
+			t.Fatal("group", name, "signed", hc.SNodes[0].LastRound(), "rounds, expected", rounds)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return g
+}
+
+// Address clients of the server connect to
+func clientAddr(hc *oldconfig.HostConfig, s *stamp.Server) string {
+	if hc.Dir != nil {
+		return s.Name()
+	}
+	h, p, _ := net.SplitHostPort(s.Name())
+	pn, _ := strconv.Atoi(p)
+	return net.JoinHostPort(h, strconv.Itoa(pn+1))
+}
+
+func (g *testGroup) Close() {
+	for _, sn := range g.hc.SNodes {
+		sn.Close()
+	}
+	for _, c := range g.clients {
+		c.Close()
+	}
+	time.Sleep(1 * time.Second)
+}
+
 // Configuration file data/exconf.json
 //       0
 //      / \
 //     1   4
 //    / \   \
 //   2   3   5
-func init() {
-	sign.DEBUG = true
-}
-
 func TestTSSIntegrationHealthy(t *testing.T) {
 	failAsRootEvery := 0     // never fail on announce
 	failAsFollowerEvery := 0 // never fail on commit or response
@@ -134,7 +216,7 @@ func runTSSIntegration(RoundsPerView, nMessages, nRounds, failureRate, failAsRoo
 	var err error
 
 	// load config with faulty or healthy hosts
-	opts := oldconfig.ConfigOptions{}
+	opts := oldconfig.ConfigOptions{Config: testConfig()}
 	if len(faultyNodes) > 0 {
 		opts.Faulty = true
 	}
@@ -217,7 +299,7 @@ func TestGoConnTimestampFromConfig(t *testing.T) {
 	nClients := 1
 	nRounds := 1
 
-	hc, err := oldconfig.LoadConfig("../test/data/exconf.json")
+	hc, err := oldconfig.LoadConfig("../test/data/exconf.json", oldconfig.ConfigOptions{Config: testConfig()})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -280,14 +362,14 @@ func TestGoConnTimestampFromConfig(t *testing.T) {
 
 func TestTCPTimestampFromConfigViewChange(t *testing.T) {
 	RoundsPerView := 5
-	if err := runTCPTimestampFromConfig(RoundsPerView, sign.MerkleTree, 1, 1, 5, 0); err != nil {
+	if err := runTCPTimestampFromConfig(0, RoundsPerView, sign.MerkleTree, 1, 1, 5, 0); err != nil {
 		t.Fatal(err)
 	}
 }
 
 func TestTCPTimestampFromConfigHealthy(t *testing.T) {
 	RoundsPerView := 5
-	if err := runTCPTimestampFromConfig(RoundsPerView, sign.MerkleTree, 1, 1, 5, 0); err != nil {
+	if err := runTCPTimestampFromConfig(0, RoundsPerView, sign.MerkleTree, 1, 1, 5, 0); err != nil {
 		t.Fatal(err)
 	}
 }
@@ -300,42 +382,40 @@ func TestTCPTimestampFromConfigFaulty(t *testing.T) {
 	// not mixing view changes with faults
 	RoundsPerView := 100
 	// not mixing view changes with faults
-	aux2 := sign.HEARTBEAT
-	sign.HEARTBEAT = 4 * sign.ROUND_TIME
+	heartbeat := 4 * sign.DefaultRoundTime
 
 	faultyNodes := make([]int, 0)
 	faultyNodes = append(faultyNodes, 2, 5)
-	if err := runTCPTimestampFromConfig(RoundsPerView, sign.MerkleTree, 1, 1, 5, 20, faultyNodes...); err != nil {
+	if err := runTCPTimestampFromConfig(heartbeat, RoundsPerView, sign.MerkleTree, 1, 1, 5, 20, faultyNodes...); err != nil {
 		t.Fatal(err)
 	}
-
-	sign.HEARTBEAT = aux2
 }
 
 func TestTCPTimestampFromConfigVote(t *testing.T) {
 	// not mixing view changes with faults
 	RoundsPerView := 3
 	// not mixing view changes with faults
-	aux2 := sign.HEARTBEAT
-	sign.HEARTBEAT = 4 * sign.ROUND_TIME
+	heartbeat := 4 * sign.DefaultRoundTime
 
-	if err := runTCPTimestampFromConfig(RoundsPerView, sign.Voter, 0, 0, 15, 0); err != nil {
+	if err := runTCPTimestampFromConfig(heartbeat, RoundsPerView, sign.Voter, 0, 0, 15, 0); err != nil {
 		t.Fatal(err)
 	}
-
-	sign.HEARTBEAT = aux2
 }
 
-func runTCPTimestampFromConfig(RoundsPerView int, signType, nMessages, nClients, nRounds, failureRate int, faultyNodes ...int) error {
+// heartbeat of 0 keeps the default heartbeat
+func runTCPTimestampFromConfig(heartbeat time.Duration, RoundsPerView int, signType, nMessages, nClients, nRounds, failureRate int, faultyNodes ...int) error {
 	var hc *oldconfig.HostConfig
 	var err error
 	oldconfig.StartConfigPort += 2010
 
+	config := testConfig()
+	config.Heartbeat = heartbeat
+
 	// load config with faulty or healthy hosts
 	if len(faultyNodes) > 0 {
-		hc, err = oldconfig.LoadConfig("../test/data/extcpconf.json", oldconfig.ConfigOptions{ConnType: "tcp", GenHosts: true, Faulty: true})
+		hc, err = oldconfig.LoadConfig("../test/data/extcpconf.json", oldconfig.ConfigOptions{ConnType: "tcp", GenHosts: true, Faulty: true, Config: config})
 	} else {
-		hc, err = oldconfig.LoadConfig("../test/data/extcpconf.json", oldconfig.ConfigOptions{ConnType: "tcp", GenHosts: true})
+		hc, err = oldconfig.LoadConfig("../test/data/extcpconf.json", oldconfig.ConfigOptions{ConnType: "tcp", GenHosts: true, Config: config})
 	}
 	if err != nil {
 		return err
@@ -425,6 +505,7 @@ func createClientsForTSServer(nClients int, s *stamp.Server, dir *coconet.GoDire
 	clients := make([]*stamp.Client, 0, nClients)
 	for i := 0; i < nClients; i++ {
 		clients = append(clients, stamp.NewClient("client"+strconv.Itoa(fClient+i)))
+		clients[i].Debug = true
 
 		// intialize TSServer conn to client
 		ngc, err := coconet.NewGoConn(dir, s.Name(), clients[i].Name())
@@ -0,0 +1,71 @@
+package stamp_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dedis/prifi/coco/sign"
+	"github.com/dedis/prifi/coco/stamp"
+	"github.com/dedis/prifi/coco/test/oldconfig"
+)
+
+// Confirmed view change votes applied by sn, oldest first
+func viewChanges(sn *sign.Node) []*sign.ViewChangeVote {
+	vcvs := make([]*sign.ViewChangeVote, 0)
+	for i := 1; i <= int(atomic.LoadInt64(&sn.LastAppliedVote)); i++ {
+		cert, err := sn.Certificate(i)
+		if err == nil && cert.Vote.Type == sign.ViewChangeVT {
+			vcvs = append(vcvs, cert.Vote.Vcv)
+		}
+	}
+	return vcvs
+}
+
+// Roots of new views are checked by every node from the signed record
+// and failed roots carried by the view change vote
+func TestViewChangeRoot(t *testing.T) {
+	g := startGroup(t, "test", "../test/data/exconf.json", oldconfig.ConfigOptions{Config: testConfig()}, 1,
+		func(stampers []*stamp.Server) {
+			for _, s := range stampers {
+				s.Signer.(*sign.Node).RoundsPerView = 3
+			}
+		})
+	defer g.Close()
+	suite, keys := g.hc.SNodes[0].Suite(), sign.HostKeys(g.roster.Keys)
+
+	deadline := time.Now().Add(30 * time.Second)
+	for _, sn := range g.hc.SNodes {
+		for len(viewChanges(sn)) < 2 {
+			if time.Now().After(deadline) {
+				t.Fatal(sn.Name(), "applied", len(viewChanges(sn)), "view changes, expected 2")
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+
+	for _, vcv := range viewChanges(g.hc.SNodes[0]) {
+		if vcv.SeedRecord == nil {
+			t.Fatal("view", vcv.View, "selected without a signed round")
+		}
+		if err := keys.Verify(suite, vcv.SeedRecord); err != nil {
+			t.Fatal("seed record of view", vcv.View, "not signed by the group:", err)
+		}
+		hostlist := g.hc.SNodes[0].HostListOn(vcv.View - 1)
+		if err := vcv.CheckRoot(suite, hostlist); err != nil {
+			t.Fatal("root of view", vcv.View, "not selected by its seed:", err)
+		}
+		for _, sn := range g.hc.SNodes {
+			if r := sn.RootFor(vcv.View); r != vcv.Root {
+				t.Fatal(sn.Name(), "has root", r, "for view", vcv.View, "instead of", vcv.Root)
+			}
+		}
+
+		// the proposer cannot skip the selected root
+		forged := *vcv
+		forged.FailedRoots = append(forged.FailedRoots, sign.FailedRoot{Name: vcv.Root, View: vcv.View - 1})
+		if err := forged.CheckRoot(suite, hostlist); err == nil {
+			t.Fatal("root of view", vcv.View, "accepted while skipped as failed")
+		}
+	}
+}
@@ -17,6 +17,7 @@ import (
 	"net"
 	"net/http"
 	_ "net/http/pprof"
+	"os"
 	"strconv"
 
 	_ "expvar"
@@ -42,6 +43,9 @@ var fFail int
 var amroot bool
 var testConnect bool
 var suite string
+var adminAddr string
+var adminToken string
+var federation string
 
 // TODO: add debug flag for more debugging information (memprofilerate...)
 func init() {
@@ -60,14 +64,14 @@ func init() {
 	flag.BoolVar(&amroot, "amroot", false, "am I root node")
 	flag.BoolVar(&testConnect, "test_connect", false, "test connecting and disconnecting")
 	flag.StringVar(&suite, "suite", "nist256", "abstract suite to use [nist256, nist512, ed25519]")
+	flag.StringVar(&adminAddr, "admin", "", "address of the operator endpoint [host:port|unix:/path], disabled if empty")
+	flag.StringVar(&adminToken, "admintoken", "", "file holding the operator token")
+	flag.StringVar(&federation, "federation", "", "json file of the peer groups to attest our rounds at, disabled if empty")
 }
 
 func main() {
 	flag.Parse()
 	log.Println("Running Timestamper:", logger)
-	defer func() {
-		log.Errorln("TERMINATING HOST")
-	}()
 
 	// connect with the logging server
 	if logger != "" && (amroot || debug) {
@@ -105,5 +109,7 @@ func main() {
 	}()
 
 	// log.Println("!!!!!!!!!!!!!!!Running timestamp with rFail and fFail: ", rFail, fFail)
-	timestamper.Run(hostname, cfg, app, rounds, rootwait, debug, testConnect, failures, rFail, fFail, logger, suite)
+	status := timestamper.Run(hostname, cfg, app, rounds, rootwait, debug, testConnect, failures, rFail, fFail, logger, suite, adminAddr, adminToken, federation)
+	log.Errorln("TERMINATING HOST")
+	os.Exit(status)
 }
@@ -2,6 +2,8 @@ package timestamper
 
 import (
 	"fmt"
+	"io/ioutil"
+	"strings"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
@@ -9,8 +11,9 @@ import (
 	"github.com/dedis/crypto/abstract"
 	"github.com/dedis/crypto/edwards/ed25519"
 	"github.com/dedis/crypto/nist"
-	"github.com/dedis/prifi/coco"
+	"github.com/dedis/prifi/coco/admin"
 	"github.com/dedis/prifi/coco/sign"
+	"github.com/dedis/prifi/coco/stamp"
 	"github.com/dedis/prifi/coco/test/logutils"
 	"github.com/dedis/prifi/coco/test/oldconfig"
 )
@@ -30,11 +33,11 @@ func GetSuite(suite string) abstract.Suite {
 	return s
 }
 
-func Run(hostname, cfg, app string, rounds int, rootwait int, debug, testConnect bool, failureRate, rFail, fFail int, logger, suite string) {
-	if debug {
-		coco.DEBUG = true
-	}
-
+// Run the host and return its exit status, sign.ExitOK after a voted shutdown.
+// An operator endpoint is served at adminAddr if set, with the token read
+// from the file adminToken. Rounds signed as root are attested at the
+// peer groups of the federation file if set.
+func Run(hostname, cfg, app string, rounds int, rootwait int, debug, testConnect bool, failureRate, rFail, fFail int, logger, suite, adminAddr, adminToken, federation string) int {
 	// fmt.Println("EXEC TIMESTAMPER: " + hostname)
 	if hostname == "" {
 		fmt.Println("hostname is empty")
@@ -46,7 +49,7 @@ func Run(hostname, cfg, app string, rounds int, rootwait int, debug, testConnect
 	var hc *oldconfig.HostConfig
 	var err error
 	s := GetSuite(suite)
-	opts := oldconfig.ConfigOptions{ConnType: "tcp", Host: hostname, Suite: s}
+	opts := oldconfig.ConfigOptions{ConnType: "tcp", Host: hostname, Suite: s, Debug: debug}
 	if failureRate > 0 || fFail > 0 {
 		opts.Faulty = true
 	}
@@ -83,10 +86,28 @@ func Run(hostname, cfg, app string, rounds int, rootwait int, debug, testConnect
 		log.Fatal(err)
 	}
 
-	defer func(sn *sign.Node) {
-		log.Panicln("program has terminated:", hostname)
+	sn := hc.SNodes[0]
+	defer func() {
+		log.Errorln("program has terminated:", hostname, "with status", sn.ExitStatus())
 		sn.Close()
-	}(hc.SNodes[0])
+	}()
+
+	if adminAddr != "" {
+		token := ""
+		if adminToken != "" {
+			b, err := ioutil.ReadFile(adminToken)
+			if err != nil {
+				log.Fatal("unable to read operator token:", err)
+			}
+			token = strings.TrimSpace(string(b))
+		}
+		as := admin.NewServer(sn, token)
+		as.TestMode = opts.Faulty
+		if err := as.Listen(adminAddr); err != nil {
+			log.Fatal("unable to serve operator endpoint:", err)
+		}
+		defer as.Close()
+	}
 
 	if app == "sign" {
 		//log.Println("RUNNING Node")
@@ -134,6 +155,13 @@ func Run(hostname, cfg, app string, rounds int, rootwait int, debug, testConnect
 				s.Logger = logger
 				s.Hostname = hostname
 				s.App = app
+				if federation != "" {
+					fc, err := stamp.LoadFederationConfig(s.Suite(), federation)
+					if err != nil {
+						log.Fatal("unable to load federation:", err)
+					}
+					s.Federate(fc)
+				}
 				if s.IsRoot(0) {
 					log.Println("RUNNING ROOT SERVER AT:", hostname, rounds)
 					log.Printf("Waiting: %d s\n", rootwait)
@@ -156,5 +184,5 @@ func Run(hostname, cfg, app string, rounds int, rootwait int, debug, testConnect
 			}
 		}
 	}
-
+	return sn.ExitStatus()
 }
@@ -26,6 +26,9 @@ var rounds int
 var amroot bool
 var testConnect bool
 var suite string
+var adminAddr string
+var adminToken string
+var federation string
 
 // TODO: add debug flag for more debugging information (memprofilerate...)
 func init() {
@@ -44,6 +47,9 @@ func init() {
 	flag.BoolVar(&amroot, "amroot", false, "am I root")
 	flag.BoolVar(&testConnect, "test_connect", false, "test connecting and disconnecting")
 	flag.StringVar(&suite, "suite", "nist256", "abstract suite to use [nist256, nist512, ed25519]")
+	flag.StringVar(&adminAddr, "admin", "", "address of the operator endpoint [host:port|unix:/path], disabled if empty")
+	flag.StringVar(&adminToken, "admintoken", "", "file holding the operator token")
+	flag.StringVar(&federation, "federation", "", "json file of the peer groups to attest our rounds at, disabled if empty")
 }
 
 func main() {
@@ -82,6 +88,9 @@ func main() {
 		"-amroot=" + strconv.FormatBool(amroot),
 		"-test_connect=" + strconv.FormatBool(testConnect),
 		"-suite=" + suite,
+		"-admin=" + adminAddr,
+		"-admintoken=" + adminToken,
+		"-federation=" + federation,
 	}
 	cmd := exec.Command("./exec", args...)
 	cmd.Stdout = log.StandardLogger().Writer()
@@ -34,9 +34,15 @@ conn: indicates what protocol should be used
 	"tcp": uses TcpConn for communications
 	"goroutine": uses GoConn for communications [default]
 
+sign: optional signing node configuration shared by all hosts
+	durations are given as strings, ex: "1s", "1500ms"
+	omitted fields take their default values
+
 ex.json
 {
 	conn: "tcp"
+	sign: {type: "merkle", round_time: "1s", heartbeat: "1500ms",
+		   gossip_time: "3s", timeout: "5s", rounds_per_view: 100}
 	hosts: ["host1", "host2", "host3"],
 	tree: {name: host1,
 		   children: [
@@ -48,9 +54,10 @@ ex.json
 */
 
 type ConfigFile struct {
-	Conn  string   `json:"conn,omitempty"`
-	Hosts []string `json:"hosts"`
-	Tree  *Node    `json:"tree"`
+	Conn  string       `json:"conn,omitempty"`
+	Sign  *sign.Config `json:"sign,omitempty"`
+	Hosts []string     `json:"hosts"`
+	Tree  *Node        `json:"tree"`
 }
 
 type JSONPoint json.RawMessage
@@ -64,9 +71,10 @@ type Node struct {
 
 // HostConfig stores all of the relevant information of the configuration file.
 type HostConfig struct {
-	SNodes []*sign.Node          // an array of signing nodes
-	Hosts  map[string]*sign.Node // maps hostname to host
-	Dir    *coconet.GoDirectory  // the directory mapping hostnames to goPeers
+	SNodes []*sign.Node              // an array of signing nodes
+	Hosts  map[string]*sign.Node     // maps hostname to host
+	Dir    *coconet.GoDirectory      // the directory mapping hostnames to goPeers
+	Keys   map[string]abstract.Point // public keys of all hosts of the tree
 }
 
 func (hc *HostConfig) Verify() error {
@@ -158,7 +166,7 @@ func writeHC(b *bytes.Buffer, hc *HostConfig, p *sign.Node) error {
 // NewHostConfig creates a new host configuration that can be populated with
 // hosts.
 func NewHostConfig() *HostConfig {
-	return &HostConfig{SNodes: make([]*sign.Node, 0), Hosts: make(map[string]*sign.Node), Dir: coconet.NewGoDirectory()}
+	return &HostConfig{SNodes: make([]*sign.Node, 0), Hosts: make(map[string]*sign.Node), Dir: coconet.NewGoDirectory(), Keys: make(map[string]abstract.Point)}
 }
 
 type ConnType int
@@ -242,13 +250,19 @@ func ConstructTree(
 	if generate {
 		if prikey != nil {
 			// if we have been given a private key load that
-			aux := sign.NewKeyedNode(h, suite, prikey)
+			aux, err := sign.NewKeyedNode(h, suite, prikey, opts.Config)
+			if err != nil {
+				return 0, err
+			}
 			aux.GenSetPool()
 			hc.SNodes = append(hc.SNodes, aux)
 			h.SetPubKey(pubkey)
 		} else {
 			// otherwise generate a random new one
-			sn := sign.NewNode(h, suite, rand)
+			sn, err := sign.NewNode(h, suite, rand, opts.Config)
+			if err != nil {
+				return 0, err
+			}
 			sn.GenSetPool()
 			hc.SNodes = append(hc.SNodes, sn)
 			h.SetPubKey(sn.PubKey)
@@ -262,6 +276,9 @@ func ConstructTree(
 		// log.Println("pubkey:", sn.PubKey)
 		// log.Println("given: ", pubkey)
 	}
+	if pubkey != nil {
+		hc.Keys[name] = pubkey
+	}
 	// if the parent of this call is empty then this must be the root node
 	if parent != "" && generate {
 		h.AddParent(0, parent)
@@ -345,6 +362,8 @@ type ConfigOptions struct {
 	Port      string         // if specified rewrites all ports to be this
 	Faulty    bool           // if true, use FaultyHost wrapper around Hosts
 	Suite     abstract.Suite // suite to use for Hosts
+	Config    *sign.Config   // if not nil replaces the sign config of the file
+	Debug     bool           // if true, verify all paths and signatures, see sign.Config
 }
 
 // TODO: if in tcp mode associate each hostname in the file with a different
@@ -362,6 +381,24 @@ func LoadJSON(file []byte, optsSlice ...ConfigOptions) (*HostConfig, error) {
 	if err != nil {
 		return hc, err
 	}
+	// options override file
+	if opts.Config == nil {
+		opts.Config = cf.Sign
+	}
+	if opts.Debug {
+		if opts.Config == nil {
+			opts.Config = sign.DefaultConfig()
+		}
+		opts.Config = opts.Config.Copy()
+		opts.Config.Debug = true
+	}
+	if opts.Config != nil {
+		opts.Config.SetDefaults()
+		if err := opts.Config.Validate(); err != nil {
+			return hc, err
+		}
+	}
+
 	connT := GoC
 	if cf.Conn == "tcp" {
 		connT = TcpC
@@ -463,6 +500,12 @@ func LoadJSON(file []byte, optsSlice ...ConfigOptions) (*HostConfig, error) {
 		// set host list on view 0
 		log.Println("in config hostlist", sn.HostList)
 		sn.SetHostList(0, sn.HostList)
+		// every node knows the keys of the whole group, not only of its peers
+		for h, k := range hc.Keys {
+			if h != sn.Name() {
+				sn.AddPeerKey(h, k)
+			}
+		}
 	}
 
 	return hc, err
@@ -523,6 +566,14 @@ func (hc *HostConfig) Run(stamper bool, signType sign.Type, hostnameSlice ...str
 		for _, sn := range hostnames {
 			go sn.Listen()
 		}
+		// threshold groups set up their key before signing
+		if signType == sign.Threshold {
+			for _, sn := range hostnames {
+				if sn.IsRoot(0) {
+					return sn.StartKeyGeneration()
+				}
+			}
+		}
 	}
 	return nil
 }
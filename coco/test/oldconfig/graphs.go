@@ -51,15 +51,18 @@ func dijkstra(m map[string]*sign.Node, root *sign.Node) {
 	}
 }
 
-func loadHost(hostname string, m map[string]*sign.Node, testSuite abstract.Suite, testRand cipher.Stream, hc *HostConfig) *sign.Node {
+func loadHost(hostname string, m map[string]*sign.Node, testSuite abstract.Suite, testRand cipher.Stream, hc *HostConfig) (*sign.Node, error) {
 	if h, ok := m[hostname]; ok {
-		return h
+		return h, nil
 	}
 	host := coconet.NewGoHost(hostname, coconet.NewGoDirectory())
-	h := sign.NewNode(host, testSuite, testRand)
+	h, err := sign.NewNode(host, testSuite, testRand, nil)
+	if err != nil {
+		return nil, err
+	}
 	hc.Hosts[hostname] = h
 	m[hostname] = h
-	return h
+	return h, nil
 }
 
 // loadGraph reads in an edge list data file of the form.
@@ -86,8 +89,14 @@ func loadGraph(name string, testSuite abstract.Suite, testRand cipher.Stream) (*
 		if n != 2 {
 			return nil, errors.New("improperly formatted file")
 		}
-		h1 := loadHost(host1, hosts, testSuite, testRand, hc)
-		h2 := loadHost(host2, hosts, testSuite, testRand, hc)
+		h1, err := loadHost(host1, hosts, testSuite, testRand, hc)
+		if err != nil {
+			return nil, err
+		}
+		h2, err := loadHost(host2, hosts, testSuite, testRand, hc)
+		if err != nil {
+			return nil, err
+		}
 		h1.AddPeer(h2.Name(), h2.PubKey)
 		h2.AddPeer(h1.Name(), h1.PubKey)
 		if root == nil {
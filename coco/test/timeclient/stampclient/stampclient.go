@@ -60,7 +60,12 @@ func streamMessgs(c *stamp.Client, servers []string, rate int) {
 	// buck[i] = # of timestamp responses received in second i
 	buck := make([]int64, MAX_N_SECONDS)
 	// roundsAfter[i] = # of timestamp requests that were processed i rounds late
-	roundsAfter := make([]int64, MAX_N_ROUNDS)
+	// rounds may be shorter than a second, but not empty
+	roundTime := c.RoundTime
+	if roundTime <= 0 {
+		roundTime = time.Second
+	}
+	roundsAfter := make([]int64, int(time.Duration(MAX_N_SECONDS)*time.Second/roundTime)+1)
 	times := make([]int64, MAX_N_SECONDS*1000) // maximum number of milliseconds (maximum rate > 1 per millisecond)
 	ticker := time.Tick(time.Duration(rate) * time.Millisecond)
 	msg := genRandomMessages(1)[0]
@@ -98,12 +103,14 @@ retry:
 				return
 			}
 
-			// TODO: we might want to subtract a buffer from secToTimeStamp
+			// TODO: we might want to subtract a buffer from t
 			// to account for computation time
-			secToTimeStamp := t.Seconds()
 			secSinceFirst := time.Since(tFirst).Seconds()
 			atomic.AddInt64(&buck[int(secSinceFirst)], 1)
-			index := int(secToTimeStamp) / int(stamp.ROUND_TIME/time.Second)
+			index := int(t / roundTime)
+			if index >= len(roundsAfter) {
+				index = len(roundsAfter) - 1
+			}
 			atomic.AddInt64(&roundsAfter[index], 1)
 			atomic.AddInt64(&times[tick], t.Nanoseconds())
 
@@ -115,10 +122,10 @@ retry:
 }
 
 var MAX_N_SECONDS int = 1 * 60 * 60 // 1 hours' worth of seconds
-var MAX_N_ROUNDS int = MAX_N_SECONDS / int(stamp.ROUND_TIME/time.Second)
 
 func Run(server string, nmsgs int, name string, rate int, debug bool) {
 	c := stamp.NewClient(name)
+	c.Debug = debug
 	msgs := genRandomMessages(nmsgs + 20)
 	servers := strings.Split(server, ",")
 
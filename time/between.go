@@ -0,0 +1,97 @@
+package time
+
+import (
+	"errors"
+
+	"github.com/dedis/crypto/abstract"
+)
+
+// Proof of betweenness
+//
+// A value was committed between log entries A and B if it was chosen
+// after A and stamped before B: the client builds its value as the root
+// of a Merkle tree with the root of A among its leaves, and the stamp of
+// the value in an entry S, chained up to B, shows it existed before B.
+// Only the server can chain S to B, so the proof is built from its
+// retained history: A, S and B must all still be retained.
+
+var ErrNotBetween error = errors.New("value not committed between the two entries")
+
+// Proof that a value was committed between entries After and Before
+type BetweennessProof struct {
+	After    SignedEntry // entry A the value was chosen after
+	Before   SignedEntry // entry B the value was stamped before
+	AfterPrf Proof       // path from the root of A to the value
+	Prf      Proof       // path from the value to the root of B
+}
+
+// Request a proof that Val, built from the root of entry After as shown
+// by AfterPrf and stamped in entry Stamp, was committed before entry Before
+type BetweennessRequest struct {
+	After, Stamp, Before uint64
+	Val                  []byte
+	AfterPrf             Proof // path from the root of After to Val
+	StampPrf             Proof // path from Val to the root of Stamp, from its StampReply
+}
+type BetweennessReply struct {
+	Prf BetweennessProof
+}
+
+// Build the proof that val was committed between entries after and
+// before, from the paths the client holds: afterPrf from the root of
+// entry after to val, and stampPrf from val to the root of entry stamp
+func (s *Server) Betweenness(after, stamp, before uint64, val []byte,
+	afterPrf, stampPrf Proof) (*BetweennessProof, error) {
+	if after >= stamp || stamp > before {
+		return nil, ErrNotBetween
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, err := s.index(after)
+	if err != nil {
+		return nil, err
+	}
+	st, err := s.index(stamp)
+	if err != nil {
+		return nil, err
+	}
+	b, err := s.index(before)
+	if err != nil {
+		return nil, err
+	}
+	if !afterPrf.Check(s.suite.Hash, val, s.roots[a]) ||
+		!stampPrf.Check(s.suite.Hash, s.roots[st], val) {
+		return nil, ErrNotBetween
+	}
+
+	chain, err := s.chain(stamp, before)
+	if err != nil {
+		return nil, err
+	}
+	// the stamp path is followed first, see Proof.Calc
+	prf := append(chain, stampPrf...)
+	return &BetweennessProof{
+		After:    s.entries[a],
+		Before:   s.entries[b],
+		AfterPrf: afterPrf,
+		Prf:      prf}, nil
+}
+
+// Check that val was committed between the two entries of bp, both
+// signed by the server with public key pub, returning them
+func (bp *BetweennessProof) Verify(suite abstract.Suite, pub abstract.Point,
+	val []byte) (after, before *LogEntry, err error) {
+	if after, err = bp.After.Verify(suite, pub); err != nil {
+		return nil, nil, err
+	}
+	if before, err = bp.Before.Verify(suite, pub); err != nil {
+		return nil, nil, err
+	}
+	if after.Seq >= before.Seq ||
+		!bp.AfterPrf.Check(suite.Hash, val, after.Root) ||
+		!bp.Prf.Check(suite.Hash, before.Root, val) {
+		return nil, nil, ErrNotBetween
+	}
+	return after, before, nil
+}
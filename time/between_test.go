@@ -0,0 +1,61 @@
+package time
+
+import (
+	"testing"
+)
+
+func TestBetweenness(t *testing.T) {
+	s, suite, public, ask := startServer(t)
+	defer s.Close()
+	stamp := func(reqno uint64, val []byte) (*LogEntry, Proof) {
+		reply := ask(&Message{ReqNo: reqno, StampRequest: &StampRequest{Val: val}})
+		se := SignedEntry{Ent: reply.StampReply.Ent, Sig: reply.StampReply.Sig}
+		e, err := se.Verify(suite, public)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return e, reply.StampReply.Prf
+	}
+
+	a, _ := stamp(1, make([]byte, suite.Hash().Size()))
+
+	// a value chosen after entry a: a tree holding its root
+	doc := []byte("document hash, chosen after a...")
+	val, prfs := ProofTree(suite.Hash, []HashId{a.Root, doc})
+	st, stampPrf := stamp(2, val)
+	b, _ := stamp(3, doc)
+
+	reply := ask(&Message{ReqNo: 4, BetweennessRequest: &BetweennessRequest{
+		After: a.Seq, Stamp: st.Seq, Before: b.Seq, Val: val,
+		AfterPrf: prfs[0], StampPrf: stampPrf}})
+	if reply.BetweennessReply == nil {
+		t.Fatal("no betweenness proof:", reply.ErrorReply)
+	}
+	bp := reply.BetweennessReply.Prf
+	after, before, err := bp.Verify(suite, public, val)
+	if err != nil {
+		t.Fatal("betweenness proof rejected:", err)
+	}
+	if after.Seq != a.Seq || before.Seq != b.Seq {
+		t.Fatal("proof between", after.Seq, "and", before.Seq)
+	}
+	if _, _, err := bp.Verify(suite, public, doc); err == nil {
+		t.Fatal("proof accepted for another value")
+	}
+	swapped := BetweennessProof{After: bp.Before, Before: bp.After, AfterPrf: bp.AfterPrf, Prf: bp.Prf}
+	if _, _, err := swapped.Verify(suite, public, val); err == nil {
+		t.Fatal("proof accepted with the entries swapped")
+	}
+
+	// the server refuses values it cannot place between the entries
+	if _, err := s.Betweenness(a.Seq, st.Seq, b.Seq, doc, prfs[0], stampPrf); err != ErrNotBetween {
+		t.Fatal("proof built for a value not stamped:", err)
+	}
+	s.mu.Lock()
+	s.base = 2 // entry a no longer retained
+	s.entries, s.roots, s.links = s.entries[1:], s.roots[1:], s.links[1:]
+	s.mu.Unlock()
+	if _, err := s.Betweenness(a.Seq, st.Seq, b.Seq, val, prfs[0], stampPrf); err != ErrOutsideRetention {
+		t.Fatal("proof built from an entry outside the retention window:", err)
+	}
+}
@@ -2,6 +2,8 @@ package time
 
 import (
 	"errors"
+
+	"github.com/dedis/prifi/coco/hashid"
 )
 
 
@@ -47,4 +49,12 @@ func (m HashMap) Get(id HashId) ([]byte,error) {
 	return blob,nil
 }
 
+// HashGet looking blobs up in a coco HashGet, such as a hashid.PeerGet
+// fetching them from another node
+type RemoteGet struct {
+	Src hashid.HashGet
+}
 
+func (g RemoteGet) Get(id HashId) ([]byte, error) {
+	return g.Src.Get(hashid.HashId(id))
+}
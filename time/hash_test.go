@@ -0,0 +1,25 @@
+package time
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/dedis/prifi/coco/hashid"
+)
+
+// Blobs are looked up through a coco HashGet
+func TestRemoteGet(t *testing.T) {
+	m := hashid.HashMap{}
+	blob := []byte("blob")
+	id := sha256.Sum256(blob)
+	m.Put(id[:], blob)
+
+	g := RemoteGet{Src: m}
+	data, err := g.Get(HashId(id[:]))
+	if err != nil || string(data) != "blob" {
+		t.Fatal("blob not found through RemoteGet:", err)
+	}
+	if _, err := g.Get(HashId(blob)); err == nil {
+		t.Fatal("found a blob not stored")
+	}
+}
@@ -25,7 +25,9 @@ func TestPath(t *testing.T) {
 	println("root:", hex.EncodeToString(root))
 	for i := range proofs {
 		println("leaf", i, hex.EncodeToString(leaves[i]))
-		proofs[i].Check(newHash, root, leaves[i])
+		if !proofs[i].Check(newHash, root, leaves[i]) {
+			t.Fatal("proof of leaf", i, "does not check")
+		}
 		for j := range proofs[i] {
 			println("  ", j, hex.EncodeToString(proofs[i][j]))
 		}
@@ -71,13 +71,15 @@ func ProofTree(newHash func() hash.Hash, leaves []HashId) (HashId, []Proof) {
 	for d := depth - 1; d >= 0; d-- {
 		nnext := (nprev + 1) >> 1 // # hashes total at level i
 		nnode := nprev >> 1       // # new nodes at level i
-		println("nprev", nprev, "nnext", nnext, "nnode", nnode)
 		tree[d] = make([]HashId, nnext)
 		tnext := tree[d]
 		for i := 0; i < nnode; i++ {
 			tnext[i] = c.hashNode(nil, tprev[i*2], tprev[i*2+1])
 		}
-		// If nnode < nhash, just leave the odd one nil.
+		// If nnode < nnext, the odd one moves up unchanged.
+		if nnode < nnext {
+			tnext[nnode] = tprev[nprev-1]
+		}
 		nprev = nnext
 		tprev = tnext
 	}
@@ -86,15 +88,16 @@ func ProofTree(newHash func() hash.Hash, leaves []HashId) (HashId, []Proof) {
 	}
 	root := tprev[0]
 
-	// Build all the individual proofs from the tree.
+	// Build all the individual proofs from the tree:
+	// the sibling at each level, topmost first.
 	// Some towards the end may end up being shorter than depth.
 	proofs := make([]Proof, nleaves)
 	for i := 0; i < nleaves; i++ {
 		p := make([]HashId, depth)[:0]
-		for d := 0; d < depth; d++ {
-			h := tree[d][i>>uint(depth-d)]
-			if h != nil {
-				p = append(p, h)
+		for d := 1; d <= depth; d++ {
+			sib := (i >> uint(depth-d)) ^ 1
+			if sib < len(tree[d]) {
+				p = append(p, tree[d][sib])
 			}
 		}
 		proofs[i] = Proof(p)
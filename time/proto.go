@@ -1,6 +1,13 @@
 package time
 
-//"time"
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+
+	"github.com/dedis/crypto/abstract"
+	"github.com/dedis/crypto/anon"
+)
 
 type LogEntry struct {
 	Seq  uint64 // Consecutively-incrementing log entry sequence number
@@ -8,16 +15,65 @@ type LogEntry struct {
 	Time *int64 // Optional wall-clock time this entry was created
 }
 
+// Encode the entry: Seq, a flag and Time if set, then Root
+func (e *LogEntry) MarshalBinary() ([]byte, error) {
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, e.Seq)
+	if e.Time != nil {
+		b.WriteByte(1)
+		binary.Write(&b, binary.BigEndian, *e.Time)
+	} else {
+		b.WriteByte(0)
+	}
+	b.Write(e.Root)
+	return b.Bytes(), nil
+}
+
+func (e *LogEntry) UnmarshalBinary(data []byte) error {
+	b := bytes.NewBuffer(data)
+	if err := binary.Read(b, binary.BigEndian, &e.Seq); err != nil {
+		return err
+	}
+	flag, err := b.ReadByte()
+	if err != nil {
+		return err
+	}
+	e.Time = nil
+	if flag != 0 {
+		var t int64
+		if err := binary.Read(b, binary.BigEndian, &t); err != nil {
+			return err
+		}
+		e.Time = &t
+	}
+	e.Root = HashId(b.Bytes())
+	return nil
+}
+
 type SignedEntry struct {
 	Ent []byte // Encoded LogEntry to which the signature applies
 	Sig []byte // Digital signature on the LogEntry
 }
 
+// Check the signature of the server with public key pub on se,
+// returning the decoded entry
+func (se *SignedEntry) Verify(suite abstract.Suite, pub abstract.Point) (*LogEntry, error) {
+	if _, err := anon.Verify(suite, se.Ent, anon.Set{pub}, nil, se.Sig); err != nil {
+		return nil, err
+	}
+	e := &LogEntry{}
+	if err := e.UnmarshalBinary(se.Ent); err != nil {
+		return nil, errors.New("malformed log entry")
+	}
+	return e, nil
+}
+
 type StampRequest struct {
 	Val []byte // Hash-size value to timestamp
 }
 type StampReply struct {
-	Sig []byte // Signature on the root
+	Ent []byte // Encoded LogEntry holding the root
+	Sig []byte // Signature on the LogEntry
 	Prf Proof  // Merkle proof of value
 }
 
@@ -51,8 +107,17 @@ type BlockReply struct {
 	Dat [][]byte // Content of block(s) requested
 }
 
+// Request the checkpoint summarizing the pruned entry Seq
+type CheckpointRequest struct {
+	Seq uint64 // Sequence number of a pruned entry
+}
+type CheckpointReply struct {
+	Chk SignedCheckpoint // Signed checkpoint, see retention.go
+}
+
 type ErrorReply struct {
-	Msg string // Human-readable error message
+	Msg    string // Human-readable error message
+	Oldest uint64 // Oldest retained entry, if beyond the retention window
 }
 
 type Message struct {
@@ -68,6 +133,12 @@ type Message struct {
 	ProofRequest *ProofRequest
 	ProofReply   *ProofReply
 
+	BetweennessRequest *BetweennessRequest
+	BetweennessReply   *BetweennessReply
+
+	CheckpointRequest *CheckpointRequest
+	CheckpointReply   *CheckpointReply
+
 	//BlockRequest *BlockRequest
 	//BlockReply *BlockReply
 }
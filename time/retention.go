@@ -0,0 +1,264 @@
+package time
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/dedis/crypto/abstract"
+	"github.com/dedis/crypto/anon"
+	"github.com/dedis/crypto/random"
+)
+
+// Log retention
+//
+// The server keeps its entries, and the paths chaining them, within a
+// retention window bounded by entry count, age or size, and a background
+// pruner drops the older ones. Every pruned range is summarized by a
+// signed checkpoint holding the root of its last entry and the path to
+// that root from the root of the checkpoint before, through the trees of
+// the pruned entries. The checkpoints thus chain to one another and to
+// the retained entries, so clients that tracked the log up to any
+// checkpoint can still chain their proofs forward, and proofs starting
+// from a checkpoint verify against its signature.
+// Requests for entries before the window get an ErrorReply naming the
+// oldest retained entry.
+
+var ErrNoCheckpoint error = errors.New("no checkpoint covers this entry")
+
+// Bounds of the retention window, 0 for no bound.
+// The newest entry is always kept.
+type Retention struct {
+	Entries int           // entries kept
+	Age     time.Duration // age of the oldest entry kept
+	Bytes   int           // size of the entries and paths kept
+	Every   time.Duration // time between pruning runs, a minute if 0
+}
+
+func (r *Retention) enabled() bool {
+	return r.Entries != 0 || r.Age != 0 || r.Bytes != 0
+}
+
+// Summary of the pruned entries First to Last
+type Checkpoint struct {
+	First, Last uint64
+	Root        HashId // Merkle root of entry Last
+	Link        Proof  // path from the root of entry First-1 to Root
+}
+
+var checkpointTag = []byte("checkpoint")
+
+// Encode the checkpoint: a tag telling it from a LogEntry, First, Last,
+// then Root and each hash of Link, all length prefixed
+func (c *Checkpoint) MarshalBinary() ([]byte, error) {
+	var b bytes.Buffer
+	b.Write(checkpointTag)
+	binary.Write(&b, binary.BigEndian, c.First)
+	binary.Write(&b, binary.BigEndian, c.Last)
+	writeHash(&b, c.Root)
+	binary.Write(&b, binary.BigEndian, uint32(len(c.Link)))
+	for _, h := range c.Link {
+		writeHash(&b, h)
+	}
+	return b.Bytes(), nil
+}
+
+func writeHash(b *bytes.Buffer, h HashId) {
+	binary.Write(b, binary.BigEndian, uint32(len(h)))
+	b.Write(h)
+}
+
+func readHash(b *bytes.Buffer) (HashId, error) {
+	var n uint32
+	if err := binary.Read(b, binary.BigEndian, &n); err != nil {
+		return nil, err
+	}
+	if int(n) > b.Len() {
+		return nil, errors.New("malformed checkpoint")
+	}
+	return HashId(b.Next(int(n))), nil
+}
+
+func (c *Checkpoint) UnmarshalBinary(data []byte) error {
+	if !bytes.HasPrefix(data, checkpointTag) {
+		return errors.New("malformed checkpoint")
+	}
+	b := bytes.NewBuffer(data[len(checkpointTag):])
+	if err := binary.Read(b, binary.BigEndian, &c.First); err != nil {
+		return err
+	}
+	if err := binary.Read(b, binary.BigEndian, &c.Last); err != nil {
+		return err
+	}
+	root, err := readHash(b)
+	if err != nil {
+		return err
+	}
+	var n uint32
+	if err := binary.Read(b, binary.BigEndian, &n); err != nil {
+		return err
+	}
+	if int(n) > b.Len() {
+		return errors.New("malformed checkpoint")
+	}
+	link := make(Proof, n)
+	for i := range link {
+		if link[i], err = readHash(b); err != nil {
+			return err
+		}
+	}
+	c.Root, c.Link = root, link
+	return nil
+}
+
+type SignedCheckpoint struct {
+	Chk []byte // Encoded Checkpoint to which the signature applies
+	Sig []byte // Digital signature on the Checkpoint
+}
+
+// Check the signature of the server with public key pub on sc,
+// returning the decoded checkpoint
+func (sc *SignedCheckpoint) Verify(suite abstract.Suite, pub abstract.Point) (*Checkpoint, error) {
+	if _, err := anon.Verify(suite, sc.Chk, anon.Set{pub}, nil, sc.Sig); err != nil {
+		return nil, err
+	}
+	c := &Checkpoint{}
+	if err := c.UnmarshalBinary(sc.Chk); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Size of entry i and the path to it, s.mu held
+func (s *Server) entrySize(i int) int {
+	n := len(s.entries[i].Ent) + len(s.entries[i].Sig) + len(s.roots[i])
+	for _, h := range s.links[i] {
+		n += len(h)
+	}
+	return n
+}
+
+// Whether the oldest n+1 entries are outside the window, s.mu held
+func (s *Server) expired(n int, now time.Time) bool {
+	r := &s.Retention
+	return r.Entries != 0 && len(s.entries)-n > r.Entries ||
+		r.Age != 0 && now.Sub(time.Unix(s.times[n], 0)) > r.Age ||
+		r.Bytes != 0 && s.size > r.Bytes
+}
+
+// Drop the entries outside the retention window and sign a checkpoint
+// summarizing them
+func (s *Server) prune(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for n < len(s.entries)-1 && s.expired(n, now) {
+		s.size -= s.entrySize(n)
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+
+	// the path of the newest tree goes first, see Proof.Calc
+	link := Proof{}
+	for j := n - 1; j >= 0; j-- {
+		link = append(link, s.links[j]...)
+	}
+	c := &Checkpoint{First: s.base, Last: s.base + uint64(n) - 1, Root: s.roots[n-1],
+		Link: link}
+	chk, err := c.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	sig := anon.Sign(s.suite, random.Stream, chk, anon.Set{s.public}, nil, 0, s.secret)
+	s.checkpoints = append(s.checkpoints, SignedCheckpoint{Chk: chk, Sig: sig})
+
+	// the path from the checkpoint root to entry Last+1 stays at links[0]
+	s.entries = append([]SignedEntry(nil), s.entries[n:]...)
+	s.roots = append([]HashId(nil), s.roots[n:]...)
+	s.links = append([]Proof(nil), s.links[n:]...)
+	s.times = append([]int64(nil), s.times[n:]...)
+	s.base += uint64(n)
+	log.Println("pruned log entries", c.First, "to", c.Last)
+	return nil
+}
+
+func (s *Server) pruner() {
+	every := s.Retention.Every
+	if every == 0 {
+		every = time.Minute
+	}
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.closed:
+			return
+		case now := <-ticker.C:
+			if err := s.prune(now); err != nil {
+				log.Errorln("unable to prune log:", err)
+			}
+		}
+	}
+}
+
+// Position of entry seq: its index i among the retained entries and the
+// index k of the newest checkpoint, or i = -1 and the index k of the
+// checkpoint whose root is that of seq, s.mu held
+func (s *Server) position(seq uint64) (i, k int, err error) {
+	i, err = s.index(seq)
+	if err != ErrOutsideRetention {
+		return i, len(s.checkpoints) - 1, err
+	}
+	for k := range s.checkpoints {
+		c := &Checkpoint{}
+		if err := c.UnmarshalBinary(s.checkpoints[k].Chk); err != nil {
+			return 0, 0, err
+		}
+		if c.Last == seq {
+			return -1, k, nil
+		}
+	}
+	return 0, 0, ErrOutsideRetention
+}
+
+// Path of the checkpoint k, s.mu held
+func (s *Server) checkpointLink(k int) (Proof, error) {
+	c := &Checkpoint{}
+	if err := c.UnmarshalBinary(s.checkpoints[k].Chk); err != nil {
+		return nil, err
+	}
+	return c.Link, nil
+}
+
+// Checkpoint covering the pruned entry seq
+func (s *Server) checkpoint(seq uint64) (*SignedCheckpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.checkpoints {
+		c := &Checkpoint{}
+		if err := c.UnmarshalBinary(s.checkpoints[i].Chk); err != nil {
+			return nil, err
+		}
+		if c.First <= seq && seq <= c.Last {
+			return &s.checkpoints[i], nil
+		}
+	}
+	return nil, ErrNoCheckpoint
+}
+
+// Error reply to a request, naming the oldest retained entry if the
+// request was beyond the retention window
+func (s *Server) errorReply(err error) *ErrorReply {
+	er := &ErrorReply{Msg: err.Error()}
+	if err == ErrOutsideRetention {
+		s.mu.Lock()
+		er.Oldest = s.base
+		s.mu.Unlock()
+	}
+	return er
+}
@@ -0,0 +1,95 @@
+package time
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestRetention(t *testing.T) {
+	s, suite, public, ask := startServer(t)
+	defer s.Close()
+	s.Retention = Retention{Entries: 2}
+
+	var roots []HashId
+	stamp := func(i int) {
+		val := make([]byte, suite.Hash().Size())
+		val[0] = byte(i)
+		reply := ask(&Message{ReqNo: uint64(i), StampRequest: &StampRequest{Val: val}})
+		se := SignedEntry{Ent: reply.StampReply.Ent, Sig: reply.StampReply.Sig}
+		e, err := se.Verify(suite, public)
+		if err != nil {
+			t.Fatal(err)
+		}
+		roots = append(roots, e.Root)
+	}
+	for i := 1; i <= 4; i++ {
+		stamp(i)
+	}
+	if err := s.prune(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	reply := ask(&Message{ReqNo: 5, EntryRequest: &EntryRequest{Seq: 1}})
+	if reply.ErrorReply == nil || reply.ErrorReply.Oldest != 3 {
+		t.Fatal("pruned entry not reported beyond the retention window:", reply.ErrorReply)
+	}
+	if reply := ask(&Message{ReqNo: 6, EntryRequest: &EntryRequest{Seq: 3}}); reply.EntryReply == nil {
+		t.Fatal("retained entry not returned")
+	}
+
+	reply = ask(&Message{ReqNo: 7, CheckpointRequest: &CheckpointRequest{Seq: 1}})
+	if reply.CheckpointReply == nil {
+		t.Fatal("no checkpoint of the pruned entries")
+	}
+	c, err := reply.CheckpointReply.Chk.Verify(suite, public)
+	if err != nil {
+		t.Fatal("checkpoint not signed by the server:", err)
+	}
+	if c.First != 1 || c.Last != 2 || !bytes.Equal(c.Root, roots[1]) {
+		t.Fatal("checkpoint of entries", c.First, "to", c.Last, "with another root")
+	}
+
+	// proofs from the checkpoint to retained entries still verify
+	reply = ask(&Message{ReqNo: 8, ProofRequest: &ProofRequest{Old: c.Last, New: 4}})
+	if reply.ProofReply == nil {
+		t.Fatal("no proof from the checkpoint:", reply.ErrorReply)
+	}
+	if !reply.ProofReply.Prf.Check(suite.Hash, roots[3], c.Root) {
+		t.Fatal("proof from the checkpoint does not check")
+	}
+	if reply := ask(&Message{ReqNo: 9, ProofRequest: &ProofRequest{Old: 1, New: 4}}); reply.ErrorReply == nil {
+		t.Fatal("proof from a pruned entry returned")
+	}
+
+	// a second checkpoint, of entries 3 and 4, chains to the first
+	stamp(5)
+	stamp(6)
+	if err := s.prune(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	reply = ask(&Message{ReqNo: 10, CheckpointRequest: &CheckpointRequest{Seq: 3}})
+	if reply.CheckpointReply == nil {
+		t.Fatal("no checkpoint of the pruned entries")
+	}
+	c2, err := reply.CheckpointReply.Chk.Verify(suite, public)
+	if err != nil {
+		t.Fatal("checkpoint not signed by the server:", err)
+	}
+	if c2.First != 3 || c2.Last != 4 || !c2.Link.Check(suite.Hash, c2.Root, c.Root) {
+		t.Fatal("checkpoint of entries", c2.First, "to", c2.Last, "does not chain to the one before")
+	}
+	// proofs from either checkpoint to the later ones and retained entries
+	for _, pr := range []struct{ old, new uint64 }{{2, 4}, {2, 6}, {4, 6}, {2, 5}} {
+		reply := ask(&Message{ReqNo: 11, ProofRequest: &ProofRequest{Old: pr.old, New: pr.new}})
+		if reply.ProofReply == nil {
+			t.Fatal("no proof from entry", pr.old, "to", pr.new, ":", reply.ErrorReply)
+		}
+		if !reply.ProofReply.Prf.Check(suite.Hash, roots[pr.new-1], roots[pr.old-1]) {
+			t.Fatal("proof from entry", pr.old, "to", pr.new, "does not check")
+		}
+	}
+	if reply := ask(&Message{ReqNo: 12, ProofRequest: &ProofRequest{Old: 3, New: 6}}); reply.ErrorReply == nil {
+		t.Fatal("proof from a pruned entry returned")
+	}
+}
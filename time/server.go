@@ -0,0 +1,304 @@
+package time
+
+import (
+	"encoding/gob"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/dedis/crypto/abstract"
+	"github.com/dedis/crypto/anon"
+	"github.com/dedis/crypto/random"
+)
+
+// Single server timestamping
+//
+// The server batches the values stamped during an interval into a Merkle
+// tree and signs a LogEntry holding its root, then answers every request
+// of the interval with the signed entry and the path from the value to
+// the root. The root of the previous entry is the first leaf of every
+// tree, so the entries form a chain: the path from the root of entry Old
+// through the trees of the later entries up to the root of entry New
+// proves Old happened before New. Intervals without requests produce no
+// entry. Clients speak Message, gob encoded over TCP.
+
+var ErrUnknownEntry error = errors.New("no log entry with this sequence number")
+var ErrOutsideRetention error = errors.New("log entry older than the retention window")
+var ErrBadProofRequest error = errors.New("proof requested from a newer to an older entry")
+
+type Server struct {
+	suite    abstract.Suite
+	public   abstract.Point
+	secret   abstract.Secret
+	interval time.Duration
+
+	Retention Retention // set before Listen, see retention.go
+
+	mu          sync.Mutex
+	pending     []*request    // stamp requests of the current interval
+	base        uint64        // sequence number of the oldest retained entry
+	entries     []SignedEntry // entry of sequence number base+i at i
+	roots       []HashId      // Merkle roots of the entries
+	links       []Proof       // path from the previous root to the root of each entry
+	times       []int64       // times of the entries
+	size        int           // size of the retained entries and paths
+	checkpoints []SignedCheckpoint
+
+	ln     net.Listener
+	closed chan bool
+}
+
+// Stamp request waiting for the end of the interval
+type request struct {
+	val   HashId
+	reqno uint64
+	c     *conn
+}
+
+// Client connection, replies are written by the interval loop and
+// the connection's own loop
+type conn struct {
+	mu  sync.Mutex
+	enc *gob.Encoder
+}
+
+func (c *conn) put(m *Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.enc.Encode(m)
+}
+
+// New server signing entries with the key pair (public, secret) of suite
+// every interval
+func NewServer(suite abstract.Suite, public abstract.Point, secret abstract.Secret,
+	interval time.Duration) *Server {
+	return &Server{
+		suite:    suite,
+		public:   public,
+		secret:   secret,
+		interval: interval,
+		base:     1,
+		closed:   make(chan bool)}
+}
+
+// Listen for clients at addr and start signing entries
+func (s *Server) Listen(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	s.ln = ln
+	go s.run()
+	if s.Retention.enabled() {
+		go s.pruner()
+	}
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				select {
+				case <-s.closed:
+					return
+				default:
+				}
+				log.Errorln("failed to accept connection:", err)
+				continue
+			}
+			go s.serve(nc)
+		}
+	}()
+	return nil
+}
+
+// Address the server listens at
+func (s *Server) Addr() net.Addr {
+	return s.ln.Addr()
+}
+
+func (s *Server) Close() error {
+	close(s.closed)
+	return s.ln.Close()
+}
+
+// Newest sequence number, 0 before the first entry
+func (s *Server) Seq() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.base + uint64(len(s.entries)) - 1
+}
+
+// Index of the retained entry seq, s.mu held
+func (s *Server) index(seq uint64) (int, error) {
+	if seq == 0 || seq >= s.base+uint64(len(s.entries)) {
+		return 0, ErrUnknownEntry
+	}
+	if seq < s.base {
+		return 0, ErrOutsideRetention
+	}
+	return int(seq - s.base), nil
+}
+
+func (s *Server) run() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.closed:
+			return
+		case <-ticker.C:
+			if err := s.commit(); err != nil {
+				log.Errorln("unable to sign log entry:", err)
+			}
+		}
+	}
+}
+
+// Sign an entry for the requests of the interval and reply to them
+func (s *Server) commit() error {
+	s.mu.Lock()
+	reqs := s.pending
+	s.pending = nil
+	if len(reqs) == 0 {
+		s.mu.Unlock()
+		return nil
+	}
+
+	leaves := make([]HashId, 0, len(reqs)+1)
+	var prev HashId
+	if n := len(s.roots); n != 0 {
+		prev = s.roots[n-1]
+		leaves = append(leaves, prev)
+	}
+	for _, r := range reqs {
+		leaves = append(leaves, r.val)
+	}
+	root, proofs := ProofTree(s.suite.Hash, leaves)
+	link := Proof{}
+	if prev != nil {
+		link, proofs = proofs[0], proofs[1:]
+	}
+
+	now := time.Now().Unix()
+	e := &LogEntry{Seq: s.base + uint64(len(s.entries)), Root: root, Time: &now}
+	ent, err := e.MarshalBinary()
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	sig := anon.Sign(s.suite, random.Stream, ent, anon.Set{s.public}, nil, 0, s.secret)
+	s.entries = append(s.entries, SignedEntry{Ent: ent, Sig: sig})
+	s.roots = append(s.roots, root)
+	s.links = append(s.links, link)
+	s.times = append(s.times, now)
+	s.size += s.entrySize(len(s.entries) - 1)
+	s.mu.Unlock()
+
+	for i, r := range reqs {
+		err := r.c.put(&Message{
+			ReqNo:      r.reqno,
+			StampReply: &StampReply{Ent: ent, Sig: sig, Prf: proofs[i]}})
+		if err != nil {
+			log.Warnln("unable to reply to stamp request:", err)
+		}
+	}
+	return nil
+}
+
+// Path from the root of entry old to the root of entry new
+func (s *Server) proof(old, new uint64) (Proof, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.chain(old, new)
+}
+
+// Path from the root of entry old to the root of entry new, s.mu held
+func (s *Server) chain(old, new uint64) (Proof, error) {
+	if old > new {
+		return nil, ErrBadProofRequest
+	}
+	// the roots of the checkpoints still chain to the later entries
+	i, ki, err := s.position(old)
+	if err != nil {
+		return nil, err
+	}
+	j, kj, err := s.position(new)
+	if err != nil {
+		return nil, err
+	}
+	// the path of the newest tree goes first, see Proof.Calc
+	p := Proof{}
+	for ; j > i; j-- {
+		p = append(p, s.links[j]...)
+	}
+	for k := kj; k > ki; k-- {
+		link, err := s.checkpointLink(k)
+		if err != nil {
+			return nil, err
+		}
+		p = append(p, link...)
+	}
+	return p, nil
+}
+
+// Answer the requests of a client until it disconnects
+func (s *Server) serve(nc net.Conn) {
+	defer nc.Close()
+	c := &conn{enc: gob.NewEncoder(nc)}
+	dec := gob.NewDecoder(nc)
+	for {
+		m := &Message{}
+		if err := dec.Decode(m); err != nil {
+			return
+		}
+
+		reply := &Message{ReqNo: m.ReqNo}
+		switch {
+		case m.StampRequest != nil:
+			s.mu.Lock()
+			s.pending = append(s.pending,
+				&request{val: HashId(m.StampRequest.Val), reqno: m.ReqNo, c: c})
+			s.mu.Unlock()
+			continue
+		case m.EntryRequest != nil:
+			s.mu.Lock()
+			i, err := s.index(m.EntryRequest.Seq)
+			if err == nil {
+				reply.EntryReply = &EntryReply{Log: s.entries[i]}
+			}
+			s.mu.Unlock()
+			if err != nil {
+				reply.ErrorReply = s.errorReply(err)
+			}
+		case m.ProofRequest != nil:
+			p, err := s.proof(m.ProofRequest.Old, m.ProofRequest.New)
+			if err != nil {
+				reply.ErrorReply = s.errorReply(err)
+			} else {
+				reply.ProofReply = &ProofReply{Prf: p}
+			}
+		case m.BetweennessRequest != nil:
+			r := m.BetweennessRequest
+			bp, err := s.Betweenness(r.After, r.Stamp, r.Before, r.Val, r.AfterPrf, r.StampPrf)
+			if err != nil {
+				reply.ErrorReply = s.errorReply(err)
+			} else {
+				reply.BetweennessReply = &BetweennessReply{Prf: *bp}
+			}
+		case m.CheckpointRequest != nil:
+			sc, err := s.checkpoint(m.CheckpointRequest.Seq)
+			if err != nil {
+				reply.ErrorReply = s.errorReply(err)
+			} else {
+				reply.CheckpointReply = &CheckpointReply{Chk: *sc}
+			}
+		default:
+			reply.ErrorReply = &ErrorReply{Msg: "unknown request"}
+		}
+		if err := c.put(reply); err != nil {
+			return
+		}
+	}
+}
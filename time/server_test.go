@@ -0,0 +1,92 @@
+package time
+
+import (
+	"encoding/gob"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dedis/crypto/abstract"
+	"github.com/dedis/crypto/nist"
+	"github.com/dedis/crypto/random"
+)
+
+// Start a server and connect to it, ask sends a request and
+// returns its reply
+func startServer(t *testing.T) (s *Server, suite abstract.Suite, public abstract.Point,
+	ask func(m *Message) *Message) {
+	suite = nist.NewAES128SHA256P256()
+	secret := suite.Secret().Pick(random.Stream)
+	public = suite.Point().Mul(nil, secret)
+	s = NewServer(suite, public, secret, 50*time.Millisecond)
+	if err := s.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+
+	nc, err := net.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, dec := gob.NewEncoder(nc), gob.NewDecoder(nc)
+	ask = func(m *Message) *Message {
+		if err := enc.Encode(m); err != nil {
+			t.Fatal(err)
+		}
+		reply := &Message{}
+		if err := dec.Decode(reply); err != nil {
+			t.Fatal(err)
+		}
+		if reply.ReqNo != m.ReqNo {
+			t.Fatal("reply to request", reply.ReqNo, "instead of", m.ReqNo)
+		}
+		return reply
+	}
+	return
+}
+
+func TestServer(t *testing.T) {
+	s, suite, public, ask := startServer(t)
+	defer s.Close()
+
+	// one value per interval, each stamp checks against its signed entry
+	var entries []*LogEntry
+	for i := 1; i <= 3; i++ {
+		val := make([]byte, suite.Hash().Size())
+		val[0] = byte(i)
+		reply := ask(&Message{ReqNo: uint64(i), StampRequest: &StampRequest{Val: val}})
+		if reply.StampReply == nil {
+			t.Fatal("no stamp reply")
+		}
+		se := SignedEntry{Ent: reply.StampReply.Ent, Sig: reply.StampReply.Sig}
+		e, err := se.Verify(suite, public)
+		if err != nil {
+			t.Fatal("stamp not signed by the server:", err)
+		}
+		if e.Seq != uint64(i) || !reply.StampReply.Prf.Check(suite.Hash, e.Root, val) {
+			t.Fatal("stamp of value", i, "not in entry", e.Seq)
+		}
+		entries = append(entries, e)
+	}
+
+	reply := ask(&Message{ReqNo: 4, EntryRequest: &EntryRequest{Seq: 2}})
+	if reply.EntryReply == nil {
+		t.Fatal("no entry reply")
+	}
+	if e, err := reply.EntryReply.Log.Verify(suite, public); err != nil || e.Seq != 2 {
+		t.Fatal("entry 2 not returned:", err)
+	}
+	if reply := ask(&Message{ReqNo: 5, EntryRequest: &EntryRequest{Seq: 9}}); reply.ErrorReply == nil {
+		t.Fatal("unknown entry returned")
+	}
+
+	reply = ask(&Message{ReqNo: 6, ProofRequest: &ProofRequest{Old: 1, New: 3}})
+	if reply.ProofReply == nil {
+		t.Fatal("no proof reply")
+	}
+	if !reply.ProofReply.Prf.Check(suite.Hash, entries[2].Root, entries[0].Root) {
+		t.Fatal("proof that entry 1 happened before entry 3 does not check")
+	}
+	if reply := ask(&Message{ReqNo: 7, ProofRequest: &ProofRequest{Old: 3, New: 1}}); reply.ErrorReply == nil {
+		t.Fatal("proof returned from a newer to an older entry")
+	}
+}
@@ -1,13 +1,21 @@
 package main
 
 import (
+	"flag"
+	"os"
+	"os/signal"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
 	"github.com/dedis/crypto/config"
-	"github.com/dedis/crypto/suites"
 	"github.com/dedis/crypto/nist"
+	"github.com/dedis/crypto/suites"
+	stamp "github.com/dedis/prifi/time"
 )
 
 type ConfigData struct {
-	Keys config.Keys	// Configured key-pairs for this timestap server
+	Keys config.Keys // Configured key-pairs for this timestap server
 }
 
 var keyPairs []config.KeyPair
@@ -17,14 +25,27 @@ var configFile config.File
 var defaultSuite = nist.NewAES128SHA256P256()
 var cryptoSuites = suites.All()
 
+var addr string
+var interval time.Duration
+var retention stamp.Retention
+
+func init() {
+	flag.StringVar(&addr, "addr", ":9600", "the address to listen for clients at")
+	flag.DurationVar(&interval, "interval", time.Second, "the time between signed log entries")
+	flag.IntVar(&retention.Entries, "keep", 0, "number of log entries retained, unbounded if 0")
+	flag.DurationVar(&retention.Age, "maxage", 0, "age of the oldest log entry retained, unbounded if 0")
+	flag.IntVar(&retention.Bytes, "maxbytes", 0, "size in bytes of the log retained, unbounded if 0")
+	flag.DurationVar(&retention.Every, "prune", time.Minute, "the time between pruning runs")
+}
+
 func readConfig() error {
 
 	// Load the configuration file
 	configFile.Load("stampd", &configData)
 
 	// Read or create our public/private keypairs
-	pairs,err := configFile.Keys(&configData.Keys, cryptoSuites,
-					defaultSuite)
+	pairs, err := configFile.Keys(&configData.Keys, cryptoSuites,
+		defaultSuite)
 	if err != nil {
 		return err
 	}
@@ -33,7 +54,37 @@ func readConfig() error {
 	return nil
 }
 
-func main() {
-	readConfig()
+// Key pair entries are signed with: the one of the default suite,
+// else the first one configured
+func signingKey() *config.KeyPair {
+	for i := range keyPairs {
+		if keyPairs[i].Suite.String() == defaultSuite.String() {
+			return &keyPairs[i]
+		}
+	}
+	return &keyPairs[0]
 }
 
+func main() {
+	flag.Parse()
+	if err := readConfig(); err != nil {
+		log.Fatal("unable to read configuration:", err)
+	}
+	if len(keyPairs) == 0 {
+		log.Fatal("no key pair configured")
+	}
+
+	kp := signingKey()
+	s := stamp.NewServer(kp.Suite, kp.Public, kp.Secret, interval)
+	s.Retention = retention
+	if err := s.Listen(addr); err != nil {
+		log.Fatal("unable to listen for clients:", err)
+	}
+	log.Println("timestamping at", s.Addr(), "every", interval, "with key", kp.Public)
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	<-sigs
+	log.Println("closing after", s.Seq(), "log entries")
+	s.Close()
+}
@@ -2,19 +2,21 @@ package tree
 
 import (
 	"errors"
+
+	"github.com/dedis/prifi/coco/hashid"
 )
 
 
 type HashId []byte	// Cryptographic hash content-IDs
 
 func (id HashId) Bit(i uint) int {
-	return int(id[i>>3] >> (i&7))
+	return int(id[i>>3] >> (i&7)) & 1
 }
 
 // Find the skip-chain level of an ID
 func (id *HashId) Level() int {
 	var level uint
-	for id.Bit(level) == 0 {
+	for level < uint(len(*id))*8 && id.Bit(level) == 0 {
 		level++
 	}
 	return int(level)
@@ -47,4 +49,12 @@ func (m HashMap) Get(id HashId) ([]byte,error) {
 	return blob,nil
 }
 
+// HashGet looking blobs up in a coco HashGet, such as a hashid.PeerGet
+// fetching them from another node
+type RemoteGet struct {
+	Src hashid.HashGet
+}
 
+func (g RemoteGet) Get(id HashId) ([]byte, error) {
+	return g.Src.Get(hashid.HashId(id))
+}
@@ -0,0 +1,288 @@
+package tree
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"sync"
+
+	"github.com/dedis/crypto/abstract"
+	"github.com/dedis/crypto/anon"
+	"github.com/dedis/crypto/random"
+)
+
+// Each node maintains _one_ tamper-evident log of events it generates.
+// Each node must ensure that its event history remains linear
+// (i.e., does not fork or roll back).
+// One event history is shared among all trees the node participates in.
+//
+// Each tree requires the node to produce new events
+// within certain time-windows determined by the node's ancestor(s) in the tree.
+// If the next-event time windows for multiple trees overlap,
+// the node can produce one event to "satisfy" several overlapping trees.
+// If a node fails to produce an event for a tree in the given time window,
+// the node is considered to have "failed" during the corresponding tree step.
+//
+// Each node, when it receives a new event from a peer,
+// verifies that the new event is a strict successor to the last one,
+// and does not "fork" the peer's event history for example.
+// Each node's metadata included in a new event includes skip-chain info,
+// allowing other nodes to verify small or large steps forward in history
+// without having to store or traverse many intervening nodes in the chain.
+//
+// An event links, at each level i up to the highest level of its
+// predecessors, to the newest earlier event whose ID has level at least
+// i; as levels follow the trailing zero bits of IDs, going back from any
+// event to any earlier one takes O(log n) links. Events are signed by
+// the owner of the log and kept by ID in a content-addressed store.
+
+var ErrBadEvent error = errors.New("malformed or unsigned event")
+var ErrNoPath error = errors.New("no skip-chain path between the events")
+var ErrLogFork error = errors.New("two events signed with the same sequence number")
+
+// Skip-chain link to an earlier event
+type Link struct {
+	Seq uint64
+	Id  HashId
+}
+
+type Event struct {
+	Seq  uint64
+	Pred []Link // Pred[i]: newest earlier event of level >= i
+	Data []byte
+	Sig  []byte // signature of the owner of the log on the ID
+
+	id HashId
+}
+
+// Content-addressed storage of events
+type HashStore interface {
+	HashGet
+	Put(id HashId, data []byte)
+}
+
+// Encode the header and data of the event, the content of its ID
+func (e *Event) body() []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, e.Seq)
+	binary.Write(&b, binary.LittleEndian, uint32(len(e.Pred)))
+	for _, l := range e.Pred {
+		binary.Write(&b, binary.LittleEndian, l.Seq)
+		binary.Write(&b, binary.LittleEndian, uint32(len(l.Id)))
+		b.Write(l.Id)
+	}
+	binary.Write(&b, binary.LittleEndian, uint32(len(e.Data)))
+	b.Write(e.Data)
+	return b.Bytes()
+}
+
+// ID of the event: the hash of its header and data
+func (e *Event) Id(suite abstract.Suite) HashId {
+	if e.id == nil {
+		e.id = HashId(abstract.HashBytes(suite, e.body()))
+	}
+	return e.id
+}
+
+func (e *Event) MarshalBinary() ([]byte, error) {
+	b := bytes.NewBuffer(e.body())
+	binary.Write(b, binary.LittleEndian, uint32(len(e.Sig)))
+	b.Write(e.Sig)
+	return b.Bytes(), nil
+}
+
+// Read a length prefixed byte string
+func readBytes(b *bytes.Buffer) ([]byte, error) {
+	var n uint32
+	if err := binary.Read(b, binary.LittleEndian, &n); err != nil {
+		return nil, err
+	}
+	if int(n) > b.Len() {
+		return nil, ErrBadEvent
+	}
+	return append([]byte(nil), b.Next(int(n))...), nil
+}
+
+func (e *Event) UnmarshalBinary(data []byte) error {
+	b := bytes.NewBuffer(data)
+	var npred uint32
+	if err := binary.Read(b, binary.LittleEndian, &e.Seq); err != nil {
+		return err
+	}
+	if err := binary.Read(b, binary.LittleEndian, &npred); err != nil {
+		return err
+	}
+	e.Pred = nil
+	for i := uint32(0); i < npred; i++ {
+		var l Link
+		if err := binary.Read(b, binary.LittleEndian, &l.Seq); err != nil {
+			return err
+		}
+		id, err := readBytes(b)
+		if err != nil {
+			return err
+		}
+		l.Id = HashId(id)
+		e.Pred = append(e.Pred, l)
+	}
+	var err error
+	if e.Data, err = readBytes(b); err != nil {
+		return err
+	}
+	if e.Sig, err = readBytes(b); err != nil {
+		return err
+	}
+	e.id = nil
+	return nil
+}
+
+// Check that the event is signed by the owner of the log
+func VerifyEvent(suite abstract.Suite, pub abstract.Point, e *Event) error {
+	if _, err := anon.Verify(suite, e.Id(suite), anon.Set{pub}, nil, e.Sig); err != nil {
+		return ErrBadEvent
+	}
+	return nil
+}
+
+// Fetch the event id from get, checking it against its ID and signature
+func getEvent(suite abstract.Suite, pub abstract.Point, get HashGet, id HashId) (*Event, error) {
+	data, err := get.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	e := &Event{}
+	if err := e.UnmarshalBinary(data); err != nil {
+		return nil, ErrBadEvent
+	}
+	if subtle.ConstantTimeCompare(e.Id(suite), id) != 1 {
+		return nil, ErrBadEvent
+	}
+	return e, VerifyEvent(suite, pub, e)
+}
+
+// Check that the event to follows the event from in the log of the
+// owner of pub, following the skip-chain links of to back to from.
+// Returns the events visited, newest first.
+func VerifyPath(suite abstract.Suite, pub abstract.Point, get HashGet,
+	from, to *Event) ([]*Event, error) {
+	if err := VerifyEvent(suite, pub, from); err != nil {
+		return nil, err
+	}
+	if err := VerifyEvent(suite, pub, to); err != nil {
+		return nil, err
+	}
+	if from.Seq > to.Seq {
+		return nil, ErrNoPath
+	}
+
+	path := []*Event{to}
+	cur := to
+	for cur.Seq > from.Seq {
+		// the longest link not going past from
+		var next *Link
+		for i := len(cur.Pred) - 1; i >= 0; i-- {
+			if l := &cur.Pred[i]; l.Seq >= from.Seq && l.Seq < cur.Seq {
+				next = l
+				break
+			}
+		}
+		if next == nil {
+			return nil, ErrNoPath
+		}
+		if next.Seq == from.Seq {
+			if subtle.ConstantTimeCompare(next.Id, from.Id(suite)) != 1 {
+				return nil, ErrLogFork
+			}
+			return append(path, from), nil
+		}
+		e, err := getEvent(suite, pub, get, next.Id)
+		if err != nil {
+			return nil, err
+		}
+		if e.Seq != next.Seq {
+			return nil, ErrBadEvent
+		}
+		path = append(path, e)
+		cur = e
+	}
+	if subtle.ConstantTimeCompare(cur.Id(suite), from.Id(suite)) != 1 {
+		return nil, ErrLogFork
+	}
+	return path, nil
+}
+
+// Check whether two events signed by the owner of pub show a fork
+func CheckFork(suite abstract.Suite, pub abstract.Point, a, b *Event) error {
+	if VerifyEvent(suite, pub, a) != nil || VerifyEvent(suite, pub, b) != nil {
+		return ErrBadEvent
+	}
+	if a.Seq == b.Seq && subtle.ConstantTimeCompare(a.Id(suite), b.Id(suite)) != 1 {
+		return ErrLogFork
+	}
+	return nil
+}
+
+// Tamper-evident log of the events of one node
+type Log struct {
+	mu    sync.Mutex
+	suite abstract.Suite
+	pri   abstract.Secret
+	pub   abstract.Point
+	store HashStore
+	head  *Event // newest event
+}
+
+func (l *Log) Init(suite abstract.Suite, pri abstract.Secret, store HashStore) {
+	l.suite = suite
+	l.pri = pri
+	l.pub = suite.Point().Mul(nil, pri)
+	l.store = store
+}
+
+// Newest event, nil before the first one
+func (l *Log) Head() *Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.head
+}
+
+// Sign and store a new event holding data, after the head
+func (l *Log) Append(data []byte) (*Event, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e := &Event{Data: data}
+	if ip := l.head; ip != nil { // immediate predecessor
+		// Start with a copy of our predecessor's predecessor list
+		e.Pred = make([]Link, len(ip.Pred))
+		copy(e.Pred, ip.Pred)
+
+		// Incorporate immediate predecessor into predecessor list
+		link := Link{Seq: ip.Seq, Id: ip.Id(l.suite)}
+		iplev := link.Id.Level()
+		for i := 0; i <= iplev; i++ {
+			if i < len(e.Pred) {
+				e.Pred[i] = link
+			} else {
+				e.Pred = append(e.Pred, link)
+			}
+		}
+
+		e.Seq = ip.Seq + 1
+	}
+	e.Sig = anon.Sign(l.suite, random.Stream, e.Id(l.suite), anon.Set{l.pub}, nil, 0, l.pri)
+
+	b, err := e.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	l.store.Put(e.Id(l.suite), b)
+	l.head = e
+	return e, nil
+}
+
+// Event id of the log
+func (l *Log) Get(id HashId) (*Event, error) {
+	return getEvent(l.suite, l.pub, l.store, id)
+}
@@ -0,0 +1,72 @@
+package tree
+
+import (
+	"testing"
+)
+
+// Paths between any two events of a log verify in few steps,
+// and events signed at the same position with other data show a fork
+func TestLogPath(t *testing.T) {
+	suite := testSuite
+	pri := suite.Secret().Pick(testRand)
+	pub := suite.Point().Mul(nil, pri)
+	store := make(HashMap)
+	var l Log
+	l.Init(suite, pri, store)
+
+	n := 300
+	events := make([]*Event, n)
+	for i := range events {
+		e, err := l.Append([]byte{byte(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Seq != uint64(i) {
+			t.Fatal("event", i, "has sequence number", e.Seq)
+		}
+		events[i] = e
+	}
+
+	for _, from := range []int{0, 1, 17, 150, n - 2, n - 1} {
+		path, err := VerifyPath(suite, pub, store, events[from], events[n-1])
+		if err != nil {
+			t.Fatal("no path from event", from, ":", err)
+		}
+		if len(path) > 40 {
+			t.Error("path from event", from, "takes", len(path), "steps")
+		}
+	}
+	if _, err := VerifyPath(suite, pub, store, events[n-1], events[0]); err != ErrNoPath {
+		t.Fatal("path going forward in time")
+	}
+
+	// another log of the same owner, forking after event 10
+	var fork Log
+	fork.Init(suite, pri, make(HashMap))
+	for i := 0; i <= 10; i++ {
+		if _, err := fork.Append([]byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	forked, _ := fork.Append([]byte("fork"))
+	if err := CheckFork(suite, pub, events[11], forked); err != ErrLogFork {
+		t.Fatal("fork not detected")
+	}
+	if _, err := VerifyPath(suite, pub, store, forked, events[n-1]); err == nil {
+		t.Fatal("path from a forked event")
+	}
+
+	// events are checked against their signature
+	other := suite.Point().Mul(nil, suite.Secret().Pick(testRand))
+	if err := VerifyEvent(suite, other, events[0]); err != ErrBadEvent {
+		t.Fatal("event verified under another key")
+	}
+	b, _ := events[5].MarshalBinary()
+	e := &Event{}
+	if err := e.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyEvent(suite, pub, e); err != nil {
+		t.Fatal("decoded event:", err)
+	}
+}